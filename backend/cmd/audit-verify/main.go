@@ -0,0 +1,53 @@
+// Command audit-verify checks the hash chain of the audit log. It exits with
+// status 1 when an entry was changed or removed, and prints the head of the
+// chain otherwise. Keep the printed head somewhere outside the database and
+// pass it to a later run with -expect-head, so entries removed from the end
+// of the log are noticed too.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/pkg/database"
+)
+
+func main() {
+	expectID := flag.Int64("expect-id", 0, "ID of an entry printed by an earlier run, which must still be in the chain")
+	expectHead := flag.String("expect-head", "", "hash of the entry given by -expect-id")
+	flag.Parse()
+
+	// the environment may come from the deployment instead of a .env file
+	_ = godotenv.Load()
+	dbpool, err := database.NewConn()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dbpool.Close()
+
+	repo := services.NewPgAuditLogRepository(dbpool.Pool)
+	report, err := repo.VerifyChain(context.Background())
+	if err != nil {
+		if errors.Is(err, services.ErrAuditChainBroken) {
+			fmt.Printf("FAILED after %d valid entries: %v\n", report.Checked, err)
+			os.Exit(1)
+		}
+		log.Fatal(err)
+	}
+
+	if *expectHead != "" {
+		entry, err := repo.GetByID(context.Background(), *expectID)
+		if err != nil || entry.Hash != *expectHead {
+			fmt.Printf("FAILED: entry %d with hash %s is no longer in the chain\n", *expectID, *expectHead)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("OK: %d entries checked, head is entry %d with hash %s\n", report.Checked, report.HeadID, report.HeadHash)
+}
@@ -0,0 +1,232 @@
+// Command mock-oidc is a minimal OpenID Connect provider for trying out and
+// testing Kira's single sign-on locally. It logs in whoever is typed into its
+// login form, so it must never be exposed publicly.
+//
+// Run it and start the server with
+//
+//	OIDC_ISSUER=http://localhost:9999 OIDC_CLIENT_ID=kira
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+const keyID = "mock-oidc-key"
+
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	emailVerified bool
+	name          string
+	expiresAt     time.Time
+}
+
+type mockProvider struct {
+	issuer string
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Mock OIDC login</title>
+<h1>Mock OIDC login</h1>
+<form method="post">
+	{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+	{{end}}
+	<p><label>Email <input name="email" value="{{.Email}}"></label></p>
+	<p><label>Name <input name="name" value="{{.Name}}"></label></p>
+	<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+	<p><button type="submit">Log in</button></p>
+</form>
+`))
+
+func main() {
+	addr := utils.GetEnvOrDefault("MOCK_OIDC_ADDR", ":9999")
+	issuer := strings.TrimSuffix(utils.GetEnvOrDefault("MOCK_OIDC_ISSUER", "http://localhost:9999"), "/")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &mockProvider{issuer: issuer, key: key, codes: make(map[string]authorization)}
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	router.HandleFunc("GET /jwks", p.jwks)
+	router.HandleFunc("GET /authorize", p.showLogin)
+	router.HandleFunc("POST /authorize", p.authorize)
+	router.HandleFunc("POST /token", p.token)
+
+	log.Printf("mock OIDC provider for issuer %s listening on %s", issuer, addr)
+	log.Fatal(http.ListenAndServe(addr, router))
+}
+
+func (p *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	}, http.StatusOK)
+}
+
+func (p *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	utils.RespondWithJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   b64(p.key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	}, http.StatusOK)
+}
+
+func (p *mockProvider) showLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "only the authorization code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	params := make(map[string]string)
+	for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge"} {
+		params[name] = query.Get(name)
+	}
+	email := query.Get("login_hint")
+	if email == "" {
+		email = "jane@example.com"
+	}
+	loginForm.Execute(w, map[string]any{"Params": params, "Email": email, "Name": "Jane Doe"})
+}
+
+func (p *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.PostForm.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomToken()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		clientID:      r.PostForm.Get("client_id"),
+		redirectURI:   redirectURI.String(),
+		codeChallenge: r.PostForm.Get("code_challenge"),
+		nonce:         r.PostForm.Get("nonce"),
+		email:         r.PostForm.Get("email"),
+		emailVerified: r.PostForm.Get("email_verified") == "true",
+		name:          r.PostForm.Get("name"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.PostForm.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	clientID := r.PostForm.Get("client_id")
+	if basicID, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(basicID)
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(auth.expiresAt):
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case auth.clientID != clientID || auth.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant", "client_id or redirect_uri does not match")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge:
+		tokenError(w, "invalid_grant", "code_verifier does not match")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.issuer,
+		"sub":                "mock|" + strings.ToLower(auth.email),
+		"aud":                auth.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              auth.nonce,
+		"email":              auth.email,
+		"email_verified":     auth.emailVerified,
+		"name":               auth.name,
+		"preferred_username": strings.SplitN(auth.email, "@", 2)[0],
+	})
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, map[string]any{
+		"access_token": randomToken(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	}, http.StatusOK)
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	utils.RespondWithJSON(w, map[string]string{"error": code, "error_description": description}, http.StatusBadRequest)
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 	"github.com/sajidcodesdotcom/kira/internal/api"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/mailer"
 	"github.com/sajidcodesdotcom/kira/internal/middleware"
+	"github.com/sajidcodesdotcom/kira/internal/oidc"
+	"github.com/sajidcodesdotcom/kira/internal/ratelimit"
 	"github.com/sajidcodesdotcom/kira/internal/services"
 	"github.com/sajidcodesdotcom/kira/pkg/database"
 	"github.com/sajidcodesdotcom/kira/utils"
@@ -33,43 +39,232 @@ func main() {
 	router := http.NewServeMux()
 
 	userRepo := services.NewPgUserRepository(dbpool.Pool)
+	sessionRepo := services.NewPgSessionRepository(dbpool.Pool)
+	tokenRepo := services.NewPgPersonalAccessTokenRepository(dbpool.Pool)
+
+	// rate limits, "auth" covers the public login endpoints per IP and "api"
+	// everything behind authentication per user or token
+	rateLimitStore := ratelimit.NewStoreFromEnv(dbpool.Pool)
+	authLimit, err := ratelimit.LimitFromEnv("RATE_LIMIT_AUTH", ratelimit.Limit{Requests: 20, Period: time.Minute})
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiLimit, err := ratelimit.LimitFromEnv("RATE_LIMIT_API", ratelimit.Limit{Requests: 300, Period: time.Minute})
+	if err != nil {
+		log.Fatal(err)
+	}
+	authRateLimit := middleware.RateLimit(rateLimitStore, "auth", authLimit)
+	apiRateLimit := middleware.RateLimit(rateLimitStore, "api", apiLimit)
+
+	authenticate := middleware.AuthMiddleware(sessionRepo, tokenRepo)
+	authMiddleware := func(next http.Handler) http.Handler {
+		return authenticate(apiRateLimit(next))
+	}
+	// account settings can't be changed with a personal access token
+	sessionAuth := func(next http.Handler) http.Handler {
+		return authMiddleware(middleware.SessionOnly(next))
+	}
+	projectsRead := middleware.RequireScope(auth.ScopeProjectsRead)
+	projectsWrite := middleware.RequireScope(auth.ScopeProjectsWrite)
+	tasksRead := middleware.RequireScope(auth.ScopeTasksRead)
+	tasksWrite := middleware.RequireScope(auth.ScopeTasksWrite)
+	usersRead := middleware.RequireScope(auth.ScopeUsersRead)
+
+	keyring, err := auth.LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.SetKeyring(keyring)
+
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// email verification handlers
+	verificationRepo := services.NewPgEmailVerificationRepository(dbpool.Pool)
+	verificationHandlers := api.NewEmailVerificationHandler(userRepo, verificationRepo, mail, validator.New())
+	router.Handle("POST /api/auth/verify-email", authRateLimit(http.HandlerFunc(verificationHandlers.VerifyEmail)))
+	router.Handle("POST /api/auth/resend-verification", sessionAuth(http.HandlerFunc(verificationHandlers.ResendVerification)))
+	verificationPolicy := auth.VerificationPolicyFromEnv()
+
+	// audit log handlers
+	auditRepo := services.NewPgAuditLogRepository(dbpool.Pool)
+	auditHandlers := api.NewAuditHandler(auditRepo)
+	router.Handle("GET /api/audit-logs", sessionAuth(middleware.RequirePermission(auth.PermAuditRead)(http.HandlerFunc(auditHandlers.ListAuditLogs))))
 
 	// auth handlers
-	authHandlers := api.NewAuthHandler(userRepo, validator.New())
-	router.HandleFunc("POST /api/auth/login", authHandlers.Login)
-	router.HandleFunc("POST /api/auth/register", authHandlers.Register)
-	router.HandleFunc("POST /api/auth/logout", authHandlers.Logout)
+	twoFactorRepo := services.NewPgTwoFactorRepository(dbpool.Pool)
+	throttleRepo := services.NewPgLoginThrottleRepository(dbpool.Pool)
+	authHandlers := api.NewAuthHandler(userRepo, sessionRepo, twoFactorRepo, throttleRepo, auditRepo, verificationHandlers, validator.New())
+	router.Handle("POST /api/auth/login", authRateLimit(http.HandlerFunc(authHandlers.Login)))
+	router.Handle("POST /api/auth/login/2fa", authRateLimit(http.HandlerFunc(authHandlers.LoginTwoFactor)))
+	router.Handle("POST /api/auth/register", authRateLimit(http.HandlerFunc(authHandlers.Register)))
+	router.Handle("POST /api/auth/refresh", authRateLimit(http.HandlerFunc(authHandlers.Refresh)))
+	router.Handle("POST /api/auth/logout", authRateLimit(http.HandlerFunc(authHandlers.Logout)))
+	router.Handle("POST /api/auth/logout-all", sessionAuth(http.HandlerFunc(authHandlers.LogoutAll)))
+	router.HandleFunc("GET /.well-known/jwks.json", authHandlers.JWKS)
+
+	// single sign-on handlers, only registered when a provider is configured
+	oidcConfig, err := oidc.ConfigFromEnv()
+	switch {
+	case err == nil:
+		identityRepo := services.NewPgUserIdentityRepository(dbpool.Pool)
+		oidcStateRepo := services.NewPgOIDCStateRepository(dbpool.Pool)
+		oidcHandlers := api.NewOIDCHandler(authHandlers, oidc.NewProvider(oidcConfig, nil), userRepo, identityRepo, oidcStateRepo)
+		router.Handle("GET /api/auth/oidc/login", authRateLimit(http.HandlerFunc(oidcHandlers.Login)))
+		router.Handle("GET /api/auth/oidc/callback", authRateLimit(http.HandlerFunc(oidcHandlers.Callback)))
+	case !errors.Is(err, oidc.ErrNotConfigured):
+		log.Fatal(err)
+	}
+
+	// two-factor handlers
+	twoFactorHandlers := api.NewTwoFactorHandler(userRepo, twoFactorRepo, validator.New())
+	router.Handle("GET /api/auth/2fa", sessionAuth(http.HandlerFunc(twoFactorHandlers.Status)))
+	router.Handle("POST /api/auth/2fa/setup", sessionAuth(http.HandlerFunc(twoFactorHandlers.Setup)))
+	router.Handle("POST /api/auth/2fa/enable", sessionAuth(http.HandlerFunc(twoFactorHandlers.Enable)))
+	router.Handle("POST /api/auth/2fa/disable", sessionAuth(http.HandlerFunc(twoFactorHandlers.Disable)))
+
+	// password reset handlers
+	passwordResetRepo := services.NewPgPasswordResetRepository(dbpool.Pool)
+	passwordResetHandlers := api.NewPasswordResetHandler(userRepo, passwordResetRepo, mail, validator.New())
+	router.Handle("POST /api/auth/forgot-password", authRateLimit(http.HandlerFunc(passwordResetHandlers.ForgotPassword)))
+	router.Handle("POST /api/auth/reset-password", authRateLimit(http.HandlerFunc(passwordResetHandlers.ResetPassword)))
 
 	// user handlers
-	userHandlers := api.NewUserHandler(userRepo, validator.New())
-	router.Handle("/api/users", middleware.AuthMiddleware(http.HandlerFunc(userHandlers.ListUsers)))
-	router.Handle("PUT /api/user/update", middleware.AuthMiddleware(http.HandlerFunc(userHandlers.UpdateUser)))
-	router.Handle("GET /api/user/by-email", middleware.AuthMiddleware(http.HandlerFunc(userHandlers.GetUserByEmail)))
-	router.Handle("GET /api/user/by-username", middleware.AuthMiddleware(http.HandlerFunc(userHandlers.GetByUsername)))
-	router.Handle("DELETE /api/user/delete", middleware.AuthMiddleware(http.HandlerFunc(userHandlers.Delete)))
+	userHandlers := api.NewUserHandler(userRepo, auditRepo, validator.New())
+	canReadUsers := middleware.RequirePermission(auth.PermUsersRead)
+	router.Handle("/api/users", authMiddleware(usersRead(canReadUsers(http.HandlerFunc(userHandlers.ListUsers)))))
+	router.Handle("PUT /api/user/update", sessionAuth(http.HandlerFunc(userHandlers.UpdateUser)))
+	router.Handle("GET /api/user/by-email", authMiddleware(usersRead(canReadUsers(http.HandlerFunc(userHandlers.GetUserByEmail)))))
+	router.Handle("GET /api/user/by-username", authMiddleware(usersRead(canReadUsers(http.HandlerFunc(userHandlers.GetByUsername)))))
+	router.Handle("DELETE /api/user/delete", sessionAuth(middleware.RequirePermission(auth.PermUsersDelete)(http.HandlerFunc(userHandlers.Delete))))
+	router.Handle("PUT /api/user/role", sessionAuth(middleware.RequirePermission(auth.PermUsersManageRoles)(http.HandlerFunc(userHandlers.UpdateRole))))
+	router.Handle("POST /api/user/unlock", sessionAuth(middleware.RequirePermission(auth.PermUsersUnlock)(http.HandlerFunc(authHandlers.UnlockLogin))))
 
 	// project handlers
 	projectRepo := services.NewPgProjectRepository(dbpool.Pool)
-	projectHandlers := api.NewProjectHandler(projectRepo, validator.New())
-	router.Handle("POST /api/project/create", middleware.AuthMiddleware(http.HandlerFunc(projectHandlers.CreateProject)))
-	router.Handle("GET /api/projects", middleware.AuthMiddleware(http.HandlerFunc(projectHandlers.ListProjects)))
-	router.Handle("GET /api/project/by-id", middleware.AuthMiddleware(http.HandlerFunc(projectHandlers.GetProjectByID)))
-	router.Handle("PUT /api/project/update", middleware.AuthMiddleware(http.HandlerFunc(projectHandlers.UpdateProject)))
-	router.Handle("DELETE /api/project/delete", middleware.AuthMiddleware(http.HandlerFunc(projectHandlers.DeleteProject)))
-	router.Handle("GET /api/project/by-owner", middleware.AuthMiddleware(http.HandlerFunc(projectHandlers.GetProjectsByOwner)))
+	memberRepo := services.NewPgProjectMemberRepository(dbpool.Pool)
+	projectHandlers := api.NewProjectHandler(projectRepo, memberRepo, validator.New())
+	router.Handle("POST /api/project/create", authMiddleware(projectsWrite(middleware.RequireVerifiedEmail(userRepo, verificationPolicy, auth.ActionCreateProject)(http.HandlerFunc(projectHandlers.CreateProject)))))
+	router.Handle("GET /api/projects", authMiddleware(projectsRead(http.HandlerFunc(projectHandlers.ListProjects))))
+	router.Handle("GET /api/project/by-id", authMiddleware(projectsRead(http.HandlerFunc(projectHandlers.GetProjectByID))))
+	router.Handle("PUT /api/project/update", authMiddleware(projectsWrite(http.HandlerFunc(projectHandlers.UpdateProject))))
+	router.Handle("DELETE /api/project/delete", authMiddleware(projectsWrite(http.HandlerFunc(projectHandlers.DeleteProject))))
+	router.Handle("GET /api/project/by-owner", authMiddleware(projectsRead(http.HandlerFunc(projectHandlers.GetProjectsByOwner))))
+	router.Handle("GET /api/project/members", authMiddleware(projectsRead(http.HandlerFunc(projectHandlers.ListMembers))))
+	router.Handle("POST /api/project/members", authMiddleware(projectsWrite(middleware.RequireVerifiedEmail(userRepo, verificationPolicy, auth.ActionAddMember)(http.HandlerFunc(projectHandlers.AddMember)))))
+	router.Handle("PUT /api/project/members", authMiddleware(projectsWrite(http.HandlerFunc(projectHandlers.UpdateMemberRole))))
+	router.Handle("DELETE /api/project/members", authMiddleware(projectsWrite(http.HandlerFunc(projectHandlers.RemoveMember))))
+
+	// workflow handlers
+	workflowRepo := services.NewPgWorkflowRepository(dbpool.Pool)
+	workflowHandlers := api.NewWorkflowHandler(workflowRepo, memberRepo, validator.New())
+	router.Handle("GET /api/project/workflow", authMiddleware(projectsRead(http.HandlerFunc(workflowHandlers.GetWorkflow))))
+	router.Handle("PUT /api/project/workflow", authMiddleware(projectsWrite(http.HandlerFunc(workflowHandlers.UpdateWorkflow))))
+	router.Handle("DELETE /api/project/workflow", authMiddleware(projectsWrite(http.HandlerFunc(workflowHandlers.ResetWorkflow))))
+
+	// task handlers
+	taskRepo := services.NewPgTaskRepository(dbpool.Pool)
+	customFieldRepo := services.NewPgCustomFieldRepository(dbpool.Pool)
+	taskHandlers := api.NewTaskHandler(taskRepo, workflowRepo, customFieldRepo, memberRepo, validator.New())
+	router.Handle("POST /api/tasks", authMiddleware(tasksWrite(middleware.RequireVerifiedEmail(userRepo, verificationPolicy, auth.ActionCreateTask)(http.HandlerFunc(taskHandlers.CreateTask)))))
+	router.Handle("GET /api/tasks", authMiddleware(tasksRead(http.HandlerFunc(taskHandlers.ListTasksByProject))))
+	router.Handle("GET /api/tasks/by-id", authMiddleware(tasksRead(http.HandlerFunc(taskHandlers.GetTaskByID))))
+	router.Handle("GET /api/tasks/tree", authMiddleware(tasksRead(http.HandlerFunc(taskHandlers.GetTaskTree))))
+	router.Handle("GET /api/tasks/by-assignee", authMiddleware(tasksRead(http.HandlerFunc(taskHandlers.ListTasksByAssignee))))
+	router.Handle("PUT /api/tasks", authMiddleware(tasksWrite(http.HandlerFunc(taskHandlers.UpdateTask))))
+	router.Handle("DELETE /api/tasks", authMiddleware(tasksWrite(http.HandlerFunc(taskHandlers.DeleteTask))))
+	router.Handle("GET /api/tasks/board", authMiddleware(tasksRead(http.HandlerFunc(taskHandlers.GetBoard))))
+	router.Handle("POST /api/tasks/move", authMiddleware(tasksWrite(http.HandlerFunc(taskHandlers.MoveTask))))
+
+	// label handlers
+	labelRepo := services.NewPgLabelRepository(dbpool.Pool)
+	labelHandlers := api.NewLabelHandler(labelRepo, memberRepo, validator.New())
+	router.Handle("POST /api/labels", authMiddleware(tasksWrite(http.HandlerFunc(labelHandlers.CreateLabel))))
+	router.Handle("GET /api/labels", authMiddleware(tasksRead(http.HandlerFunc(labelHandlers.ListLabels))))
+	router.Handle("PUT /api/labels", authMiddleware(tasksWrite(http.HandlerFunc(labelHandlers.UpdateLabel))))
+	router.Handle("DELETE /api/labels", authMiddleware(tasksWrite(http.HandlerFunc(labelHandlers.DeleteLabel))))
+
+	// custom field handlers
+	customFieldHandlers := api.NewCustomFieldHandler(customFieldRepo, memberRepo, validator.New())
+	router.Handle("POST /api/custom-fields", authMiddleware(projectsWrite(http.HandlerFunc(customFieldHandlers.CreateCustomField))))
+	router.Handle("GET /api/custom-fields", authMiddleware(projectsRead(http.HandlerFunc(customFieldHandlers.ListCustomFields))))
+	router.Handle("PUT /api/custom-fields", authMiddleware(projectsWrite(http.HandlerFunc(customFieldHandlers.UpdateCustomField))))
+	router.Handle("DELETE /api/custom-fields", authMiddleware(projectsWrite(http.HandlerFunc(customFieldHandlers.DeleteCustomField))))
+
+	// sprint handlers
+	sprintRepo := services.NewPgSprintRepository(dbpool.Pool)
+	sprintHandlers := api.NewSprintHandler(sprintRepo, taskRepo, memberRepo, validator.New())
+	router.Handle("POST /api/sprints", authMiddleware(projectsWrite(http.HandlerFunc(sprintHandlers.CreateSprint))))
+	router.Handle("GET /api/sprints", authMiddleware(projectsRead(http.HandlerFunc(sprintHandlers.ListSprints))))
+	router.Handle("GET /api/sprints/by-id", authMiddleware(projectsRead(http.HandlerFunc(sprintHandlers.GetSprintByID))))
+	router.Handle("PUT /api/sprints", authMiddleware(projectsWrite(http.HandlerFunc(sprintHandlers.UpdateSprint))))
+	router.Handle("DELETE /api/sprints", authMiddleware(projectsWrite(http.HandlerFunc(sprintHandlers.DeleteSprint))))
+	router.Handle("POST /api/sprints/start", authMiddleware(projectsWrite(http.HandlerFunc(sprintHandlers.StartSprint))))
+	router.Handle("POST /api/sprints/close", authMiddleware(projectsWrite(http.HandlerFunc(sprintHandlers.CloseSprint))))
+	router.Handle("GET /api/sprints/tasks", authMiddleware(tasksRead(http.HandlerFunc(sprintHandlers.ListSprintTasks))))
+	router.Handle("PUT /api/sprints/tasks", authMiddleware(tasksWrite(http.HandlerFunc(sprintHandlers.SetSprintTasks))))
+	router.Handle("GET /api/tasks/backlog", authMiddleware(tasksRead(http.HandlerFunc(sprintHandlers.ListBacklog))))
+
+	// report handlers
+	reportRepo := services.NewPgReportRepository(dbpool.Pool)
+	reportHandlers := api.NewReportHandler(reportRepo, sprintRepo, memberRepo)
+	router.Handle("GET /api/reports/burndown", authMiddleware(projectsRead(http.HandlerFunc(reportHandlers.GetBurndown))))
+	router.Handle("GET /api/reports/velocity", authMiddleware(projectsRead(http.HandlerFunc(reportHandlers.GetVelocity))))
+	router.Handle("GET /api/reports/cumulative-flow", authMiddleware(projectsRead(http.HandlerFunc(reportHandlers.GetCumulativeFlow))))
+
+	// comment handlers
+	commentRepo := services.NewPgCommentRepository(dbpool.Pool)
+	commentHandlers := api.NewCommentHandler(commentRepo, taskRepo, userRepo, memberRepo, mail, validator.New())
+	router.Handle("POST /api/tasks/comments", authMiddleware(tasksWrite(http.HandlerFunc(commentHandlers.CreateComment))))
+	router.Handle("GET /api/tasks/comments", authMiddleware(tasksRead(http.HandlerFunc(commentHandlers.ListComments))))
+	router.Handle("PUT /api/tasks/comments", authMiddleware(tasksWrite(http.HandlerFunc(commentHandlers.UpdateComment))))
+	router.Handle("DELETE /api/tasks/comments", authMiddleware(tasksWrite(http.HandlerFunc(commentHandlers.DeleteComment))))
+
+	// task link handlers
+	taskLinkRepo := services.NewPgTaskLinkRepository(dbpool.Pool)
+	taskLinkHandlers := api.NewTaskLinkHandler(taskLinkRepo, taskRepo, memberRepo, validator.New())
+	router.Handle("POST /api/tasks/links", authMiddleware(tasksWrite(http.HandlerFunc(taskLinkHandlers.CreateTaskLink))))
+	router.Handle("GET /api/tasks/links", authMiddleware(tasksRead(http.HandlerFunc(taskLinkHandlers.ListTaskLinks))))
+	router.Handle("DELETE /api/tasks/links", authMiddleware(tasksWrite(http.HandlerFunc(taskLinkHandlers.DeleteTaskLink))))
+	router.Handle("GET /api/project/dependencies", authMiddleware(tasksRead(http.HandlerFunc(taskLinkHandlers.GetDependencyGraph))))
+
+	// worklog handlers
+	worklogRepo := services.NewPgWorklogRepository(dbpool.Pool)
+	worklogHandlers := api.NewWorklogHandler(worklogRepo, taskRepo, memberRepo, validator.New())
+	router.Handle("POST /api/tasks/worklogs", authMiddleware(tasksWrite(http.HandlerFunc(worklogHandlers.CreateWorklog))))
+	router.Handle("GET /api/tasks/worklogs", authMiddleware(tasksRead(http.HandlerFunc(worklogHandlers.ListWorklogs))))
+	router.Handle("PUT /api/tasks/worklogs", authMiddleware(tasksWrite(http.HandlerFunc(worklogHandlers.UpdateWorklog))))
+	router.Handle("DELETE /api/tasks/worklogs", authMiddleware(tasksWrite(http.HandlerFunc(worklogHandlers.DeleteWorklog))))
+	router.Handle("GET /api/timesheets/user", authMiddleware(tasksRead(http.HandlerFunc(worklogHandlers.GetUserTimesheet))))
+	router.Handle("GET /api/timesheets/project", authMiddleware(tasksRead(http.HandlerFunc(worklogHandlers.GetProjectTimesheet))))
+
+	// activity handlers
+	activityRepo := services.NewPgActivityRepository(dbpool.Pool)
+	activityHandlers := api.NewActivityHandler(activityRepo, memberRepo)
+	router.Handle("GET /api/tasks/history", authMiddleware(tasksRead(http.HandlerFunc(activityHandlers.GetTaskHistory))))
+	router.Handle("GET /api/project/history", authMiddleware(projectsRead(http.HandlerFunc(activityHandlers.GetProjectHistory))))
+	router.Handle("GET /api/project/activity", authMiddleware(projectsRead(http.HandlerFunc(activityHandlers.GetProjectFeed))))
+
+	// personal access token handlers
+	tokenHandlers := api.NewTokenHandler(tokenRepo, auditRepo, validator.New())
+	router.Handle("POST /api/tokens", sessionAuth(http.HandlerFunc(tokenHandlers.CreateToken)))
+	router.Handle("GET /api/tokens", sessionAuth(http.HandlerFunc(tokenHandlers.ListTokens)))
+	router.Handle("DELETE /api/tokens", sessionAuth(http.HandlerFunc(tokenHandlers.RevokeToken)))
 
 	// authenticated user
-	router.Handle("GET /api/auth/me", middleware.AuthMiddleware(http.HandlerFunc(userHandlers.GetMe)))
+	router.Handle("GET /api/auth/me", sessionAuth(http.HandlerFunc(userHandlers.GetMe)))
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://127.0.0.1:5173", "http://localhost:5173"}, // Include both formats
 		AllowCredentials: true,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "X-Requested-With"},
-		ExposedHeaders:   []string{"Set-Cookie"}, // Important for cookie operations
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "X-Requested-With", "X-Request-ID"},
+		ExposedHeaders:   []string{"Set-Cookie", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-ID"}, // Important for cookie operations
 	})
 
-	handler := c.Handler(router)
+	handler := c.Handler(middleware.RequestID(router))
 
 	fmt.Print("server is running now...")
 	if err := http.ListenAndServe(port, handler); err != nil {
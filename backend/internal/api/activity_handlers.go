@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type ActivityHandler struct {
+	activityRepo services.ActivityRepository
+	access       projectAccess
+}
+
+func NewActivityHandler(activityRepo services.ActivityRepository, memberRepo services.ProjectMemberRepository) *ActivityHandler {
+	return &ActivityHandler{
+		activityRepo: activityRepo,
+		access:       projectAccess{memberRepo: memberRepo},
+	}
+}
+
+// GetTaskHistory lists the changes made to a task, newest first. The history
+// outlives the task, so it stays readable after the task is deleted.
+func (h *ActivityHandler) GetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	h.entityHistory(w, r, models.ActivityEntityTask, "Invalid task ID format", "Failed to get task history")
+}
+
+// GetProjectHistory lists the changes made to a project's own fields, newest
+// first.
+func (h *ActivityHandler) GetProjectHistory(w http.ResponseWriter, r *http.Request) {
+	h.entityHistory(w, r, models.ActivityEntityProject, "Invalid project ID format", "Failed to get project history")
+}
+
+func (h *ActivityHandler) entityHistory(w http.ResponseWriter, r *http.Request, entityType, invalidIDMessage, failureMessage string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entityID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, invalidIDMessage, http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	activities, err := h.activityRepo.ListByEntity(ctx, entityType, entityID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, failureMessage+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// every entry of an entity belongs to the same project, so checking the
+	// first one is enough
+	if len(activities) > 0 {
+		if _, err := h.access.require(ctx, activities[0].ProjectID, userID, models.ProjectRoleViewer); err != nil {
+			respondWithAccessError(w, failureMessage, err)
+			return
+		}
+	}
+
+	utils.RespondWithJSON(w, activities, http.StatusOK)
+}
+
+// GetProjectFeed lists the activity of a project and all of its tasks, newest
+// first.
+func (h *ActivityHandler) GetProjectFeed(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get project activity", err)
+		return
+	}
+
+	activities, err := h.activityRepo.ListByProject(ctx, projectID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get project activity: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, activities, http.StatusOK)
+}
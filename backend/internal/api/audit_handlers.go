@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// maxAuditValue caps the user agent, target and metadata values stored with
+// an audit log entry, maxAuditIP the IP, the width of its column.
+const (
+	maxAuditValue = 512
+	maxAuditIP    = 64
+)
+
+// auditLogger writes security-sensitive events to the audit log, together
+// with where the request came from.
+type auditLogger struct {
+	repo services.AuditLogRepository
+}
+
+// record appends the event to the audit log. The actor defaults to the
+// authenticated user. A failed write is logged rather than failing the
+// request, so the audit log going down doesn't lock everyone out.
+func (a auditLogger) record(r *http.Request, entry *models.AuditLog) {
+	if entry.ActorID == nil {
+		if userID, ok := r.Context().Value("user_id").(uuid.UUID); ok {
+			entry.ActorID = &userID
+		}
+	}
+	// anything the client sent could make the insert fail, and with it hide
+	// the event, so it is cleaned up first
+	entry.IP = auditValue(utils.ClientIP(r), maxAuditIP)
+	entry.UserAgent = auditValue(r.UserAgent(), maxAuditValue)
+	entry.TargetID = auditValue(entry.TargetID, maxAuditValue)
+	for key, value := range entry.Metadata {
+		entry.Metadata[key] = auditValue(value, maxAuditValue)
+	}
+	entry.RequestID, _ = r.Context().Value("request_id").(string)
+
+	// the entry is written even when the client has already gone away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+	if err := a.repo.Append(ctx, entry); err != nil {
+		log.Printf("failed to write audit log entry %s: %v", entry.EventType, err)
+	}
+}
+
+// auditValue makes a request derived string storable: valid UTF-8 without
+// NUL bytes, which Postgres rejects, and at most maxBytes long, cut on a
+// character boundary.
+func auditValue(value string, maxBytes int) string {
+	value = strings.ReplaceAll(strings.ToValidUTF8(value, "\uFFFD"), "\x00", "")
+	if len(value) <= maxBytes {
+		return value
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
+
+type AuditHandler struct {
+	auditRepo services.AuditLogRepository
+}
+
+func NewAuditHandler(auditRepo services.AuditLogRepository) *AuditHandler {
+	return &AuditHandler{auditRepo: auditRepo}
+}
+
+// ListAuditLogs lists the audit log, newest first. It can be filtered by
+// event_type, outcome, actor_id, target_id, ip, request_id and a from/to
+// time range in RFC 3339.
+func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.AuditLogFilter{
+		EventType: query.Get("event_type"),
+		Outcome:   query.Get("outcome"),
+		TargetID:  query.Get("target_id"),
+		IP:        query.Get("ip"),
+		RequestID: query.Get("request_id"),
+	}
+	if actorID := query.Get("actor_id"); actorID != "" {
+		id, err := uuid.Parse(actorID)
+		if err != nil {
+			utils.RespondWithError(w, "Invalid actor ID format", http.StatusBadRequest)
+			return
+		}
+		filter.ActorID = &id
+	}
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.RespondWithError(w, "Invalid "+name+" time, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+		*target = &t
+	}
+
+	entries, err := h.auditRepo.List(ctx, filter, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, entries, http.StatusOK)
+}
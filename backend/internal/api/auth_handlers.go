@@ -3,11 +3,14 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/sajidcodesdotcom/kira/internal/auth"
 	"github.com/sajidcodesdotcom/kira/internal/models"
 	"github.com/sajidcodesdotcom/kira/internal/services"
@@ -15,20 +18,39 @@ import (
 )
 
 type AuthHandler struct {
-	userRepo services.UserRepository
-	validate *validator.Validate
+	userRepo      services.UserRepository
+	sessionRepo   services.SessionRepository
+	twoFactorRepo services.TwoFactorRepository
+	throttle      loginThrottle
+	audit         auditLogger
+	verification  *EmailVerificationHandler
+	validate      *validator.Validate
 }
 
-func NewAuthHandler(userRepo services.UserRepository, validate *validator.Validate) *AuthHandler {
+func NewAuthHandler(userRepo services.UserRepository, sessionRepo services.SessionRepository, twoFactorRepo services.TwoFactorRepository, throttleRepo services.LoginThrottleRepository, auditRepo services.AuditLogRepository, verification *EmailVerificationHandler, validate *validator.Validate) *AuthHandler {
 	return &AuthHandler{
-		userRepo: userRepo,
-		validate: validate,
+		userRepo:      userRepo,
+		sessionRepo:   sessionRepo,
+		twoFactorRepo: twoFactorRepo,
+		throttle: loginThrottle{
+			repo:    throttleRepo,
+			account: auth.AccountLockoutPolicyFromEnv(),
+			ip:      auth.IPLockoutPolicyFromEnv(),
+		},
+		audit:        auditLogger{repo: auditRepo},
+		verification: verification,
+		validate:     validate,
 	}
 }
 
+// twoFactorChallengeTTL is how long the user has to enter their code after
+// the password step of a two-factor login.
+const twoFactorChallengeTTL = 5 * time.Minute
+
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	User         *models.User `json:"user"`
 }
 
 type LoginRequest struct {
@@ -36,6 +58,17 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code"`
+}
+
 type RegisterRequest struct {
 	FullName  string `json:"full_name" validate:"required,min=2,max=100"`
 	Email     string `json:"email" validate:"required,email"`
@@ -69,36 +102,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := models.NewUser(uuid.New(), userData.FullName, userData.Email, hashedPassword, userData.Username, "user", userData.AvatarURL)
-
-	token, err := auth.GenerateToken(user)
+	user := models.NewUser(uuid.New(), userData.FullName, userData.Email, hashedPassword, userData.Username, models.RoleUser, userData.AvatarURL)
 
 	if err := h.userRepo.Create(r.Context(), user); err != nil {
 		utils.RespondWithError(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// registration never waits on the mail server
+	h.verification.sendVerificationEmailInBackground(user)
+
+	response, err := h.startSession(w, r, user)
 	if err != nil {
 		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	response := AuthResponse{
-		Token: token,
-		User: &models.User{
-			ID:        user.ID,
-			FullName:  user.FullName,
-			Email:     user.Email,
-			Username:  user.Username,
-			Role:      user.Role,
-			AvatarURL: user.AvatarURL,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		},
-	}
-
-	auth.SetTokenCookie(w, token)
-
 	utils.RespondWithJSON(w, response, http.StatusCreated)
 }
 
@@ -121,45 +140,433 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := utils.ClientIP(r)
+	retryAfter, err := h.throttle.retryAfter(r.Context(), userData.Email, ip)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		h.audit.record(r, loginFailedEvent(nil, userData.Email, "locked_out"))
+		respondWithTooManyAttempts(w, retryAfter)
+		return
+	}
+
+	// unknown emails and wrong passwords get the same answer, in about the
+	// same time, so the response doesn't tell which accounts exist
 	user, err := h.userRepo.GetByEmail(r.Context(), userData.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		utils.RespondWithError(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	passwordHash := dummyPasswordHash()
+	var userID *uuid.UUID
+	if user != nil {
+		passwordHash = user.Password
+		userID = &user.ID
+	}
+	passwordMatches := utils.CheckPassword(passwordHash, userData.Password)
+	if user == nil || !passwordMatches {
+		h.audit.record(r, loginFailedEvent(userID, userData.Email, "invalid_credentials"))
+		if err := h.throttle.recordFailure(r.Context(), userData.Email, ip); err != nil {
+			utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.RespondWithError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	// the account's failures are only cleared once the whole login succeeded,
+	// so a second factor can't be guessed with fresh challenges
+	twoFactorEnabled, err := h.twoFactorRepo.IsEnabled(r.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if twoFactorEnabled {
+		challengeToken, err := h.startTwoFactorChallenge(r.Context(), user.ID)
+		if err != nil {
+			utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.RespondWithJSON(w, TwoFactorChallengeResponse{TwoFactorRequired: true, ChallengeToken: challengeToken}, http.StatusOK)
+		return
+	}
+
+	if err := h.throttle.recordSuccess(r.Context(), userData.Email); err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response, err := h.startSession(w, r, user)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit.record(r, loginSucceededEvent(user.ID, "password"))
+
+	utils.RespondWithJSON(w, response, http.StatusCreated)
+}
+
+// LoginTwoFactor is the second step of a login for accounts with two-factor
+// enabled. It takes the challenge token returned by Login and a TOTP or
+// recovery code.
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request LoginTwoFactorRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		errorString := utils.GetValidationErrors(err)
+		utils.RespondWithError(w, "incorrect user Data: "+errorString, http.StatusBadRequest)
+		return
+	}
+
+	challengeID, userID, err := h.twoFactorRepo.AttemptChallenge(r.Context(), auth.HashOpaqueToken(request.ChallengeToken))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorChallenge) {
+			utils.RespondWithError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
 	if err != nil {
-		utils.RespondWithError(w, "Failed to find user in the DB: "+err.Error(), http.StatusUnauthorized)
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	isUserExist := utils.CheckPassword(user.Password, userData.Password)
-	if !isUserExist {
-		utils.RespondWithError(w, "Incorrect Password: ", http.StatusUnauthorized)
+	// wrong codes count against the account like wrong passwords, across
+	// every challenge the password got
+	ip := utils.ClientIP(r)
+	retryAfter, err := h.throttle.retryAfter(r.Context(), user.Email, ip)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		h.audit.record(r, loginFailedEvent(&userID, user.Email, "locked_out"))
+		respondWithTooManyAttempts(w, retryAfter)
 		return
 	}
 
-	token, err := auth.GenerateToken(user)
+	ok, err := checkSecondFactor(r.Context(), h.twoFactorRepo, userID, request.Code, request.RecoveryCode)
 	if err != nil {
 		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !ok {
+		h.audit.record(r, loginFailedEvent(&userID, user.Email, "invalid_two_factor_code"))
+		if err := h.throttle.recordFailure(r.Context(), user.Email, ip); err != nil {
+			utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.RespondWithError(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.twoFactorRepo.CompleteChallenge(r.Context(), challengeID); err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := h.throttle.recordSuccess(r.Context(), user.Email); err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := h.startSession(w, r, user)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	method := "password+totp"
+	if request.RecoveryCode != "" {
+		method = "password+recovery_code"
+	}
+	h.audit.record(r, loginSucceededEvent(user.ID, method))
+
+	utils.RespondWithJSON(w, response, http.StatusCreated)
+}
+
+// startTwoFactorChallenge returns the token of a new challenge the user has
+// to answer through LoginTwoFactor to finish logging in.
+func (h *AuthHandler) startTwoFactorChallenge(ctx context.Context, userID uuid.UUID) (string, error) {
+	challengeToken, challengeTokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := h.twoFactorRepo.CreateChallenge(ctx, userID, challengeTokenHash, time.Now().Add(twoFactorChallengeTTL)); err != nil {
+		return "", err
+	}
+	return challengeToken, nil
+}
+
+// startSession creates a new session for the user, sets the access and
+// refresh token cookies and returns the response for a successful login.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.User) (*AuthResponse, error) {
+	refreshToken, refreshTokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.NewSession(uuid.New(), user.ID, r.UserAgent(), utils.ClientIP(r))
+	if err := h.sessionRepo.Create(r.Context(), session, refreshTokenHash, time.Now().Add(auth.RefreshTokenTTL())); err != nil {
+		return nil, err
+	}
+
+	return h.respondWithTokens(w, user, session.ID, refreshToken)
+}
+
+func (h *AuthHandler) respondWithTokens(w http.ResponseWriter, user *models.User, sessionID uuid.UUID, refreshToken string) (*AuthResponse, error) {
+	token, err := auth.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
 
 	auth.SetTokenCookie(w, token)
+	auth.SetRefreshTokenCookie(w, refreshToken)
 
-	response := AuthResponse{
-		Token: token,
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
 		User: &models.User{
-			ID:        user.ID,
-			FullName:  user.FullName,
-			Email:     user.Email,
-			Username:  user.Username,
-			Role:      user.Role,
-			AvatarURL: user.AvatarURL,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:              user.ID,
+			FullName:        user.FullName,
+			Email:           user.Email,
+			Username:        user.Username,
+			Role:            user.Role,
+			AvatarURL:       user.AvatarURL,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
 		},
+	}, nil
+}
+
+// refreshTokenFromRequest reads the refresh token from its cookie, or from
+// the JSON body for clients that don't keep cookies.
+func refreshTokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie("refresh_token"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return ""
 	}
+	return body.RefreshToken
+}
 
-	utils.RespondWithJSON(w, response, http.StatusCreated)
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// Reusing an already exchanged refresh token revokes the whole session.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	refreshToken := refreshTokenFromRequest(r)
+	if refreshToken == "" {
+		utils.RespondWithError(w, "Refresh token not provided", http.StatusUnauthorized)
+		return
+	}
+
+	newRefreshToken, newRefreshTokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err := h.sessionRepo.Rotate(r.Context(), auth.HashOpaqueToken(refreshToken), newRefreshTokenHash, time.Now().Add(auth.RefreshTokenTTL()))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			auth.ClearTokenCookie(w)
+			utils.RespondWithError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		utils.RespondWithError(w, "Failed to refresh token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), session.UserID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := h.respondWithTokens(w, user, session.ID, newRefreshToken)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, response, http.StatusOK)
 }
 
+// Logout revokes the session of the presented refresh or access token, so
+// neither can be used again, and clears the cookies.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	sessionID := uuid.Nil
+	var userID *uuid.UUID
+	if refreshToken := refreshTokenFromRequest(r); refreshToken != "" {
+		if session, err := h.sessionRepo.GetByRefreshToken(r.Context(), auth.HashOpaqueToken(refreshToken)); err == nil {
+			sessionID = session.ID
+			userID = &session.UserID
+		}
+	}
+	if sessionID == uuid.Nil {
+		if token, err := auth.ExtractTokenFromRequest(r); err == nil {
+			if claims, err := auth.ValidateToken(token); err == nil {
+				sessionID = claims.SessionID
+				userID = &claims.UserID
+			}
+		}
+	}
+
+	if sessionID != uuid.Nil {
+		if err := h.sessionRepo.Revoke(r.Context(), sessionID); err != nil {
+			utils.RespondWithError(w, "Failed to log out: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.audit.record(r, &models.AuditLog{
+			EventType: models.AuditLogout,
+			Outcome:   models.AuditOutcomeSuccess,
+			ActorID:   userID,
+			Metadata:  map[string]string{"session_id": sessionID.String()},
+		})
+	}
+
 	auth.ClearTokenCookie(w)
 
 	utils.RespondWithJSON(w, "successfully logged out", http.StatusOK)
 }
+
+// LogoutAll revokes every session of the authenticated user, logging them out
+// on all devices.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	if err := h.sessionRepo.RevokeAllForUser(r.Context(), userID); err != nil {
+		utils.RespondWithError(w, "Failed to log out of all devices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit.record(r, &models.AuditLog{EventType: models.AuditLogoutAll, Outcome: models.AuditOutcomeSuccess})
+
+	auth.ClearTokenCookie(w)
+
+	utils.RespondWithJSON(w, "successfully logged out of all devices", http.StatusOK)
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can verify Kira tokens without sharing a secret.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := auth.CurrentJWKS()
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get signing keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.RespondWithJSON(w, keys, http.StatusOK)
+}
+
+type UnlockLoginRequest struct {
+	UserID *uuid.UUID `json:"user_id" validate:"required_without=IP"`
+	IP     string     `json:"ip" validate:"required_without=UserID,omitempty,ip"`
+}
+
+// UnlockLogin lifts the login lockout of a user's account or of an IP, for
+// admins helping someone who locked themselves out.
+func (h *AuthHandler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request UnlockLoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		errorString := utils.GetValidationErrors(err)
+		utils.RespondWithError(w, errorString, http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	event := &models.AuditLog{EventType: models.AuditLoginUnlocked, Outcome: models.AuditOutcomeSuccess, Metadata: map[string]string{}}
+	if request.UserID != nil {
+		user, err := h.userRepo.GetByID(r.Context(), *request.UserID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				utils.RespondWithError(w, "User not found", http.StatusNotFound)
+				return
+			}
+			utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, accountThrottleKey(user.Email))
+		event.TargetType = models.AuditTargetUser
+		event.TargetID = user.ID.String()
+	}
+	if request.IP != "" {
+		keys = append(keys, ipThrottleKey(request.IP))
+		event.Metadata["unlocked_ip"] = request.IP
+	}
+
+	if err := h.throttle.repo.Reset(r.Context(), keys...); err != nil {
+		utils.RespondWithError(w, "Failed to unlock login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit.record(r, event)
+
+	utils.RespondWithJSON(w, "Login unlocked successfully", http.StatusOK)
+}
+
+func loginSucceededEvent(userID uuid.UUID, method string) *models.AuditLog {
+	return &models.AuditLog{
+		EventType:  models.AuditLoginSucceeded,
+		Outcome:    models.AuditOutcomeSuccess,
+		ActorID:    &userID,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID.String(),
+		Metadata:   map[string]string{"method": method},
+	}
+}
+
+// loginFailedEvent describes a failed login. userID is nil when the email
+// doesn't belong to an account, the email is kept to spot credential stuffing.
+func loginFailedEvent(userID *uuid.UUID, email, reason string) *models.AuditLog {
+	event := &models.AuditLog{
+		EventType: models.AuditLoginFailed,
+		Outcome:   models.AuditOutcomeFailure,
+		ActorID:   userID,
+		Metadata:  map[string]string{"reason": reason},
+	}
+	if userID != nil {
+		event.TargetType = models.AuditTargetUser
+		event.TargetID = userID.String()
+	}
+	if email != "" {
+		event.Metadata["email"] = strings.ToLower(email)
+	}
+	return event
+}
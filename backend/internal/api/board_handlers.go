@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type BoardColumn struct {
+	Status   string         `json:"status"`
+	Name     string         `json:"name"`
+	Category string         `json:"category,omitempty"`
+	Tasks    []*models.Task `json:"tasks"`
+}
+
+type Board struct {
+	ProjectID uuid.UUID     `json:"project_id"`
+	Columns   []BoardColumn `json:"columns"`
+}
+
+type MoveTaskData struct {
+	TaskID   uuid.UUID `json:"task_id" validate:"required"`
+	Status   string    `json:"status" validate:"required,max=50"`
+	Position int       `json:"position" validate:"min=0"`
+}
+
+// buildBoard groups tasks that are already ordered by rank into the board
+// columns. Every status of the workflow has a column, even when empty.
+// Statuses outside the workflow get a column without category.
+func buildBoard(workflow *models.Workflow, tasks []*models.Task) Board {
+	board := Board{ProjectID: workflow.ProjectID}
+	index := make(map[string]int)
+	for _, status := range workflow.Statuses {
+		index[status.Key] = len(board.Columns)
+		board.Columns = append(board.Columns, BoardColumn{Status: status.Key, Name: status.Name, Category: status.Category, Tasks: []*models.Task{}})
+	}
+
+	for _, task := range tasks {
+		i, ok := index[task.Status]
+		if !ok {
+			i = len(board.Columns)
+			index[task.Status] = i
+			board.Columns = append(board.Columns, BoardColumn{Status: task.Status, Name: task.Status, Tasks: []*models.Task{}})
+		}
+		board.Columns[i].Tasks = append(board.Columns[i].Tasks, task)
+	}
+	return board
+}
+
+func (h *TaskHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get board", err)
+		return
+	}
+
+	workflow, err := h.workflowRepo.Get(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get board: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tasks, err := h.taskRepo.ListBoard(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get board: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, buildBoard(workflow, tasks), http.StatusOK)
+}
+
+// MoveTask moves a task to a position within the same or another board
+// column. Positions past the end of the column place the task last. Moving
+// to another column has to be allowed by the project's workflow.
+func (h *TaskHandler) MoveTask(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var moveData MoveTaskData
+	if err := json.NewDecoder(r.Body).Decode(&moveData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(moveData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, moveData.TaskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to move task", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to move task", err)
+		return
+	}
+
+	task, err = h.taskRepo.Move(ctx, moveData.TaskID, moveData.Status, moveData.Position, userID)
+	if err != nil {
+		respondWithTaskError(w, "Failed to move task", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, task, http.StatusOK)
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sajidcodesdotcom/kira/internal/mailer"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// maxMentions caps how many users a single comment can notify.
+const maxMentions = 20
+
+type CommentHandler struct {
+	commentRepo services.CommentRepository
+	taskRepo    services.TaskRepository
+	userRepo    services.UserRepository
+	access      projectAccess
+	mailer      mailer.Mailer
+	validate    *validator.Validate
+}
+
+func NewCommentHandler(commentRepo services.CommentRepository, taskRepo services.TaskRepository, userRepo services.UserRepository, memberRepo services.ProjectMemberRepository, mailer mailer.Mailer, validate *validator.Validate) *CommentHandler {
+	return &CommentHandler{
+		commentRepo: commentRepo,
+		taskRepo:    taskRepo,
+		userRepo:    userRepo,
+		access:      projectAccess{memberRepo: memberRepo},
+		mailer:      mailer,
+		validate:    validate,
+	}
+}
+
+type CommentData struct {
+	TaskID   uuid.UUID  `json:"task_id" validate:"required"`
+	ParentID *uuid.UUID `json:"parent_id"`
+	Body     string     `json:"body" validate:"required,max=10000"`
+}
+
+type UpdateCommentData struct {
+	ID   uuid.UUID `json:"id" validate:"required"`
+	Body string    `json:"body" validate:"required,max=10000"`
+}
+
+var (
+	codeBlockPattern    = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+	mentionPattern      = regexp.MustCompile(`(?:^|[^\w.@/-])@([A-Za-z0-9][A-Za-z0-9._-]{2,99})`)
+	errNotCommentAuthor = errors.New("you can only change your own comments")
+)
+
+// parseMentions returns the distinct usernames mentioned with @username in a
+// Markdown body. Mentions inside code spans and code blocks don't count.
+func parseMentions(body string) []string {
+	body = codeBlockPattern.ReplaceAllString(body, " ")
+
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// a mention at the end of a sentence keeps its punctuation out
+		username := strings.TrimRight(match[1], ".-")
+		if len(username) < 3 || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+	return usernames
+}
+
+// resolveMentions looks up the mentioned users. Unknown usernames, the author
+// and users who can't see the project are skipped, so a mention never shows
+// a task to someone outside it.
+func (h *CommentHandler) resolveMentions(ctx context.Context, projectID, authorID uuid.UUID, body string) ([]*models.User, error) {
+	var users []*models.User
+	for _, username := range parseMentions(body) {
+		user, err := h.userRepo.GetByUsername(ctx, username)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.ID == authorID {
+			continue
+		}
+		_, err = h.access.require(ctx, projectID, user.ID, models.ProjectRoleViewer)
+		if errors.Is(err, errProjectAccessDenied) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// notifyMentions emails the mentioned users in the background, a failed email
+// must not fail the comment.
+func (h *CommentHandler) notifyMentions(task *models.Task, comment *models.Comment, author string, users []*models.User) {
+	if len(users) == 0 {
+		return
+	}
+	link := appURL() + "/tasks/" + task.ID.String() + "#comment-" + comment.ID.String()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		for _, user := range users {
+			err := h.mailer.Send(ctx, mailer.Message{
+				To:      user.Email,
+				Subject: fmt.Sprintf("%s mentioned you on %q", author, task.Title),
+				Body: fmt.Sprintf("Hi %s,\n\n%s mentioned you in a comment on %q:\n\n%s\n\nReply here: %s\n",
+					user.FullName, author, task.Title, comment.Body, link),
+			})
+			if err != nil {
+				log.Printf("failed to send mention email to user %s: %v", user.ID, err)
+			}
+		}
+	}()
+}
+
+func userIDs(users []*models.User) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var commentData CommentData
+	if err := json.NewDecoder(r.Body).Decode(&commentData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(commentData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	username, _ := r.Context().Value("username").(string)
+
+	task, err := h.taskRepo.GetByID(ctx, commentData.TaskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to create comment", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to create comment", err)
+		return
+	}
+
+	if commentData.ParentID != nil {
+		parent, err := h.commentRepo.GetByID(ctx, *commentData.ParentID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil || parent.TaskID != task.ID {
+			utils.RespondWithError(w, "Parent comment must belong to the same task", http.StatusBadRequest)
+			return
+		}
+	}
+
+	mentioned, err := h.resolveMentions(ctx, task.ProjectID, userID, commentData.Body)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to resolve mentions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment := models.NewComment(uuid.New(), task.ID, userID, commentData.ParentID, commentData.Body)
+	comment.AuthorUsername = username
+	comment.Mentions = userIDs(mentioned)
+	if err := h.commentRepo.Create(ctx, comment); err != nil {
+		utils.RespondWithError(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.notifyMentions(task, comment, username, mentioned)
+
+	utils.RespondWithJSON(w, comment, http.StatusCreated)
+}
+
+// ListComments returns the comments of a task as threads: top level comments
+// oldest first, each with its replies nested under it.
+func (h *CommentHandler) ListComments(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	taskID, err := uuid.Parse(r.URL.Query().Get("task_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid task ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to list comments", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list comments", err)
+		return
+	}
+
+	comments, err := h.commentRepo.ListByTask(ctx, taskID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list comments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, buildThreads(comments), http.StatusOK)
+}
+
+// buildThreads nests the replies under the comments they answer. The
+// comments must be ordered oldest first, which puts parents before replies.
+func buildThreads(comments []*models.Comment) []*models.Comment {
+	byID := make(map[uuid.UUID]*models.Comment, len(comments))
+	threads := []*models.Comment{}
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+		if comment.ParentID == nil {
+			threads = append(threads, comment)
+			continue
+		}
+		parent, ok := byID[*comment.ParentID]
+		if !ok {
+			threads = append(threads, comment)
+			continue
+		}
+		parent.Replies = append(parent.Replies, comment)
+	}
+	return threads
+}
+
+// getOwnComment loads a comment and makes sure the caller wrote it and can
+// still work on its project.
+func (h *CommentHandler) getOwnComment(ctx context.Context, commentID, userID uuid.UUID) (*models.Comment, *models.Task, error) {
+	comment, err := h.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if comment.DeletedAt != nil {
+		return nil, nil, fmt.Errorf("comment was deleted: %w", pgx.ErrNoRows)
+	}
+	if comment.AuthorID != userID {
+		return nil, nil, errNotCommentAuthor
+	}
+	task, err := h.taskRepo.GetByID(ctx, comment.TaskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		return nil, nil, err
+	}
+	return comment, task, nil
+}
+
+func respondWithCommentError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, errNotCommentAuthor) {
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusForbidden)
+		return
+	}
+	respondWithAccessError(w, message, err)
+}
+
+// UpdateComment edits the caller's own comment. Only users mentioned for the
+// first time are notified.
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var commentData UpdateCommentData
+	if err := json.NewDecoder(r.Body).Decode(&commentData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(commentData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	comment, task, err := h.getOwnComment(ctx, commentData.ID, userID)
+	if err != nil {
+		respondWithCommentError(w, "Failed to update comment", err)
+		return
+	}
+
+	mentioned, err := h.resolveMentions(ctx, task.ProjectID, userID, commentData.Body)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to resolve mentions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	alreadyMentioned := make(map[uuid.UUID]bool)
+	for _, id := range comment.Mentions {
+		alreadyMentioned[id] = true
+	}
+	var newlyMentioned []*models.User
+	for _, user := range mentioned {
+		if !alreadyMentioned[user.ID] {
+			newlyMentioned = append(newlyMentioned, user)
+		}
+	}
+
+	comment.Body = commentData.Body
+	comment.Mentions = userIDs(mentioned)
+	comment.UpdatedAt = time.Now()
+	if err := h.commentRepo.Update(ctx, comment); err != nil {
+		respondWithAccessError(w, "Failed to update comment", err)
+		return
+	}
+
+	h.notifyMentions(task, comment, comment.AuthorUsername, newlyMentioned)
+
+	utils.RespondWithJSON(w, comment, http.StatusOK)
+}
+
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	commentID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid comment ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, _, err := h.getOwnComment(ctx, commentID, userID); err != nil {
+		respondWithCommentError(w, "Failed to delete comment", err)
+		return
+	}
+
+	if err := h.commentRepo.Delete(ctx, commentID); err != nil {
+		utils.RespondWithError(w, "Failed to delete comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Comment deleted successfully", http.StatusOK)
+}
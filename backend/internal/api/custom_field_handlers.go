@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type CustomFieldHandler struct {
+	fieldRepo services.CustomFieldRepository
+	access    projectAccess
+	validate  *validator.Validate
+}
+
+func NewCustomFieldHandler(fieldRepo services.CustomFieldRepository, memberRepo services.ProjectMemberRepository, validate *validator.Validate) *CustomFieldHandler {
+	return &CustomFieldHandler{
+		fieldRepo: fieldRepo,
+		access:    projectAccess{memberRepo: memberRepo},
+		validate:  validate,
+	}
+}
+
+// CustomFieldData defines a custom field. Select fields need options, the
+// other types take none.
+type CustomFieldData struct {
+	ProjectID uuid.UUID `json:"project_id" validate:"required"`
+	Name      string    `json:"name" validate:"required,min=1,max=100"`
+	Type      string    `json:"type" validate:"required,oneof=text number date single_select multi_select user"`
+	Options   []string  `json:"options" validate:"max=100,unique,dive,required,max=100"`
+}
+
+type UpdateCustomFieldData struct {
+	ID      uuid.UUID `json:"id" validate:"required"`
+	Name    string    `json:"name" validate:"required,min=1,max=100"`
+	Options []string  `json:"options" validate:"max=100,unique,dive,required,max=100"`
+}
+
+// customValueTags are the validator tags a custom field value has to pass,
+// by field type.
+var customValueTags = map[string]string{
+	models.CustomFieldText:         "max=1000",
+	models.CustomFieldNumber:       "min=-1000000000000,max=1000000000000",
+	models.CustomFieldDate:         "datetime=2006-01-02",
+	models.CustomFieldSingleSelect: "required",
+	models.CustomFieldMultiSelect:  "max=100,unique,dive,required",
+	models.CustomFieldUser:         "required",
+}
+
+var (
+	errInvalidCustomValue = errors.New("invalid custom field value")
+	errCustomFieldOptions = errors.New("options are required for select fields and not allowed for other types")
+)
+
+func respondWithCustomFieldError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, services.ErrCustomFieldExists) {
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+		return
+	}
+	respondWithAccessError(w, message, err)
+}
+
+// customValue decodes a task's value for the field and checks it against
+// the field's definition. User fields only take members of the project.
+func customValue(ctx context.Context, validate *validator.Validate, access projectAccess, field *models.CustomField, raw json.RawMessage) (any, error) {
+	var value any
+	var err error
+	switch field.Type {
+	case models.CustomFieldText, models.CustomFieldDate, models.CustomFieldSingleSelect:
+		var s string
+		err = json.Unmarshal(raw, &s)
+		value = s
+	case models.CustomFieldNumber:
+		var n float64
+		err = json.Unmarshal(raw, &n)
+		value = n
+	case models.CustomFieldMultiSelect:
+		var options []string
+		err = json.Unmarshal(raw, &options)
+		slices.Sort(options)
+		value = options
+	case models.CustomFieldUser:
+		var userID uuid.UUID
+		err = json.Unmarshal(raw, &userID)
+		value = userID
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be a %s value", errInvalidCustomValue, field.Name, field.Type)
+	}
+	if err := validate.Var(value, customValueTags[field.Type]); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", errInvalidCustomValue, field.Name, strings.TrimSpace(utils.GetValidationErrors(err)))
+	}
+
+	switch v := value.(type) {
+	case string:
+		if field.Type == models.CustomFieldSingleSelect && !slices.Contains(field.Options, v) {
+			return nil, fmt.Errorf("%w: %q is not an option of %s", errInvalidCustomValue, v, field.Name)
+		}
+	case []string:
+		for _, option := range v {
+			if !slices.Contains(field.Options, option) {
+				return nil, fmt.Errorf("%w: %q is not an option of %s", errInvalidCustomValue, option, field.Name)
+			}
+		}
+	case uuid.UUID:
+		_, err := access.require(ctx, field.ProjectID, v, models.ProjectRoleViewer)
+		if errors.Is(err, errProjectAccessDenied) {
+			return nil, fmt.Errorf("%w: %s must be a member of the project", errInvalidCustomValue, field.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// applyCustomValues validates the given custom field values and sets them on
+// the task. A null value clears the field, fields left out keep their value.
+func applyCustomValues(ctx context.Context, validate *validator.Validate, access projectAccess, fields []*models.CustomField, task *models.Task, values map[uuid.UUID]json.RawMessage) error {
+	if task.CustomFields == nil {
+		task.CustomFields = map[string]any{}
+	}
+	for fieldID, raw := range values {
+		i := slices.IndexFunc(fields, func(field *models.CustomField) bool { return field.ID == fieldID })
+		if i < 0 {
+			return fmt.Errorf("%w: project has no custom field %s", errInvalidCustomValue, fieldID)
+		}
+		if string(raw) == "null" {
+			delete(task.CustomFields, fieldID.String())
+			continue
+		}
+		value, err := customValue(ctx, validate, access, fields[i], raw)
+		if err != nil {
+			return err
+		}
+		task.CustomFields[fieldID.String()] = value
+	}
+	return nil
+}
+
+// parseCustomValueFilters reads query parameters of the form cf.<field id>
+// into filters on the project's custom fields. Number fields compare as
+// numbers, every other type as text.
+func parseCustomValueFilters(r *http.Request, fields []*models.CustomField) ([]services.CustomValueFilter, error) {
+	var filters []services.CustomValueFilter
+	for _, field := range fields {
+		valueStr := r.URL.Query().Get("cf." + field.ID.String())
+		if valueStr == "" {
+			continue
+		}
+		var value any = valueStr
+		if field.Type == models.CustomFieldNumber {
+			n, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value for custom field %s", field.Name)
+			}
+			value = n
+		}
+		filters = append(filters, services.CustomValueFilter{FieldID: field.ID, Value: value})
+	}
+	return filters, nil
+}
+
+// CreateCustomField adds a custom field to a project. Only project admins
+// can define fields.
+func (h *CustomFieldHandler) CreateCustomField(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var fieldData CustomFieldData
+	if err := json.NewDecoder(r.Body).Decode(&fieldData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(fieldData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if models.CustomFieldHasOptions(fieldData.Type) != (len(fieldData.Options) > 0) {
+		utils.RespondWithError(w, "Validation error: "+errCustomFieldOptions.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.access.require(ctx, fieldData.ProjectID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to create custom field", err)
+		return
+	}
+
+	field := models.NewCustomField(uuid.New(), fieldData.ProjectID, fieldData.Name, fieldData.Type, fieldData.Options)
+	if err := h.fieldRepo.Create(ctx, field); err != nil {
+		respondWithCustomFieldError(w, "Failed to create custom field", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, field, http.StatusCreated)
+}
+
+// ListCustomFields returns the custom fields of the project given by
+// project_id.
+func (h *CustomFieldHandler) ListCustomFields(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list custom fields", err)
+		return
+	}
+
+	fields, err := h.fieldRepo.ListByProject(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list custom fields: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, fields, http.StatusOK)
+}
+
+// UpdateCustomField renames a custom field and replaces its options.
+func (h *CustomFieldHandler) UpdateCustomField(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var fieldData UpdateCustomFieldData
+	if err := json.NewDecoder(r.Body).Decode(&fieldData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(fieldData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	field, err := h.fieldRepo.GetByID(ctx, fieldData.ID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update custom field", err)
+		return
+	}
+	if _, err := h.access.require(ctx, field.ProjectID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to update custom field", err)
+		return
+	}
+	if models.CustomFieldHasOptions(field.Type) != (len(fieldData.Options) > 0) {
+		utils.RespondWithError(w, "Validation error: "+errCustomFieldOptions.Error(), http.StatusBadRequest)
+		return
+	}
+
+	field.Name = fieldData.Name
+	field.Options = fieldData.Options
+	if field.Options == nil {
+		field.Options = []string{}
+	}
+	field.UpdatedAt = time.Now()
+	if err := h.fieldRepo.Update(ctx, field); err != nil {
+		respondWithCustomFieldError(w, "Failed to update custom field", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, field, http.StatusOK)
+}
+
+// DeleteCustomField removes a custom field and its value from every task.
+func (h *CustomFieldHandler) DeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	fieldID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid custom field ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	field, err := h.fieldRepo.GetByID(ctx, fieldID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to delete custom field", err)
+		return
+	}
+	if _, err := h.access.require(ctx, field.ProjectID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to delete custom field", err)
+		return
+	}
+
+	if err := h.fieldRepo.Delete(ctx, fieldID); err != nil {
+		respondWithAccessError(w, "Failed to delete custom field", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Custom field deleted successfully", http.StatusOK)
+}
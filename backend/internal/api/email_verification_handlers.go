@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/mailer"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type EmailVerificationHandler struct {
+	userRepo         services.UserRepository
+	verificationRepo services.EmailVerificationRepository
+	mailer           mailer.Mailer
+	validate         *validator.Validate
+}
+
+func NewEmailVerificationHandler(userRepo services.UserRepository, verificationRepo services.EmailVerificationRepository, mailer mailer.Mailer, validate *validator.Validate) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		userRepo:         userRepo,
+		verificationRepo: verificationRepo,
+		mailer:           mailer,
+		validate:         validate,
+	}
+}
+
+// SendVerificationEmail issues a new verification token for the user and
+// emails them the link.
+func (h *EmailVerificationHandler) SendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := h.verificationRepo.Create(ctx, user.ID, user.Email, tokenHash, time.Now().Add(auth.EmailVerificationTTL())); err != nil {
+		return err
+	}
+
+	link := utils.GetEnvOrDefault("APP_URL", "http://localhost:5173") + "/verify-email?token=" + url.QueryEscape(token)
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Kira email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm that this is your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.FullName, link, auth.EmailVerificationTTL(),
+		),
+	})
+}
+
+// sendVerificationEmailInBackground sends the verification email without
+// holding up the request, with its own timeout. The account is usable without
+// it, the user can ask for a new email later.
+func (h *EmailVerificationHandler) sendVerificationEmailInBackground(user *models.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := h.SendVerificationEmail(ctx, user); err != nil {
+			log.Printf("failed to send verification email to user %s: %v", user.ID, err)
+		}
+	}()
+}
+
+func (h *EmailVerificationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		utils.RespondWithError(w, utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.verificationRepo.Consume(r.Context(), auth.HashOpaqueToken(request.Token))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		utils.RespondWithError(w, "Failed to verify email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Email verified successfully", http.StatusOK)
+}
+
+func (h *EmailVerificationHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		utils.RespondWithError(w, "Email is already verified", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.SendVerificationEmail(r.Context(), user); err != nil {
+		utils.RespondWithError(w, "Failed to send verification email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Verification email sent", http.StatusOK)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type LabelHandler struct {
+	labelRepo services.LabelRepository
+	access    projectAccess
+	validate  *validator.Validate
+}
+
+func NewLabelHandler(labelRepo services.LabelRepository, memberRepo services.ProjectMemberRepository, validate *validator.Validate) *LabelHandler {
+	return &LabelHandler{
+		labelRepo: labelRepo,
+		access:    projectAccess{memberRepo: memberRepo},
+		validate:  validate,
+	}
+}
+
+type LabelData struct {
+	ProjectID uuid.UUID `json:"project_id" validate:"required"`
+	Name      string    `json:"name" validate:"required,min=1,max=50"`
+	Color     string    `json:"color" validate:"required,hexcolor,len=7"`
+}
+
+type UpdateLabelData struct {
+	ID    uuid.UUID `json:"id" validate:"required"`
+	Name  string    `json:"name" validate:"required,min=1,max=50"`
+	Color string    `json:"color" validate:"required,hexcolor,len=7"`
+}
+
+func respondWithLabelError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, services.ErrLabelExists) {
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+		return
+	}
+	respondWithAccessError(w, message, err)
+}
+
+// getLabel loads a label and makes sure the caller has at least minRole in
+// its project.
+func (h *LabelHandler) getLabel(ctx context.Context, labelID, userID uuid.UUID, minRole string) (*models.Label, error) {
+	label, err := h.labelRepo.GetByID(ctx, labelID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.access.require(ctx, label.ProjectID, userID, minRole); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+func (h *LabelHandler) CreateLabel(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var labelData LabelData
+	if err := json.NewDecoder(r.Body).Decode(&labelData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(labelData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, labelData.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to create label", err)
+		return
+	}
+
+	label := models.NewLabel(uuid.New(), labelData.ProjectID, labelData.Name, labelData.Color)
+	if err := h.labelRepo.Create(ctx, label); err != nil {
+		respondWithLabelError(w, "Failed to create label", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, label, http.StatusCreated)
+}
+
+// ListLabels returns the labels of the project given by project_id.
+func (h *LabelHandler) ListLabels(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list labels", err)
+		return
+	}
+
+	labels, err := h.labelRepo.ListByProject(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list labels: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, labels, http.StatusOK)
+}
+
+func (h *LabelHandler) UpdateLabel(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var labelData UpdateLabelData
+	if err := json.NewDecoder(r.Body).Decode(&labelData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(labelData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	label, err := h.getLabel(ctx, labelData.ID, userID, models.ProjectRoleMember)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update label", err)
+		return
+	}
+
+	label.Name = labelData.Name
+	label.Color = labelData.Color
+	label.UpdatedAt = time.Now()
+	if err := h.labelRepo.Update(ctx, label); err != nil {
+		respondWithLabelError(w, "Failed to update label", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, label, http.StatusOK)
+}
+
+// DeleteLabel removes a label from the project and from every task it tags.
+// Only project admins can delete labels.
+func (h *LabelHandler) DeleteLabel(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	labelID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid label ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.getLabel(ctx, labelID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to delete label", err)
+		return
+	}
+
+	if err := h.labelRepo.Delete(ctx, labelID); err != nil {
+		respondWithAccessError(w, "Failed to delete label", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Label deleted successfully", http.StatusOK)
+}
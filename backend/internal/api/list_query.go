@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// parseListQuery reads the query parameters list endpoints share:
+//
+//   - filter.<field>=value, or filter.<field>.<op>=value with op one of eq,
+//     ne, gt, gte, lt, lte and in (a comma separated list). Ranges combine
+//     gte and lte, and nullable fields take null as a value.
+//   - sort=-created_at,name, a comma separated list of fields, descending
+//     when prefixed with a minus.
+//   - q, a text to search for.
+//   - limit and offset.
+//
+// Which fields a list supports is up to its repository.
+func parseListQuery(r *http.Request) (services.ListQuery, error) {
+	var q services.ListQuery
+	var err error
+	if q.Limit, q.Offset, err = parseLimitOffset(r); err != nil {
+		return q, err
+	}
+
+	params := r.URL.Query()
+	// sorted, so the same request always builds the same SQL
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		name, ok := strings.CutPrefix(key, "filter.")
+		if !ok {
+			continue
+		}
+		field, op, hasOp := strings.Cut(name, ".")
+		if !hasOp {
+			op = services.FilterEq
+		}
+		if field == "" {
+			return q, errors.New("Invalid filter parameter " + key)
+		}
+		for _, value := range params[key] {
+			q.Filters = append(q.Filters, services.ListFilter{Field: field, Op: op, Value: value})
+		}
+	}
+
+	if sort := params.Get("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if field == "" {
+				return q, errors.New("Invalid sort value")
+			}
+			q.Sort = append(q.Sort, services.ListSort{Field: field, Desc: desc})
+		}
+	}
+
+	q.Search = params.Get("q")
+	return q, nil
+}
+
+// respondWithListError answers a list query the repository rejected with a
+// bad request.
+func respondWithListError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, services.ErrInvalidListQuery) {
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	utils.RespondWithError(w, message+": "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// loginThrottle slows down and then locks out password guessing, both against
+// one account and from one IP. Accounts are tracked by the email that was
+// typed in, whether or not it belongs to a user, so lockouts don't reveal
+// which emails are registered.
+type loginThrottle struct {
+	repo    services.LoginThrottleRepository
+	account auth.LockoutPolicy
+	ip      auth.LockoutPolicy
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// retryAfter returns how long the caller has to wait before trying to log in
+// to the account again, zero when they may try now.
+func (t loginThrottle) retryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	blockedUntil, err := t.repo.BlockedUntil(ctx, accountThrottleKey(email), ipThrottleKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	return time.Until(blockedUntil), nil
+}
+
+func (t loginThrottle) recordFailure(ctx context.Context, email, ip string) error {
+	if _, err := t.repo.RecordFailure(ctx, accountThrottleKey(email), t.account.FailureWindow, t.account.BlockFor); err != nil {
+		return err
+	}
+	if _, err := t.repo.RecordFailure(ctx, ipThrottleKey(ip), t.ip.FailureWindow, t.ip.BlockFor); err != nil {
+		return err
+	}
+	return nil
+}
+
+// recordSuccess clears the account's failures. The IP's failures are kept,
+// otherwise logging in to an own account would reset a guessing run.
+func (t loginThrottle) recordSuccess(ctx context.Context, email string) error {
+	return t.repo.Reset(ctx, accountThrottleKey(email))
+}
+
+func respondWithTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	utils.RespondWithError(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// dummyPasswordHash is checked against when the email is unknown, so a
+// failed login takes as long whether or not the account exists.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := utils.HashPassword("kira-dummy-password")
+	return hash
+})
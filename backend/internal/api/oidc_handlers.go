@@ -0,0 +1,340 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/oidc"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// oidcLoginTTL is how long the user has to finish logging in at the provider.
+const oidcLoginTTL = 10 * time.Minute
+
+const oidcStateCookie = "oidc_state"
+
+var (
+	errSSOEmailNotAllowed   = errors.New("email domain is not allowed")
+	errSSOEmailUnverified   = errors.New("provider did not verify the email address")
+	errSSONoAccount         = errors.New("no account exists for this email and provisioning is disabled")
+	errSSOAccountUnverified = errors.New("the account with this email has not verified it")
+)
+
+type OIDCHandler struct {
+	auth         *AuthHandler
+	provider     *oidc.Provider
+	userRepo     services.UserRepository
+	identityRepo services.UserIdentityRepository
+	stateRepo    services.OIDCStateRepository
+}
+
+func NewOIDCHandler(authHandler *AuthHandler, provider *oidc.Provider, userRepo services.UserRepository, identityRepo services.UserIdentityRepository, stateRepo services.OIDCStateRepository) *OIDCHandler {
+	return &OIDCHandler{
+		auth:         authHandler,
+		provider:     provider,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		stateRepo:    stateRepo,
+	}
+}
+
+// Login sends the browser to the identity provider. The optional redirect_to
+// query parameter is the frontend path to return to after logging in.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	state, stateHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		utils.RespondWithError(w, "Failed to start login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		utils.RespondWithError(w, "Failed to start login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		utils.RespondWithError(w, "Failed to start login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	loginState := &services.OIDCLoginState{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectTo:   safeRedirectPath(r.URL.Query().Get("redirect_to")),
+	}
+	if err := h.stateRepo.Create(ctx, stateHash, loginState, time.Now().Add(oidcLoginTTL)); err != nil {
+		utils.RespondWithError(w, "Failed to start login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := h.provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		utils.RespondWithError(w, "Failed to reach identity provider: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// ties the state to this browser, so nobody can log a victim in to the
+	// attacker's account by sending them a callback link
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		HttpOnly: true,
+		Secure:   os.Getenv("APP_ENV") != "development",
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback finishes the login the provider redirected back from, starts a
+// session and sends the browser back to the frontend. Users with two-factor
+// enabled are sent to the frontend's /login/two-factor page instead, with a
+// challenge for LoginTwoFactor. Failures are reported to the frontend's login
+// page through the sso_error query parameter.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/api/auth/oidc", MaxAge: -1})
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Printf("identity provider returned error: %s %s", providerErr, query.Get("error_description"))
+		redirectWithSSOError(w, r, "provider_error")
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		redirectWithSSOError(w, r, "invalid_state")
+		return
+	}
+	loginState, err := h.stateRepo.Consume(ctx, auth.HashOpaqueToken(state))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidLoginState) {
+			log.Printf("failed to consume login state: %v", err)
+		}
+		redirectWithSSOError(w, r, "invalid_state")
+		return
+	}
+
+	claims, err := h.provider.Exchange(ctx, query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("failed to complete single sign-on: %v", err)
+		redirectWithSSOError(w, r, "provider_error")
+		return
+	}
+
+	user, err := h.resolveUser(ctx, claims)
+	if err != nil {
+		log.Printf("single sign-on rejected for subject %s: %v", claims.Subject, err)
+		code := "server_error"
+		switch {
+		case errors.Is(err, errSSOEmailNotAllowed):
+			code = "email_not_allowed"
+		case errors.Is(err, errSSOEmailUnverified):
+			code = "email_not_verified"
+		case errors.Is(err, errSSONoAccount):
+			code = "no_account"
+		case errors.Is(err, errSSOAccountUnverified):
+			code = "account_not_verified"
+		}
+		event := loginFailedEvent(nil, claims.Email, code)
+		event.Metadata["method"] = "oidc"
+		h.auth.audit.record(r, event)
+		redirectWithSSOError(w, r, code)
+		return
+	}
+
+	// the provider only replaces the password; users who enrolled in
+	// two-factor still answer a challenge, unless configured otherwise
+	if !h.provider.Config().SkipTwoFactor {
+		twoFactorEnabled, err := h.auth.twoFactorRepo.IsEnabled(ctx, user.ID)
+		if err != nil {
+			log.Printf("failed to check two-factor for user %s: %v", user.ID, err)
+			redirectWithSSOError(w, r, "server_error")
+			return
+		}
+		if twoFactorEnabled {
+			challengeToken, err := h.auth.startTwoFactorChallenge(ctx, user.ID)
+			if err != nil {
+				log.Printf("failed to start two-factor challenge for user %s: %v", user.ID, err)
+				redirectWithSSOError(w, r, "server_error")
+				return
+			}
+			// the token goes in the fragment, which browsers don't send to
+			// servers or put in referrers
+			params := url.Values{"challenge_token": {challengeToken}, "redirect_to": {loginState.RedirectTo}}
+			http.Redirect(w, r, appURL()+"/login/two-factor#"+params.Encode(), http.StatusFound)
+			return
+		}
+	}
+
+	if _, err := h.auth.startSession(w, r, user); err != nil {
+		log.Printf("failed to start session for user %s: %v", user.ID, err)
+		redirectWithSSOError(w, r, "server_error")
+		return
+	}
+	h.auth.audit.record(r, loginSucceededEvent(user.ID, "oidc"))
+
+	http.Redirect(w, r, appURL()+loginState.RedirectTo, http.StatusFound)
+}
+
+// resolveUser finds the user the provider's account is linked to. An
+// unlinked account is linked to the user with the same, provider verified,
+// email, or a new user is provisioned for it. A user that never verified the
+// email isn't linked: anyone could have registered it, and would keep their
+// password and sessions on the account the real owner then signs in to.
+func (h *OIDCHandler) resolveUser(ctx context.Context, claims *oidc.IDTokenClaims) (*models.User, error) {
+	config := h.provider.Config()
+	if !config.EmailAllowed(claims.Email) {
+		return nil, errSSOEmailNotAllowed
+	}
+
+	identity, err := h.identityRepo.GetByIssuerSubject(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		if err := h.identityRepo.RecordLogin(ctx, identity.ID, claims.Email); err != nil {
+			return nil, err
+		}
+		return h.userRepo.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, errSSOEmailUnverified
+	}
+
+	user, err := h.userRepo.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		if user.EmailVerifiedAt == nil {
+			return nil, errSSOAccountUnverified
+		}
+		identity := models.NewUserIdentity(uuid.New(), user.ID, claims.Issuer, claims.Subject, claims.Email)
+		if err := h.identityRepo.Link(ctx, identity); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	if !config.AutoProvision {
+		return nil, errSSONoAccount
+	}
+	return h.provisionUser(ctx, claims)
+}
+
+func (h *OIDCHandler) provisionUser(ctx context.Context, claims *oidc.IDTokenClaims) (*models.User, error) {
+	username, err := h.availableUsername(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// the account has no usable password until the user sets one through the
+	// password reset flow
+	randomPassword, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := claims.Name
+	if fullName == "" {
+		fullName = username
+	}
+	user := models.NewUser(uuid.New(), fullName, claims.Email, hashedPassword, username, models.RoleUser, claims.Picture)
+	verifiedAt := time.Now()
+	user.EmailVerifiedAt = &verifiedAt
+
+	identity := models.NewUserIdentity(uuid.New(), user.ID, claims.Issuer, claims.Subject, claims.Email)
+	if err := h.identityRepo.CreateWithUser(ctx, user, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a username from the provider's claims, adding a
+// random suffix when it is already taken.
+func (h *OIDCHandler) availableUsername(ctx context.Context, claims *oidc.IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = claims.Email
+	}
+	if at := strings.Index(base, "@"); at >= 0 {
+		base = base[:at]
+	}
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return -1
+	}, base)
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	if len(base) > 90 {
+		base = base[:90]
+	}
+
+	username := base
+	for range 5 {
+		_, err := h.userRepo.GetByUsername(ctx, username)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return username, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		username = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("failed to find a free username")
+}
+
+// safeRedirectPath only lets the login return to a path of the frontend, so
+// the endpoint can't be used as an open redirect.
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
+
+func appURL() string {
+	return utils.GetEnvOrDefault("APP_URL", "http://localhost:5173")
+}
+
+func redirectWithSSOError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, appURL()+"/login?sso_error="+url.QueryEscape(code), http.StatusFound)
+}
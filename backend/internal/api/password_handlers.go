@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/mailer"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type PasswordResetHandler struct {
+	userRepo  services.UserRepository
+	resetRepo services.PasswordResetRepository
+	mailer    mailer.Mailer
+	validate  *validator.Validate
+}
+
+func NewPasswordResetHandler(userRepo services.UserRepository, resetRepo services.PasswordResetRepository, mailer mailer.Mailer, validate *validator.Validate) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		userRepo:  userRepo,
+		resetRepo: resetRepo,
+		mailer:    mailer,
+		validate:  validate,
+	}
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=100"`
+}
+
+const forgotPasswordResponse = "If an account with this email exists, a password reset link has been sent"
+
+// ForgotPassword emails a single-use reset link to the account's address. It
+// answers the same way whether or not the email belongs to an account, so it
+// can't be used to find out who is registered.
+func (h *PasswordResetHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		utils.RespondWithError(w, utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByEmail(r.Context(), request.Email)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, "Failed to request password reset: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utils.RespondWithJSON(w, forgotPasswordResponse, http.StatusOK)
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.resetRepo.Create(r.Context(), user.ID, tokenHash, time.Now().Add(auth.PasswordResetTTL())); err != nil {
+		utils.RespondWithError(w, "Failed to request password reset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	link := utils.GetEnvOrDefault("APP_URL", "http://localhost:5173") + "/reset-password?token=" + url.QueryEscape(token)
+	h.sendResetEmail(user, link)
+
+	utils.RespondWithJSON(w, forgotPasswordResponse, http.StatusOK)
+}
+
+// sendResetEmail emails the reset link in the background. Waiting for the
+// mail server would make requests for existing accounts answer slower than
+// the others, and failing them would tell the caller the account exists.
+func (h *PasswordResetHandler) sendResetEmail(user *models.User, link string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := h.mailer.Send(ctx, mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your Kira password",
+			Body: fmt.Sprintf(
+				"Hi %s,\n\nSomeone asked to reset the password of your Kira account. Open the link below to choose a new one:\n\n%s\n\nThe link works once and expires in %s. If you didn't ask for this you can ignore this email.\n",
+				user.FullName, link, auth.PasswordResetTTL(),
+			),
+		})
+		if err != nil {
+			log.Printf("failed to send password reset email to user %s: %v", user.ID, err)
+		}
+	}()
+}
+
+// ResetPassword sets a new password using a token from a reset email and
+// logs the account out everywhere.
+func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		utils.RespondWithError(w, utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(request.Password)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.resetRepo.Reset(r.Context(), auth.HashOpaqueToken(request.Token), hashedPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		utils.RespondWithError(w, "Failed to reset password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Password has been reset, please log in with your new password", http.StatusOK)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+var errProjectAccessDenied = errors.New("you do not have access to this project")
+
+// projectAccess checks the caller's membership before a handler touches a
+// project or anything that belongs to it.
+type projectAccess struct {
+	memberRepo services.ProjectMemberRepository
+}
+
+// require returns the user's role in the project, or errProjectAccessDenied
+// when the user is not a member or their role ranks below minRole.
+func (a projectAccess) require(ctx context.Context, projectID, userID uuid.UUID, minRole string) (string, error) {
+	role, err := a.memberRepo.GetRole(ctx, projectID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errProjectAccessDenied
+		}
+		return "", err
+	}
+	if !models.ProjectRoleAtLeast(role, minRole) {
+		return "", errProjectAccessDenied
+	}
+	return role, nil
+}
+
+// respondWithAccessError maps the errors returned by projectAccess and the
+// repositories to a response.
+func respondWithAccessError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusNotFound)
+	case errors.Is(err, errProjectAccessDenied):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrLastProjectOwner), errors.Is(err, services.ErrAlreadyMember):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+	default:
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -16,20 +15,23 @@ import (
 
 type ProjectHandler struct {
 	projectRepo services.ProjectRepository
+	memberRepo  services.ProjectMemberRepository
+	access      projectAccess
 	validate    *validator.Validate
 }
 
-func NewProjectHandler(projectRepo services.ProjectRepository, validator *validator.Validate) *ProjectHandler {
-	return &ProjectHandler{projectRepo: projectRepo, validate: validator}
+func NewProjectHandler(projectRepo services.ProjectRepository, memberRepo services.ProjectMemberRepository, validator *validator.Validate) *ProjectHandler {
+	return &ProjectHandler{projectRepo: projectRepo, memberRepo: memberRepo, access: projectAccess{memberRepo: memberRepo}, validate: validator}
 }
 
 func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 	var projectData struct {
-		Name        string `json:"name" validate:"required,min=2,max=100"`
-		Description string `json:"description" validate:"required,min=10,max=500"`
-		Status      string `json:"status" validate:"required,oneof=active inactive"`
+		Name                string `json:"name" validate:"required,min=2,max=100"`
+		Description         string `json:"description" validate:"required,min=10,max=500"`
+		Status              string `json:"status" validate:"required,oneof=active inactive"`
+		RequireBlockersDone bool   `json:"require_blockers_done"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&projectData); err != nil {
 		http.Error(w, "Failed to create project (not able to read body)", http.StatusInternalServerError)
@@ -45,13 +47,14 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	err := h.projectRepo.Create(ctx, &models.Project{
-		ID:          uuid.New(),
-		Name:        projectData.Name,
-		Description: projectData.Description,
-		Status:      projectData.Status,
-		OwnerID:     ownerID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:                  uuid.New(),
+		Name:                projectData.Name,
+		Description:         projectData.Description,
+		Status:              projectData.Status,
+		OwnerID:             ownerID,
+		RequireBlockersDone: projectData.RequireBlockersDone,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
 	})
 	if err != nil {
 		utils.RespondWithError(w, "Failed to create project: "+err.Error(), http.StatusInternalServerError)
@@ -69,6 +72,8 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 		Name        string    `json:"name" validate:"required,min=2,max=100"`
 		Description string    `json:"description" validate:"required,min=10,max=500"`
 		Status      string    `json:"status" validate:"required,oneof=active inactive"`
+		// RequireBlockersDone is left as it is when missing
+		RequireBlockersDone *bool `json:"require_blockers_done"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&projectData); err != nil {
 		http.Error(w, "Failed to update project (not able to read body)", http.StatusInternalServerError)
@@ -78,18 +83,28 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, "Validation error: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	ownerID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
 	if !ok {
 		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
 		return
 	}
-	err := h.projectRepo.Update(ctx, &models.Project{
-		ID:          projectData.ID,
-		Name:        projectData.Name,
-		Description: projectData.Description,
-		OwnerID:     ownerID,
-		Status:      projectData.Status,
-	})
+	if _, err := h.access.require(ctx, projectData.ID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to update project", err)
+		return
+	}
+	project, err := h.projectRepo.GetByID(ctx, projectData.ID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update project", err)
+		return
+	}
+	project.Name = projectData.Name
+	project.Description = projectData.Description
+	project.Status = projectData.Status
+	if projectData.RequireBlockersDone != nil {
+		project.RequireBlockersDone = *projectData.RequireBlockersDone
+	}
+	project.UpdatedAt = time.Now()
+	err = h.projectRepo.Update(ctx, project, userID)
 	if err != nil {
 		utils.RespondWithError(w, "Failed to update project: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -111,9 +126,18 @@ func (h *ProjectHandler) GetProjectByID(w http.ResponseWriter, r *http.Request)
 		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get project", err)
+		return
+	}
 	project, err := h.projectRepo.GetByID(ctx, projectID)
 	if err != nil {
-		utils.RespondWithError(w, "Failed to get project: "+err.Error(), http.StatusInternalServerError)
+		respondWithAccessError(w, "Failed to get project", err)
 		return
 	}
 	if project == nil {
@@ -156,7 +180,16 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
-	err = h.projectRepo.Delete(ctx, projectID)
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleOwner); err != nil {
+		respondWithAccessError(w, "Failed to delete project", err)
+		return
+	}
+	err = h.projectRepo.Delete(ctx, projectID, userID)
 	if err != nil {
 		utils.RespondWithError(w, "Failed to delete project: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -164,39 +197,31 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, "Project deleted successfully", http.StatusOK)
 }
 
+// ListProjects lists the projects the caller is a member of, newest first.
+// It takes the list query parameters, see parseListQuery.
 func (h *ProjectHandler) ListProjects(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-	limit := 10
-	offset := 0
 
-	if limitStr != "" {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil || limit <= 0 {
-			utils.RespondWithError(w, "Invalid limit value", http.StatusBadRequest)
-			return
-		}
-	}
-	if offsetStr != "" {
-		var err error
-		offset, err = strconv.Atoi(offsetStr)
-		if err != nil || offset < 0 {
-			utils.RespondWithError(w, "Invalid offset value", http.StatusBadRequest)
-			return
-		}
+	q, err := parseListQuery(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
 	}
 
-	projects, err := h.projectRepo.List(ctx, limit, offset)
+	projects, err := h.projectRepo.ListByMember(ctx, userID, q)
 	if err != nil {
-		utils.RespondWithError(w, "Failed to list projects: "+err.Error(), http.StatusInternalServerError)
+		respondWithListError(w, "Failed to list projects", err)
 		return
 	}
 	if projects == nil {
-		utils.RespondWithError(w, "No projects found", http.StatusNotFound)
-		return
+		projects = []*models.Project{}
 	}
 	utils.RespondWithJSON(w, projects, http.StatusOK)
 }
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type ProjectMemberData struct {
+	ProjectID uuid.UUID `json:"project_id" validate:"required"`
+	UserID    uuid.UUID `json:"user_id" validate:"required"`
+	Role      string    `json:"role" validate:"required,oneof=owner admin member viewer"`
+}
+
+func (h *ProjectHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list members", err)
+		return
+	}
+
+	members, err := h.memberRepo.ListByProject(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if members == nil {
+		members = []*models.ProjectMember{}
+	}
+
+	utils.RespondWithJSON(w, members, http.StatusOK)
+}
+
+// AddMember adds a user to the project. Admins can add members, admins and
+// viewers; only owners can add other owners.
+func (h *ProjectHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var memberData ProjectMemberData
+	if err := json.NewDecoder(r.Body).Decode(&memberData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(memberData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	minRole := models.ProjectRoleAdmin
+	if memberData.Role == models.ProjectRoleOwner {
+		minRole = models.ProjectRoleOwner
+	}
+	if _, err := h.access.require(ctx, memberData.ProjectID, userID, minRole); err != nil {
+		respondWithAccessError(w, "Failed to add member", err)
+		return
+	}
+
+	member := models.NewProjectMember(memberData.ProjectID, memberData.UserID, memberData.Role)
+	if err := h.memberRepo.Add(ctx, member); err != nil {
+		respondWithAccessError(w, "Failed to add member", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, member, http.StatusCreated)
+}
+
+// UpdateMemberRole changes a member's role. Granting or taking away the owner
+// role is reserved to owners.
+func (h *ProjectHandler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var memberData ProjectMemberData
+	if err := json.NewDecoder(r.Body).Decode(&memberData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(memberData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	callerRole, err := h.access.require(ctx, memberData.ProjectID, userID, models.ProjectRoleAdmin)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update member", err)
+		return
+	}
+	currentRole, err := h.memberRepo.GetRole(ctx, memberData.ProjectID, memberData.UserID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update member", err)
+		return
+	}
+	if (currentRole == models.ProjectRoleOwner || memberData.Role == models.ProjectRoleOwner) && callerRole != models.ProjectRoleOwner {
+		respondWithAccessError(w, "Failed to update member", errProjectAccessDenied)
+		return
+	}
+
+	if err := h.memberRepo.UpdateRole(ctx, memberData.ProjectID, memberData.UserID, memberData.Role); err != nil {
+		respondWithAccessError(w, "Failed to update member", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Member role updated successfully", http.StatusOK)
+}
+
+// RemoveMember removes a user from the project. Admins can remove members,
+// owners can remove anyone and every member can leave on their own. The last
+// owner can never be removed.
+func (h *ProjectHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	memberID, err := uuid.Parse(r.URL.Query().Get("user_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if memberID != userID {
+		callerRole, err := h.access.require(ctx, projectID, userID, models.ProjectRoleAdmin)
+		if err != nil {
+			respondWithAccessError(w, "Failed to remove member", err)
+			return
+		}
+		memberRole, err := h.memberRepo.GetRole(ctx, projectID, memberID)
+		if err != nil {
+			respondWithAccessError(w, "Failed to remove member", err)
+			return
+		}
+		if memberRole == models.ProjectRoleOwner && callerRole != models.ProjectRoleOwner {
+			respondWithAccessError(w, "Failed to remove member", errProjectAccessDenied)
+			return
+		}
+	}
+
+	if err := h.memberRepo.Remove(ctx, projectID, memberID); err != nil {
+		respondWithAccessError(w, "Failed to remove member", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Member removed successfully", http.StatusOK)
+}
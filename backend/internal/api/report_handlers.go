@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+const (
+	// maxReportDays caps the date range of a report.
+	maxReportDays = 366
+	// defaultReportDays is the range of a project report without from and to.
+	defaultReportDays = 30
+	// defaultVelocitySprints is how many closed sprints velocity looks at
+	// without a sprints parameter.
+	defaultVelocitySprints = 5
+	maxVelocitySprints     = 20
+)
+
+type ReportHandler struct {
+	reportRepo services.ReportRepository
+	sprintRepo services.SprintRepository
+	access     projectAccess
+}
+
+func NewReportHandler(reportRepo services.ReportRepository, sprintRepo services.SprintRepository, memberRepo services.ProjectMemberRepository) *ReportHandler {
+	return &ReportHandler{
+		reportRepo: reportRepo,
+		sprintRepo: sprintRepo,
+		access:     projectAccess{memberRepo: memberRepo},
+	}
+}
+
+// reportScope reads the scope of a report from the query: either sprint_id
+// for the days of a sprint, or project_id with optional from and to dates for
+// the whole project. It responds with an error and returns false when the
+// scope is invalid or the caller can't see the project.
+func (h *ReportHandler) reportScope(w http.ResponseWriter, r *http.Request, ctx context.Context) (services.ReportScope, bool) {
+	query := r.URL.Query()
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return services.ReportScope{}, false
+	}
+	unit, err := reportUnit(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return services.ReportScope{}, false
+	}
+
+	if sprintIDStr := query.Get("sprint_id"); sprintIDStr != "" {
+		sprintID, err := uuid.Parse(sprintIDStr)
+		if err != nil {
+			utils.RespondWithError(w, "Invalid sprint ID format", http.StatusBadRequest)
+			return services.ReportScope{}, false
+		}
+		sprint, err := h.sprintRepo.GetByID(ctx, sprintID)
+		if err != nil {
+			respondWithAccessError(w, "Failed to get report", err)
+			return services.ReportScope{}, false
+		}
+		if _, err := h.access.require(ctx, sprint.ProjectID, userID, models.ProjectRoleViewer); err != nil {
+			respondWithAccessError(w, "Failed to get report", err)
+			return services.ReportScope{}, false
+		}
+		return services.ReportScope{
+			Unit:      unit,
+			ProjectID: sprint.ProjectID,
+			SprintID:  &sprint.ID,
+			From:      sprint.StartDate,
+			To:        sprint.EndDate,
+			Cutoff:    sprint.ClosedAt,
+		}, true
+	}
+
+	projectID, err := uuid.Parse(query.Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return services.ReportScope{}, false
+	}
+	from, to, err := parseDateRange(r, defaultReportDays)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return services.ReportScope{}, false
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get report", err)
+		return services.ReportScope{}, false
+	}
+	return services.ReportScope{Unit: unit, ProjectID: projectID, From: from, To: to}, true
+}
+
+// reportUnit reads what a report counts work in from the unit query
+// parameter, tasks by default.
+func reportUnit(r *http.Request) (string, error) {
+	switch unit := r.URL.Query().Get("unit"); unit {
+	case "", services.ReportUnitTasks:
+		return services.ReportUnitTasks, nil
+	case services.ReportUnitPoints:
+		return unit, nil
+	default:
+		return "", errors.New("unit must be tasks or points")
+	}
+}
+
+// parseDateRange reads the from and to dates of the query. The range ends
+// today without to and covers defaultDays days without from, and it never
+// covers more than maxReportDays days.
+func parseDateRange(r *http.Request, defaultDays int) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	to := truncateToDay(time.Now())
+	if toStr := query.Get("to"); toStr != "" {
+		var err error
+		if to, err = time.Parse(sprintDateLayout, toStr); err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid to date, expected YYYY-MM-DD")
+		}
+	}
+	from := to.AddDate(0, 0, -(defaultDays - 1))
+	if fromStr := query.Get("from"); fromStr != "" {
+		var err error
+		if from, err = time.Parse(sprintDateLayout, fromStr); err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid from date, expected YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+	if to.Sub(from) >= maxReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("Date ranges cover at most %d days", maxReportDays)
+	}
+	return from, to, nil
+}
+
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// GetBurndown returns the daily scope, completed and remaining work of a
+// sprint or date range, which charts both burndown and burnup.
+func (h *ReportHandler) GetBurndown(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	scope, ok := h.reportScope(w, r, ctx)
+	if !ok {
+		return
+	}
+	report, err := h.reportRepo.Burndown(ctx, scope)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get burndown: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, report, http.StatusOK)
+}
+
+// GetCumulativeFlow returns the daily work per status of a sprint or date
+// range.
+func (h *ReportHandler) GetCumulativeFlow(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	scope, ok := h.reportScope(w, r, ctx)
+	if !ok {
+		return
+	}
+	report, err := h.reportRepo.CumulativeFlow(ctx, scope)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get cumulative flow: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, report, http.StatusOK)
+}
+
+// GetVelocity returns the committed and completed work of the project's last
+// closed sprints, as many as the sprints query parameter asks for.
+func (h *ReportHandler) GetVelocity(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	sprintCount := defaultVelocitySprints
+	if countStr := r.URL.Query().Get("sprints"); countStr != "" {
+		sprintCount, err = strconv.Atoi(countStr)
+		if err != nil || sprintCount < 1 || sprintCount > maxVelocitySprints {
+			utils.RespondWithError(w, "sprints must be between 1 and "+strconv.Itoa(maxVelocitySprints), http.StatusBadRequest)
+			return
+		}
+	}
+	unit, err := reportUnit(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get velocity", err)
+		return
+	}
+
+	report, err := h.reportRepo.Velocity(ctx, projectID, sprintCount, unit)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get velocity: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, report, http.StatusOK)
+}
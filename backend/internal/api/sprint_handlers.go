@@ -0,0 +1,457 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// sprintDateLayout is the format of sprint start and end dates.
+const sprintDateLayout = "2006-01-02"
+
+type SprintHandler struct {
+	sprintRepo services.SprintRepository
+	taskRepo   services.TaskRepository
+	access     projectAccess
+	validate   *validator.Validate
+}
+
+func NewSprintHandler(sprintRepo services.SprintRepository, taskRepo services.TaskRepository, memberRepo services.ProjectMemberRepository, validate *validator.Validate) *SprintHandler {
+	return &SprintHandler{
+		sprintRepo: sprintRepo,
+		taskRepo:   taskRepo,
+		access:     projectAccess{memberRepo: memberRepo},
+		validate:   validate,
+	}
+}
+
+type SprintData struct {
+	ProjectID uuid.UUID `json:"project_id" validate:"required"`
+	Name      string    `json:"name" validate:"required,min=1,max=100"`
+	Goal      string    `json:"goal" validate:"max=5000"`
+	StartDate string    `json:"start_date" validate:"required,datetime=2006-01-02"`
+	EndDate   string    `json:"end_date" validate:"required,datetime=2006-01-02"`
+}
+
+type UpdateSprintData struct {
+	ID        uuid.UUID `json:"id" validate:"required"`
+	Name      string    `json:"name" validate:"required,min=1,max=100"`
+	Goal      string    `json:"goal" validate:"max=5000"`
+	StartDate string    `json:"start_date" validate:"required,datetime=2006-01-02"`
+	EndDate   string    `json:"end_date" validate:"required,datetime=2006-01-02"`
+}
+
+type CloseSprintData struct {
+	ID uuid.UUID `json:"id" validate:"required"`
+	// MoveUnfinishedTo is "backlog", or "sprint" for TargetSprintID or, when
+	// that is omitted, the next planned sprint.
+	MoveUnfinishedTo string     `json:"move_unfinished_to" validate:"required,oneof=backlog sprint"`
+	TargetSprintID   *uuid.UUID `json:"target_sprint_id"`
+}
+
+type SprintTasksData struct {
+	ProjectID uuid.UUID `json:"project_id" validate:"required"`
+	// SprintID is the sprint the tasks move to, nil moves them to the backlog.
+	SprintID *uuid.UUID  `json:"sprint_id"`
+	TaskIDs  []uuid.UUID `json:"task_ids" validate:"required,min=1,max=100"`
+}
+
+// parseSprintDates parses the sprint's dates, responding with an error and
+// returning false when they are invalid.
+func parseSprintDates(w http.ResponseWriter, start, end string) (time.Time, time.Time, bool) {
+	startDate, err := time.Parse(sprintDateLayout, start)
+	if err != nil {
+		utils.RespondWithError(w, "Invalid start_date: "+err.Error(), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	endDate, err := time.Parse(sprintDateLayout, end)
+	if err != nil {
+		utils.RespondWithError(w, "Invalid end_date: "+err.Error(), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if endDate.Before(startDate) {
+		utils.RespondWithError(w, "end_date must not be before start_date", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	return startDate, endDate, true
+}
+
+func respondWithSprintError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrSprintAlreadyActive), errors.Is(err, services.ErrSprintNotPlanned),
+		errors.Is(err, services.ErrSprintNotActive), errors.Is(err, services.ErrSprintClosed),
+		errors.Is(err, services.ErrNoNextSprint):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrTaskNotInProject):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusBadRequest)
+	default:
+		respondWithAccessError(w, message, err)
+	}
+}
+
+// getSprint loads a sprint and makes sure the caller has at least minRole in
+// its project.
+func (h *SprintHandler) getSprint(ctx context.Context, sprintID, userID uuid.UUID, minRole string) (*models.Sprint, error) {
+	sprint, err := h.sprintRepo.GetByID(ctx, sprintID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.access.require(ctx, sprint.ProjectID, userID, minRole); err != nil {
+		return nil, err
+	}
+	return sprint, nil
+}
+
+func (h *SprintHandler) CreateSprint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var sprintData SprintData
+	if err := json.NewDecoder(r.Body).Decode(&sprintData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(sprintData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	startDate, endDate, ok := parseSprintDates(w, sprintData.StartDate, sprintData.EndDate)
+	if !ok {
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, sprintData.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to create sprint", err)
+		return
+	}
+
+	sprint := models.NewSprint(uuid.New(), sprintData.ProjectID, sprintData.Name, sprintData.Goal, startDate, endDate)
+	if err := h.sprintRepo.Create(ctx, sprint); err != nil {
+		utils.RespondWithError(w, "Failed to create sprint: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, sprint, http.StatusCreated)
+}
+
+func (h *SprintHandler) ListSprints(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list sprints", err)
+		return
+	}
+
+	sprints, err := h.sprintRepo.ListByProject(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list sprints: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, sprints, http.StatusOK)
+}
+
+func (h *SprintHandler) GetSprintByID(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sprintID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid sprint ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	sprint, err := h.getSprint(ctx, sprintID, userID, models.ProjectRoleViewer)
+	if err != nil {
+		respondWithAccessError(w, "Failed to get sprint", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, sprint, http.StatusOK)
+}
+
+func (h *SprintHandler) UpdateSprint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var sprintData UpdateSprintData
+	if err := json.NewDecoder(r.Body).Decode(&sprintData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(sprintData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	startDate, endDate, ok := parseSprintDates(w, sprintData.StartDate, sprintData.EndDate)
+	if !ok {
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	sprint, err := h.getSprint(ctx, sprintData.ID, userID, models.ProjectRoleMember)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update sprint", err)
+		return
+	}
+	sprint.Name = sprintData.Name
+	sprint.Goal = sprintData.Goal
+	sprint.StartDate = startDate
+	sprint.EndDate = endDate
+	sprint.UpdatedAt = time.Now()
+	if err := h.sprintRepo.Update(ctx, sprint); err != nil {
+		respondWithSprintError(w, "Failed to update sprint", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, sprint, http.StatusOK)
+}
+
+// DeleteSprint deletes a planned or active sprint, its tasks go back to the
+// backlog.
+func (h *SprintHandler) DeleteSprint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sprintID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid sprint ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.getSprint(ctx, sprintID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to delete sprint", err)
+		return
+	}
+	if err := h.sprintRepo.Delete(ctx, sprintID, userID); err != nil {
+		respondWithSprintError(w, "Failed to delete sprint", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Sprint deleted successfully", http.StatusOK)
+}
+
+// StartSprint starts a planned sprint. It fails while another sprint of the
+// project is active.
+func (h *SprintHandler) StartSprint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sprintID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid sprint ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.getSprint(ctx, sprintID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to start sprint", err)
+		return
+	}
+	sprint, err := h.sprintRepo.Start(ctx, sprintID)
+	if err != nil {
+		respondWithSprintError(w, "Failed to start sprint", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, sprint, http.StatusOK)
+}
+
+// CloseSprint closes the active sprint and moves its unfinished tasks to the
+// backlog or to another sprint.
+func (h *SprintHandler) CloseSprint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var closeData CloseSprintData
+	if err := json.NewDecoder(r.Body).Decode(&closeData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(closeData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.getSprint(ctx, closeData.ID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to close sprint", err)
+		return
+	}
+	options := services.SprintCloseOptions{
+		ToSprint:       closeData.MoveUnfinishedTo == "sprint",
+		TargetSprintID: closeData.TargetSprintID,
+	}
+	result, err := h.sprintRepo.Close(ctx, closeData.ID, options, userID)
+	if err != nil {
+		respondWithSprintError(w, "Failed to close sprint", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, result, http.StatusOK)
+}
+
+// SetSprintTasks moves tasks into a sprint, or back to the backlog when no
+// sprint is given.
+func (h *SprintHandler) SetSprintTasks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var tasksData SprintTasksData
+	if err := json.NewDecoder(r.Body).Decode(&tasksData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(tasksData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, tasksData.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to plan tasks", err)
+		return
+	}
+
+	if tasksData.SprintID == nil {
+		err := h.sprintRepo.RemoveTasks(ctx, tasksData.ProjectID, tasksData.TaskIDs, userID)
+		if err != nil {
+			respondWithSprintError(w, "Failed to move tasks to the backlog", err)
+			return
+		}
+		utils.RespondWithJSON(w, "Tasks moved to the backlog", http.StatusOK)
+		return
+	}
+
+	sprint, err := h.sprintRepo.GetByID(ctx, *tasksData.SprintID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to plan tasks", err)
+		return
+	}
+	if sprint.ProjectID != tasksData.ProjectID {
+		utils.RespondWithError(w, "Sprint does not belong to the project", http.StatusBadRequest)
+		return
+	}
+	if err := h.sprintRepo.AddTasks(ctx, sprint.ID, tasksData.TaskIDs, userID); err != nil {
+		respondWithSprintError(w, "Failed to plan tasks", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Tasks moved to the sprint", http.StatusOK)
+}
+
+func (h *SprintHandler) ListSprintTasks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sprintID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid sprint ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.getSprint(ctx, sprintID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list sprint tasks", err)
+		return
+	}
+	tasks, err := h.taskRepo.ListBySprint(ctx, sprintID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list sprint tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+
+	utils.RespondWithJSON(w, tasks, http.StatusOK)
+}
+
+// ListBacklog lists the project's tasks that are not planned into a sprint.
+func (h *SprintHandler) ListBacklog(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list backlog", err)
+		return
+	}
+
+	tasks, err := h.taskRepo.ListBacklog(ctx, projectID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list backlog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+
+	utils.RespondWithJSON(w, tasks, http.StatusOK)
+}
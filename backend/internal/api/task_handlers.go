@@ -0,0 +1,476 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type TaskHandler struct {
+	taskRepo     services.TaskRepository
+	workflowRepo services.WorkflowRepository
+	fieldRepo    services.CustomFieldRepository
+	access       projectAccess
+	validate     *validator.Validate
+}
+
+func NewTaskHandler(taskRepo services.TaskRepository, workflowRepo services.WorkflowRepository, fieldRepo services.CustomFieldRepository, memberRepo services.ProjectMemberRepository, validator *validator.Validate) *TaskHandler {
+	return &TaskHandler{taskRepo: taskRepo, workflowRepo: workflowRepo, fieldRepo: fieldRepo, access: projectAccess{memberRepo: memberRepo}, validate: validator}
+}
+
+type TaskData struct {
+	ProjectID                uuid.UUID                     `json:"project_id" validate:"required"`
+	Type                     string                        `json:"type" validate:"omitempty,oneof=epic story task bug subtask"`
+	ParentID                 *uuid.UUID                    `json:"parent_id"`
+	Title                    string                        `json:"title" validate:"required,min=2,max=255"`
+	Description              string                        `json:"description" validate:"max=5000"`
+	AssigneeID               *uuid.UUID                    `json:"assignee_id"`
+	Status                   string                        `json:"status" validate:"omitempty,max=50"`
+	Priority                 string                        `json:"priority" validate:"omitempty,oneof=low medium high urgent"`
+	DueDate                  *time.Time                    `json:"due_date"`
+	StoryPoints              *int                          `json:"story_points" validate:"omitempty,min=0,max=1000"`
+	OriginalEstimateMinutes  *int                          `json:"original_estimate_minutes" validate:"omitempty,min=0,max=525600"`
+	RemainingEstimateMinutes *int                          `json:"remaining_estimate_minutes" validate:"omitempty,min=0,max=525600"`
+	LabelIDs                 []uuid.UUID                   `json:"label_ids" validate:"max=20"`
+	CustomFields             map[uuid.UUID]json.RawMessage `json:"custom_fields" validate:"max=100"`
+}
+
+// UpdateTaskData replaces the task's fields. Leaving label_ids out keeps the
+// task's labels, an empty list removes them. Custom fields left out keep
+// their value, a null value clears them.
+type UpdateTaskData struct {
+	ID                       uuid.UUID                     `json:"id" validate:"required"`
+	Type                     string                        `json:"type" validate:"omitempty,oneof=epic story task bug subtask"`
+	ParentID                 *uuid.UUID                    `json:"parent_id"`
+	Title                    string                        `json:"title" validate:"required,min=2,max=255"`
+	Description              string                        `json:"description" validate:"max=5000"`
+	AssigneeID               *uuid.UUID                    `json:"assignee_id"`
+	Status                   string                        `json:"status" validate:"required,max=50"`
+	Priority                 string                        `json:"priority" validate:"required,oneof=low medium high urgent"`
+	DueDate                  *time.Time                    `json:"due_date"`
+	StoryPoints              *int                          `json:"story_points" validate:"omitempty,min=0,max=1000"`
+	OriginalEstimateMinutes  *int                          `json:"original_estimate_minutes" validate:"omitempty,min=0,max=525600"`
+	RemainingEstimateMinutes *int                          `json:"remaining_estimate_minutes" validate:"omitempty,min=0,max=525600"`
+	LabelIDs                 []uuid.UUID                   `json:"label_ids" validate:"max=20"`
+	CustomFields             map[uuid.UUID]json.RawMessage `json:"custom_fields" validate:"max=100"`
+}
+
+// checkAssignee makes sure a task is only assigned to someone who can work on
+// the project, responding with an error and returning false otherwise.
+func (h *TaskHandler) checkAssignee(w http.ResponseWriter, ctx context.Context, projectID uuid.UUID, assigneeID *uuid.UUID) bool {
+	if assigneeID == nil {
+		return true
+	}
+	_, err := h.access.require(ctx, projectID, *assigneeID, models.ProjectRoleMember)
+	if errors.Is(err, errProjectAccessDenied) {
+		utils.RespondWithError(w, "Assignee must be a member of the project", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		utils.RespondWithError(w, "Failed to check assignee: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// setCustomValues validates the custom field values against the project's
+// fields and sets them on the task, responding with an error and returning
+// false when they don't fit.
+func (h *TaskHandler) setCustomValues(w http.ResponseWriter, ctx context.Context, task *models.Task, values map[uuid.UUID]json.RawMessage, message string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	fields, err := h.fieldRepo.ListByProject(ctx, task.ProjectID)
+	if err != nil {
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if err := applyCustomValues(ctx, h.validate, h.access, fields, task, values); err != nil {
+		respondWithTaskError(w, message, err)
+		return false
+	}
+	return true
+}
+
+// respondWithTaskError maps the task hierarchy, blocker and workflow errors
+// to a response.
+func respondWithTaskError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrParentNotFound), errors.Is(err, services.ErrParentNotInProject),
+		errors.Is(err, services.ErrInvalidParentType), errors.Is(err, services.ErrSubtaskNeedsParent),
+		errors.Is(err, services.ErrUnknownStatus), errors.Is(err, services.ErrLabelNotInProject),
+		errors.Is(err, errInvalidCustomValue):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrTransitionGuard):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrChildTypeConflict), errors.Is(err, services.ErrTaskBlocked),
+		errors.Is(err, services.ErrTransitionNotAllowed):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+	default:
+		respondWithAccessError(w, message, err)
+	}
+}
+
+func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var taskData TaskData
+	if err := json.NewDecoder(r.Body).Decode(&taskData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(taskData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, taskData.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to create task", err)
+		return
+	}
+	if !h.checkAssignee(w, ctx, taskData.ProjectID, taskData.AssigneeID) {
+		return
+	}
+
+	// the repository starts a task without status in the workflow's initial status
+	if taskData.Priority == "" {
+		taskData.Priority = "medium"
+	}
+
+	task := models.NewTask(uuid.New(), taskData.Title, taskData.Description, taskData.ProjectID, taskData.AssigneeID, taskData.Status, taskData.Priority, taskData.DueDate)
+	if taskData.Type != "" {
+		task.Type = taskData.Type
+	}
+	task.ParentID = taskData.ParentID
+	task.StoryPoints = taskData.StoryPoints
+	task.OriginalEstimateMinutes = taskData.OriginalEstimateMinutes
+	task.RemainingEstimateMinutes = taskData.RemainingEstimateMinutes
+	task.LabelIDs = taskData.LabelIDs
+	if !h.setCustomValues(w, ctx, task, taskData.CustomFields, "Failed to create task") {
+		return
+	}
+	// the remaining estimate starts out as the original estimate
+	if task.RemainingEstimateMinutes == nil {
+		task.RemainingEstimateMinutes = task.OriginalEstimateMinutes
+	}
+	if err := h.taskRepo.Create(ctx, task, userID); err != nil {
+		respondWithTaskError(w, "Failed to create task", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, task, http.StatusCreated)
+}
+
+func (h *TaskHandler) GetTaskByID(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	taskID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid task ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to get task", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get task", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, task, http.StatusOK)
+}
+
+// GetTaskTree returns the task with its children, their children and the
+// roll-up of their progress, plus the parents above it.
+func (h *TaskHandler) GetTaskTree(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	taskID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid task ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to get task tree", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get task tree", err)
+		return
+	}
+
+	tree, err := h.taskRepo.GetTree(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to get task tree", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, tree, http.StatusOK)
+}
+
+func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var taskData UpdateTaskData
+	if err := json.NewDecoder(r.Body).Decode(&taskData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(taskData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskData.ID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to update task", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to update task", err)
+		return
+	}
+	if !h.checkAssignee(w, ctx, task.ProjectID, taskData.AssigneeID) {
+		return
+	}
+
+	// a missing type keeps the task's current type
+	if taskData.Type != "" {
+		task.Type = taskData.Type
+	}
+	task.ParentID = taskData.ParentID
+	task.Title = taskData.Title
+	task.Description = taskData.Description
+	task.AssigneeID = taskData.AssigneeID
+	task.Status = taskData.Status
+	task.Priority = taskData.Priority
+	task.DueDate = taskData.DueDate
+	task.StoryPoints = taskData.StoryPoints
+	task.OriginalEstimateMinutes = taskData.OriginalEstimateMinutes
+	task.RemainingEstimateMinutes = taskData.RemainingEstimateMinutes
+	if taskData.LabelIDs != nil {
+		task.LabelIDs = taskData.LabelIDs
+	}
+	if !h.setCustomValues(w, ctx, task, taskData.CustomFields, "Failed to update task") {
+		return
+	}
+	task.UpdatedAt = time.Now()
+
+	if err := h.taskRepo.Update(ctx, task, userID); err != nil {
+		respondWithTaskError(w, "Failed to update task", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, task, http.StatusOK)
+}
+
+func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	taskID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid task ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to delete task", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to delete task", err)
+		return
+	}
+
+	if err := h.taskRepo.Delete(ctx, taskID, userID); err != nil {
+		respondWithAccessError(w, "Failed to delete task", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Task deleted successfully", http.StatusOK)
+}
+
+// ListTasksByProject lists the project's tasks, newest first. It takes the
+// list query parameters, see parseListQuery. The labels and label_match query
+// parameters narrow it down to tasks with any or all of a set of labels,
+// cf.<field id> parameters to tasks with a custom field value.
+func (h *TaskHandler) ListTasksByProject(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	q, err := parseListQuery(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list tasks", err)
+		return
+	}
+	fields, err := h.fieldRepo.ListByProject(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filter.CustomValues, err = parseCustomValueFilters(r, fields); err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := h.taskRepo.ListByProject(ctx, projectID, filter, q)
+	if err != nil {
+		respondWithListError(w, "Failed to list tasks", err)
+		return
+	}
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+
+	utils.RespondWithJSON(w, tasks, http.StatusOK)
+}
+
+// ListTasksByAssignee lists the tasks assigned to the user given by the
+// assignee_id query parameter, or to the caller when it is omitted. Tasks of
+// projects the caller cannot see are left out.
+func (h *TaskHandler) ListTasksByAssignee(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	assigneeID := userID
+	if id := r.URL.Query().Get("assignee_id"); id != "" {
+		var err error
+		assigneeID, err = uuid.Parse(id)
+		if err != nil {
+			utils.RespondWithError(w, "Invalid assignee ID format", http.StatusBadRequest)
+			return
+		}
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := h.taskRepo.ListByAssignee(ctx, assigneeID, userID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+
+	utils.RespondWithJSON(w, tasks, http.StatusOK)
+}
+
+// parseTaskFilter reads the labels query parameter, a comma separated list
+// of label IDs, and label_match, which is any (the default) or all.
+func parseTaskFilter(r *http.Request) (services.TaskFilter, error) {
+	var filter services.TaskFilter
+	if labels := r.URL.Query().Get("labels"); labels != "" {
+		for _, labelStr := range strings.Split(labels, ",") {
+			labelID, err := uuid.Parse(strings.TrimSpace(labelStr))
+			if err != nil {
+				return filter, errors.New("Invalid label ID format")
+			}
+			filter.LabelIDs = append(filter.LabelIDs, labelID)
+		}
+	}
+	switch r.URL.Query().Get("label_match") {
+	case "", "any":
+	case "all":
+		filter.MatchAllLabels = true
+	default:
+		return filter, errors.New("Invalid label_match value, use any or all")
+	}
+	return filter, nil
+}
+
+// parseLimitOffset reads the limit and offset query parameters, defaulting
+// to the first 10 records.
+func parseLimitOffset(r *http.Request) (int, int, error) {
+	limit := 10
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("Invalid limit value")
+		}
+	}
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		var err error
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Invalid offset value")
+		}
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// The inverse link types are accepted on create and stored as the link they
+// mirror, with source and target swapped.
+const (
+	taskLinkBlockedBy    = "blocked_by"
+	taskLinkDuplicatedBy = "duplicated_by"
+)
+
+type TaskLinkHandler struct {
+	linkRepo services.TaskLinkRepository
+	taskRepo services.TaskRepository
+	access   projectAccess
+	validate *validator.Validate
+}
+
+func NewTaskLinkHandler(linkRepo services.TaskLinkRepository, taskRepo services.TaskRepository, memberRepo services.ProjectMemberRepository, validate *validator.Validate) *TaskLinkHandler {
+	return &TaskLinkHandler{
+		linkRepo: linkRepo,
+		taskRepo: taskRepo,
+		access:   projectAccess{memberRepo: memberRepo},
+		validate: validate,
+	}
+}
+
+type TaskLinkData struct {
+	SourceTaskID uuid.UUID `json:"source_task_id" validate:"required"`
+	TargetTaskID uuid.UUID `json:"target_task_id" validate:"required,nefield=SourceTaskID"`
+	Type         string    `json:"type" validate:"required,oneof=blocks blocked_by relates_to duplicates duplicated_by"`
+}
+
+func respondWithLinkError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrLinkAcrossProjects):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrLinkExists), errors.Is(err, services.ErrBlockingCycle):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+	default:
+		respondWithAccessError(w, message, err)
+	}
+}
+
+// CreateTaskLink links two tasks of the same project. A blocking link that
+// would close a cycle is refused.
+func (h *TaskLinkHandler) CreateTaskLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var linkData TaskLinkData
+	if err := json.NewDecoder(r.Body).Decode(&linkData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(linkData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	source, target, linkType := linkData.SourceTaskID, linkData.TargetTaskID, linkData.Type
+	switch linkType {
+	case taskLinkBlockedBy:
+		source, target, linkType = target, source, models.TaskLinkBlocks
+	case taskLinkDuplicatedBy:
+		source, target, linkType = target, source, models.TaskLinkDuplicates
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, source)
+	if err != nil {
+		respondWithAccessError(w, "Failed to link tasks", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to link tasks", err)
+		return
+	}
+
+	link := models.NewTaskLink(uuid.New(), source, target, linkType, userID)
+	if err := h.linkRepo.Create(ctx, link); err != nil {
+		respondWithLinkError(w, "Failed to link tasks", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, link, http.StatusCreated)
+}
+
+// ListTaskLinks returns the links from and to a task.
+func (h *TaskLinkHandler) ListTaskLinks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	taskID, err := uuid.Parse(r.URL.Query().Get("task_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid task ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to list links", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list links", err)
+		return
+	}
+
+	links, err := h.linkRepo.ListByTask(ctx, taskID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, links, http.StatusOK)
+}
+
+func (h *TaskLinkHandler) DeleteTaskLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	linkID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid link ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	link, err := h.linkRepo.GetByID(ctx, linkID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to delete link", err)
+		return
+	}
+	task, err := h.taskRepo.GetByID(ctx, link.SourceTaskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to delete link", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to delete link", err)
+		return
+	}
+
+	if err := h.linkRepo.Delete(ctx, linkID, userID); err != nil {
+		respondWithAccessError(w, "Failed to delete link", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Link deleted successfully", http.StatusOK)
+}
+
+// GetDependencyGraph returns the linked tasks of a project and the links
+// between them.
+func (h *TaskLinkHandler) GetDependencyGraph(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get dependency graph", err)
+		return
+	}
+
+	graph, err := h.linkRepo.Graph(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get dependency graph: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, graph, http.StatusOK)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type TokenHandler struct {
+	tokenRepo services.PersonalAccessTokenRepository
+	audit     auditLogger
+	validate  *validator.Validate
+}
+
+func NewTokenHandler(tokenRepo services.PersonalAccessTokenRepository, auditRepo services.AuditLogRepository, validate *validator.Validate) *TokenHandler {
+	return &TokenHandler{tokenRepo: tokenRepo, audit: auditLogger{repo: auditRepo}, validate: validate}
+}
+
+type CreateTokenRequest struct {
+	Name          string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=projects:read projects:write tasks:read tasks:write users:read"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+type CreateTokenResponse struct {
+	Token               string                      `json:"token"`
+	PersonalAccessToken *models.PersonalAccessToken `json:"personal_access_token"`
+}
+
+// CreateToken issues a personal access token. The token itself is only part
+// of this response, afterwards only its prefix is shown.
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		utils.RespondWithError(w, utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	secret, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := auth.PersonalAccessTokenPrefix + secret
+	tokenHash := auth.HashOpaqueToken(token)
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	slices.Sort(request.Scopes)
+	pat := models.NewPersonalAccessToken(uuid.New(), userID, request.Name, token[:len(auth.PersonalAccessTokenPrefix)+4], slices.Compact(request.Scopes), expiresAt)
+	if err := h.tokenRepo.Create(r.Context(), pat, tokenHash); err != nil {
+		utils.RespondWithError(w, "Failed to create token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	metadata := map[string]string{"name": pat.Name, "scopes": strings.Join(pat.Scopes, " ")}
+	if pat.ExpiresAt != nil {
+		metadata["expires_at"] = pat.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	h.audit.record(r, &models.AuditLog{
+		EventType:  models.AuditTokenCreated,
+		Outcome:    models.AuditOutcomeSuccess,
+		TargetType: models.AuditTargetToken,
+		TargetID:   pat.ID.String(),
+		Metadata:   metadata,
+	})
+
+	utils.RespondWithJSON(w, CreateTokenResponse{Token: token, PersonalAccessToken: pat}, http.StatusCreated)
+}
+
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	tokens, err := h.tokenRepo.ListByUser(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []*models.PersonalAccessToken{}
+	}
+
+	utils.RespondWithJSON(w, tokens, http.StatusOK)
+}
+
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	tokenID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid token ID format", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	if err := h.tokenRepo.Revoke(r.Context(), tokenID, userID); err != nil {
+		respondWithAccessError(w, "Failed to revoke token", err)
+		return
+	}
+	h.audit.record(r, &models.AuditLog{
+		EventType:  models.AuditTokenRevoked,
+		Outcome:    models.AuditOutcomeSuccess,
+		TargetType: models.AuditTargetToken,
+		TargetID:   tokenID.String(),
+	})
+
+	utils.RespondWithJSON(w, "Token revoked successfully", http.StatusOK)
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorHandler struct {
+	userRepo      services.UserRepository
+	twoFactorRepo services.TwoFactorRepository
+	validate      *validator.Validate
+}
+
+func NewTwoFactorHandler(userRepo services.UserRepository, twoFactorRepo services.TwoFactorRepository, validate *validator.Validate) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		userRepo:      userRepo,
+		twoFactorRepo: twoFactorRepo,
+		validate:      validate,
+	}
+}
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// checkSecondFactor accepts either a current TOTP code that was not used
+// before or an unused recovery code. A code is tried first when both are set.
+func checkSecondFactor(ctx context.Context, twoFactorRepo services.TwoFactorRepository, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		tf, err := twoFactorRepo.Get(ctx, userID)
+		if err != nil {
+			return false, err
+		}
+		if tf.EnabledAt == nil {
+			return false, nil
+		}
+		secret, err := auth.DecryptSecret(tf.SecretEncrypted)
+		if err != nil {
+			return false, err
+		}
+		step, ok := auth.ValidateTOTP(secret, code, time.Now())
+		if ok {
+			return twoFactorRepo.UseStep(ctx, userID, step)
+		}
+	}
+	if recoveryCode != "" {
+		return twoFactorRepo.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(recoveryCode))
+	}
+	return false, nil
+}
+
+func (h *TwoFactorHandler) Status(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	enabled, err := h.twoFactorRepo.IsEnabled(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get two-factor status: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, map[string]bool{"enabled": enabled}, http.StatusOK)
+}
+
+// Setup starts an enrollment by creating a new secret. It only takes effect
+// once confirmed through Enable with a code from the authenticator app.
+func (h *TwoFactorHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	encrypted, err := auth.EncryptSecret(secret)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to encrypt secret: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.twoFactorRepo.SavePendingSecret(r.Context(), userID, encrypted); err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			utils.RespondWithError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		utils.RespondWithError(w, "Failed to set up two-factor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI("Kira", user.Email, secret),
+	}
+
+	utils.RespondWithJSON(w, response, http.StatusOK)
+}
+
+// Enable confirms the pending enrollment with a code and returns the recovery
+// codes. This is the only time the recovery codes are shown.
+func (h *TwoFactorHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request struct {
+		Code string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		utils.RespondWithError(w, utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	tf, err := h.twoFactorRepo.Get(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, "Two-factor setup has not been started", http.StatusBadRequest)
+			return
+		}
+		utils.RespondWithError(w, "Failed to enable two-factor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tf.EnabledAt != nil {
+		utils.RespondWithError(w, services.ErrTwoFactorAlreadyEnabled.Error(), http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.DecryptSecret(tf.SecretEncrypted)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to enable two-factor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(secret, request.Code, time.Now())
+	if !ok {
+		utils.RespondWithError(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	if err := h.twoFactorRepo.Enable(r.Context(), userID, step, hashes); err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			utils.RespondWithError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		utils.RespondWithError(w, "Failed to enable two-factor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// Disable turns two-factor off. The user has to prove it is them again with
+// their password and a second factor.
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	r = r.WithContext(ctx)
+	defer cancel()
+
+	var request DisableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		utils.RespondWithError(w, utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !utils.CheckPassword(user.Password, request.Password) {
+		utils.RespondWithError(w, "Incorrect Password", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := checkSecondFactor(r.Context(), h.twoFactorRepo, userID, request.Code, request.RecoveryCode)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, "Two-factor is not enabled", http.StatusBadRequest)
+			return
+		}
+		utils.RespondWithError(w, "Failed to disable two-factor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		utils.RespondWithError(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.twoFactorRepo.Disable(r.Context(), userID); err != nil {
+		utils.RespondWithError(w, "Failed to disable two-factor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Two-factor authentication disabled", http.StatusOK)
+}
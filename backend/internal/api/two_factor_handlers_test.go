@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+)
+
+// fakeTwoFactorRepository keeps one user's second factor in memory, with the
+// same replay rules as the Postgres repository.
+type fakeTwoFactorRepository struct {
+	services.TwoFactorRepository
+	tf            models.TwoFactor
+	recoveryCodes map[string]bool
+}
+
+func (r *fakeTwoFactorRepository) Get(ctx context.Context, userID uuid.UUID) (*models.TwoFactor, error) {
+	tf := r.tf
+	return &tf, nil
+}
+
+func (r *fakeTwoFactorRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	if r.tf.LastUsedStep != nil && *r.tf.LastUsedStep >= step {
+		return false, nil
+	}
+	r.tf.LastUsedStep = &step
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	if used, ok := r.recoveryCodes[codeHash]; !ok || used {
+		return false, nil
+	}
+	r.recoveryCodes[codeHash] = true
+	return true, nil
+}
+
+func newFakeTwoFactor(t *testing.T, secret string) *fakeTwoFactorRepository {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(key))
+	encrypted, err := auth.EncryptSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabledAt := time.Now()
+	return &fakeTwoFactorRepository{
+		tf:            models.TwoFactor{SecretEncrypted: encrypted, EnabledAt: &enabledAt},
+		recoveryCodes: map[string]bool{auth.HashRecoveryCode("abcd-efgh-ijkl-mnop"): false},
+	}
+}
+
+func TestCheckSecondFactorRejectsReplay(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeTwoFactor(t, secret)
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		recoveryCode string
+		ok           bool
+	}{
+		{"fresh code", code, "", true},
+		{"same code again", code, "", false},
+		{"recovery code", "", "ABCD EFGH IJKL MNOP", true},
+		{"recovery code again", "", "abcd-efgh-ijkl-mnop", false},
+		{"nothing", "", "", false},
+	}
+	for _, tt := range tests {
+		ok, err := checkSecondFactor(context.Background(), repo, uuid.New(), tt.code, tt.recoveryCode)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestCheckSecondFactorRejectsOlderStep(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeTwoFactor(t, secret)
+	step := auth.TOTPStep(time.Now())
+	repo.tf.LastUsedStep = &step
+
+	// still inside the skew window, but older than the last accepted code
+	previous, err := auth.TOTPCode(secret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := checkSecondFactor(context.Background(), repo, uuid.New(), previous, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("code older than the last accepted one was accepted")
+	}
+}
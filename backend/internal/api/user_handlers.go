@@ -3,11 +3,13 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/sajidcodesdotcom/kira/internal/auth"
 	"github.com/sajidcodesdotcom/kira/internal/models"
 	"github.com/sajidcodesdotcom/kira/internal/services"
@@ -16,17 +18,18 @@ import (
 
 type UserHandler struct {
 	userRepo services.UserRepository
+	audit    auditLogger
 	validate *validator.Validate
 }
 
-func NewUserHandler(userRepo services.UserRepository, validator *validator.Validate) *UserHandler {
-	return &UserHandler{userRepo: userRepo, validate: validator}
+func NewUserHandler(userRepo services.UserRepository, auditRepo services.AuditLogRepository, validator *validator.Validate) *UserHandler {
+	return &UserHandler{userRepo: userRepo, audit: auditLogger{repo: auditRepo}, validate: validator}
 }
 
 type UserData struct {
 	ID        uuid.UUID `json:"id" validate:"required,uuid"`
 	FullName  string    `json:"full_name" validate:"required,min=2,max=100"`
-	Email     string    `json:"email" validate:"required,email"`
+	Email     string    `json:"email,omitempty" validate:"required,email"`
 	Password  string    `json:"password" validate:"required,min=8,max=100"`
 	Username  string    `json:"username" validate:"required,min=3,max=100"`
 	AvatarURL string    `json:"avatar_url" validate:"omitempty,url"`
@@ -108,13 +111,17 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := utils.HashPassword(userData.Password)
-	if err != nil {
-		utils.RespondWithError(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
+	callerID, _ := r.Context().Value("user_id").(uuid.UUID)
+	role, _ := r.Context().Value("role").(string)
+	if userData.ID != callerID && !auth.HasPermission(role, auth.PermUsersWrite) {
+		utils.RespondWithError(w, "Forbidden, you can only update your own account", http.StatusForbidden)
+		return
 	}
 
+	hashedPassword, err := utils.HashPassword(userData.Password)
 	if err != nil {
-		utils.RespondWithError(w, "Failed to parse UUID: "+err.Error(), http.StatusInternalServerError)
+		utils.RespondWithError(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	existingUser, err := h.userRepo.GetByID(r.Context(), userData.ID)
@@ -130,21 +137,35 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	if err := h.userRepo.Update(r.Context(), existingUser); err != nil {
 		utils.RespondWithError(w, "Failed to update user: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	utils.RespondWithJSON(w, existingUser, http.StatusOK)
 }
 
+// ListUsers lists users, newest first. It takes the list query parameters,
+// see parseListQuery.
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	r = r.WithContext(ctx)
 	defer cancel()
 
-	var usersData []UserData
+	q, err := parseListQuery(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	usersData := []UserData{}
+
+	// only those who manage users see and look users up by email address
+	// and role
+	role, _ := r.Context().Value("role").(string)
+	private := auth.HasPermission(role, auth.PermUsersWrite)
 
-	users, err := h.userRepo.List(r.Context(), 5, 0)
+	users, err := h.userRepo.List(r.Context(), q, private)
 	if err != nil {
-		utils.RespondWithError(w, "Failed to get user list: "+err.Error(), http.StatusInternalServerError)
+		respondWithListError(w, "Failed to get user list", err)
 		return
 	}
 
@@ -152,10 +173,12 @@ func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		userData := UserData{
 			ID:        user.ID,
 			FullName:  user.FullName,
-			Email:     user.Email,
 			Username:  user.Username,
 			AvatarURL: user.AvatarURL,
 		}
+		if private {
+			userData.Email = user.Email
+		}
 
 		usersData = append(usersData, userData)
 	}
@@ -173,11 +196,87 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, "Failed to parse UUID: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	user, err := h.userRepo.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	if err := h.userRepo.Delete(r.Context(), id); err != nil {
 		utils.RespondWithError(w, "Failed to delete user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.audit.record(r, &models.AuditLog{
+		EventType:  models.AuditUserDeleted,
+		Outcome:    models.AuditOutcomeSuccess,
+		TargetType: models.AuditTargetUser,
+		TargetID:   id.String(),
+		Metadata:   map[string]string{"email": user.Email, "username": user.Username, "role": user.Role},
+	})
+
+	utils.RespondWithJSON(w, "User deleted successfully", http.StatusOK)
+}
+
+// UpdateRole promotes or demotes a user. The new role is picked up by the
+// user's next issued token. Admins cannot change their own role, so there is
+// always someone left who can undo a change.
+func (h *UserHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	var roleData struct {
+		UserID uuid.UUID `json:"user_id" validate:"required"`
+		Role   string    `json:"role" validate:"required"`
+	}
 
+	if err := json.NewDecoder(r.Body).Decode(&roleData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(roleData); err != nil {
+		errorString := utils.GetValidationErrors(err)
+		utils.RespondWithError(w, errorString, http.StatusBadRequest)
+		return
+	}
+
+	if !auth.IsValidRole(roleData.Role) {
+		utils.RespondWithError(w, "Unknown role: "+roleData.Role, http.StatusBadRequest)
+		return
+	}
+
+	callerID, _ := r.Context().Value("user_id").(uuid.UUID)
+	if roleData.UserID == callerID {
+		utils.RespondWithError(w, "You cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), roleData.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.userRepo.UpdateRole(r.Context(), roleData.UserID, roleData.Role); err != nil {
+		utils.RespondWithError(w, "Failed to update user role: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit.record(r, &models.AuditLog{
+		EventType:  models.AuditUserRoleChanged,
+		Outcome:    models.AuditOutcomeSuccess,
+		TargetType: models.AuditTargetUser,
+		TargetID:   roleData.UserID.String(),
+		Metadata:   map[string]string{"old_role": user.Role, "new_role": roleData.Role},
+	})
+
+	utils.RespondWithJSON(w, "User role updated successfully", http.StatusOK)
 }
 
 func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
@@ -193,7 +292,8 @@ func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateToken(user)
+	sessionID := r.Context().Value("session_id").(uuid.UUID)
+	token, err := auth.GenerateToken(user, sessionID)
 	if err != nil {
 		utils.RespondWithError(w, "Failed to generate token: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -202,14 +302,15 @@ func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 	response := AuthResponse{
 		Token: token,
 		User: &models.User{
-			ID:        user.ID,
-			FullName:  user.FullName,
-			Email:     user.Email,
-			Username:  user.Username,
-			Role:      user.Role,
-			AvatarURL: user.AvatarURL,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:              user.ID,
+			FullName:        user.FullName,
+			Email:           user.Email,
+			Username:        user.Username,
+			Role:            user.Role,
+			AvatarURL:       user.AvatarURL,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
 		},
 	}
 
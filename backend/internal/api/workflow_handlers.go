@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type WorkflowHandler struct {
+	workflowRepo services.WorkflowRepository
+	access       projectAccess
+	validate     *validator.Validate
+}
+
+func NewWorkflowHandler(workflowRepo services.WorkflowRepository, memberRepo services.ProjectMemberRepository, validate *validator.Validate) *WorkflowHandler {
+	return &WorkflowHandler{
+		workflowRepo: workflowRepo,
+		access:       projectAccess{memberRepo: memberRepo},
+		validate:     validate,
+	}
+}
+
+type WorkflowStatusData struct {
+	Key      string `json:"key" validate:"required,max=50"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Category string `json:"category" validate:"required,oneof=todo in_progress done"`
+}
+
+type WorkflowTransitionData struct {
+	From   *string  `json:"from" validate:"omitempty,max=50"`
+	To     string   `json:"to" validate:"required,max=50"`
+	Guards []string `json:"guards" validate:"dive,oneof=assignee_only admin_only subtasks_done"`
+}
+
+// WorkflowData is a project's whole workflow. Statuses are listed in board
+// order; without transitions tasks move freely between the statuses.
+type WorkflowData struct {
+	ProjectID   uuid.UUID                `json:"project_id" validate:"required"`
+	Statuses    []WorkflowStatusData     `json:"statuses" validate:"required,min=1,max=50,dive"`
+	Transitions []WorkflowTransitionData `json:"transitions" validate:"max=500,dive"`
+}
+
+func respondWithWorkflowError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidWorkflow):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrStatusInUse):
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusConflict)
+	default:
+		respondWithAccessError(w, message, err)
+	}
+}
+
+// GetWorkflow returns the project's workflow, the default one when the
+// project hasn't defined its own.
+func (h *WorkflowHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get workflow", err)
+		return
+	}
+
+	workflow, err := h.workflowRepo.Get(ctx, projectID)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get workflow: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, workflow, http.StatusOK)
+}
+
+// UpdateWorkflow replaces the project's workflow. Only project admins can
+// change it.
+func (h *WorkflowHandler) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var workflowData WorkflowData
+	if err := json.NewDecoder(r.Body).Decode(&workflowData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(workflowData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, workflowData.ProjectID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to update workflow", err)
+		return
+	}
+
+	workflow := &models.Workflow{
+		ProjectID:   workflowData.ProjectID,
+		Statuses:    make([]models.WorkflowStatus, 0, len(workflowData.Statuses)),
+		Transitions: make([]models.WorkflowTransition, 0, len(workflowData.Transitions)),
+	}
+	for _, status := range workflowData.Statuses {
+		workflow.Statuses = append(workflow.Statuses, models.WorkflowStatus{Key: status.Key, Name: status.Name, Category: status.Category})
+	}
+	for _, transition := range workflowData.Transitions {
+		guards := transition.Guards
+		if guards == nil {
+			guards = []string{}
+		}
+		workflow.Transitions = append(workflow.Transitions, models.WorkflowTransition{From: transition.From, To: transition.To, Guards: guards})
+	}
+	if err := h.workflowRepo.Replace(ctx, workflow, userID); err != nil {
+		respondWithWorkflowError(w, "Failed to update workflow", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, workflow, http.StatusOK)
+}
+
+// ResetWorkflow puts the project back on the default workflow.
+func (h *WorkflowHandler) ResetWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleAdmin); err != nil {
+		respondWithAccessError(w, "Failed to reset workflow", err)
+		return
+	}
+
+	if err := h.workflowRepo.Reset(ctx, projectID, userID); err != nil {
+		respondWithWorkflowError(w, "Failed to reset workflow", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, models.DefaultWorkflow(projectID), http.StatusOK)
+}
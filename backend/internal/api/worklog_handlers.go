@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// defaultTimesheetDays is the range of a timesheet without from and to.
+const defaultTimesheetDays = 7
+
+type WorklogHandler struct {
+	worklogRepo services.WorklogRepository
+	taskRepo    services.TaskRepository
+	access      projectAccess
+	validate    *validator.Validate
+}
+
+func NewWorklogHandler(worklogRepo services.WorklogRepository, taskRepo services.TaskRepository, memberRepo services.ProjectMemberRepository, validate *validator.Validate) *WorklogHandler {
+	return &WorklogHandler{
+		worklogRepo: worklogRepo,
+		taskRepo:    taskRepo,
+		access:      projectAccess{memberRepo: memberRepo},
+		validate:    validate,
+	}
+}
+
+type WorklogData struct {
+	TaskID   uuid.UUID `json:"task_id" validate:"required"`
+	WorkDate string    `json:"work_date" validate:"required,datetime=2006-01-02"`
+	Minutes  int       `json:"minutes" validate:"required,min=1,max=1440"`
+	Comment  string    `json:"comment" validate:"max=2000"`
+}
+
+type UpdateWorklogData struct {
+	ID       uuid.UUID `json:"id" validate:"required"`
+	WorkDate string    `json:"work_date" validate:"required,datetime=2006-01-02"`
+	Minutes  int       `json:"minutes" validate:"required,min=1,max=1440"`
+	Comment  string    `json:"comment" validate:"max=2000"`
+}
+
+var errNotWorklogAuthor = errors.New("you can only change your own worklogs")
+
+// CreateWorklog logs time the caller spent on a task.
+func (h *WorklogHandler) CreateWorklog(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var worklogData WorklogData
+	if err := json.NewDecoder(r.Body).Decode(&worklogData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(worklogData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	username, _ := r.Context().Value("username").(string)
+
+	task, err := h.taskRepo.GetByID(ctx, worklogData.TaskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to log work", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		respondWithAccessError(w, "Failed to log work", err)
+		return
+	}
+
+	// the validator already checked the format
+	workDate, _ := time.Parse(sprintDateLayout, worklogData.WorkDate)
+	worklog := models.NewWorklog(uuid.New(), task.ID, userID, workDate, worklogData.Minutes, worklogData.Comment)
+	worklog.Username = username
+	if err := h.worklogRepo.Create(ctx, worklog); err != nil {
+		respondWithAccessError(w, "Failed to log work", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, worklog, http.StatusCreated)
+}
+
+// ListWorklogs returns the worklogs of a task, most recent work first.
+func (h *WorklogHandler) ListWorklogs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	taskID, err := uuid.Parse(r.URL.Query().Get("task_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid task ID format", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		respondWithAccessError(w, "Failed to list worklogs", err)
+		return
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to list worklogs", err)
+		return
+	}
+
+	worklogs, err := h.worklogRepo.ListByTask(ctx, taskID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, "Failed to list worklogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, worklogs, http.StatusOK)
+}
+
+// getOwnWorklog loads a worklog and makes sure the caller logged it and can
+// still work on its project.
+func (h *WorklogHandler) getOwnWorklog(ctx context.Context, worklogID, userID uuid.UUID) (*models.Worklog, error) {
+	worklog, err := h.worklogRepo.GetByID(ctx, worklogID)
+	if err != nil {
+		return nil, err
+	}
+	if worklog.UserID != userID {
+		return nil, errNotWorklogAuthor
+	}
+	task, err := h.taskRepo.GetByID(ctx, worklog.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.access.require(ctx, task.ProjectID, userID, models.ProjectRoleMember); err != nil {
+		return nil, err
+	}
+	return worklog, nil
+}
+
+func respondWithWorklogError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, errNotWorklogAuthor) {
+		utils.RespondWithError(w, message+": "+err.Error(), http.StatusForbidden)
+		return
+	}
+	respondWithAccessError(w, message, err)
+}
+
+// UpdateWorklog changes the caller's own worklog.
+func (h *WorklogHandler) UpdateWorklog(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var worklogData UpdateWorklogData
+	if err := json.NewDecoder(r.Body).Decode(&worklogData); err != nil {
+		utils.RespondWithError(w, "Error reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(worklogData); err != nil {
+		utils.RespondWithError(w, "Validation error: "+utils.GetValidationErrors(err), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	worklog, err := h.getOwnWorklog(ctx, worklogData.ID, userID)
+	if err != nil {
+		respondWithWorklogError(w, "Failed to update worklog", err)
+		return
+	}
+
+	worklog.WorkDate, _ = time.Parse(sprintDateLayout, worklogData.WorkDate)
+	worklog.Minutes = worklogData.Minutes
+	worklog.Comment = worklogData.Comment
+	worklog.UpdatedAt = time.Now()
+	if err := h.worklogRepo.Update(ctx, worklog); err != nil {
+		respondWithAccessError(w, "Failed to update worklog", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, worklog, http.StatusOK)
+}
+
+func (h *WorklogHandler) DeleteWorklog(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	worklogID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid worklog ID format", http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.getOwnWorklog(ctx, worklogID, userID); err != nil {
+		respondWithWorklogError(w, "Failed to delete worklog", err)
+		return
+	}
+
+	if err := h.worklogRepo.Delete(ctx, worklogID, userID); err != nil {
+		respondWithAccessError(w, "Failed to delete worklog", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, "Worklog deleted successfully", http.StatusOK)
+}
+
+// GetUserTimesheet returns the time a user logged between the from and to
+// dates, the caller's own without user_id. Only work on projects the caller
+// is a member of is included.
+func (h *WorklogHandler) GetUserTimesheet(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	timesheetUserID := userID
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		var err error
+		if timesheetUserID, err = uuid.Parse(userIDStr); err != nil {
+			utils.RespondWithError(w, "Invalid user ID format", http.StatusBadRequest)
+			return
+		}
+	}
+	from, to, err := parseDateRange(r, defaultTimesheetDays)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timesheet, err := h.worklogRepo.Timesheet(ctx, services.TimesheetFilter{
+		ViewerID: userID,
+		UserID:   &timesheetUserID,
+		From:     from,
+		To:       to,
+	})
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get timesheet: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, timesheet, http.StatusOK)
+}
+
+// GetProjectTimesheet returns the time every member logged on the project
+// between the from and to dates.
+func (h *WorklogHandler) GetProjectTimesheet(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	projectID, err := uuid.Parse(r.URL.Query().Get("project_id"))
+	if err != nil {
+		utils.RespondWithError(w, "Invalid project ID format", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseDateRange(r, defaultTimesheetDays)
+	if err != nil {
+		utils.RespondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		utils.RespondWithError(w, "Failed to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.access.require(ctx, projectID, userID, models.ProjectRoleViewer); err != nil {
+		respondWithAccessError(w, "Failed to get timesheet", err)
+		return
+	}
+
+	timesheet, err := h.worklogRepo.Timesheet(ctx, services.TimesheetFilter{
+		ViewerID:  userID,
+		ProjectID: &projectID,
+		From:      from,
+		To:        to,
+	})
+	if err != nil {
+		utils.RespondWithError(w, "Failed to get timesheet: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, timesheet, http.StatusOK)
+}
@@ -21,23 +21,27 @@ var (
 )
 
 type Claims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
-	Role     string    `json:"role"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user *models.User) (string, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", errors.New("The JWT secret key is not found in env")
+// GenerateToken issues a short lived access token for the user's session,
+// signed with the keyring's current signing key.
+func GenerateToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	keys, err := keyring()
+	if err != nil {
+		return "", err
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(AccessTokenTTL())
 	Claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -46,8 +50,9 @@ func GenerateToken(user *models.User) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	token := jwt.NewWithClaims(keys.signingAlg, Claims)
+	token.Header["kid"] = keys.signingID
+	tokenString, err := token.SignedString(keys.signingKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -56,18 +61,23 @@ func GenerateToken(user *models.User) (string, error) {
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return nil, errors.New("The JWT secret key is not found in env")
+	keys, err := keyring()
+	if err != nil {
+		return nil, err
 	}
 	// Parse the token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Look up the key by kid and make sure it was used with its own algorithm
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.verifyByKid[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(jwtSecret), nil
-	})
+		return key.Public, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -110,7 +120,22 @@ func SetTokenCookie(w http.ResponseWriter, token string) {
 		HttpOnly: true,
 		Secure:   !isDevelopment,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   24 * 60 * 60,
+		MaxAge:   int(AccessTokenTTL().Seconds()),
+	})
+}
+
+// SetRefreshTokenCookie stores the refresh token in a cookie that is only sent
+// to the auth endpoints.
+func SetRefreshTokenCookie(w http.ResponseWriter, token string) {
+	isDevelopment := os.Getenv("APP_ENV") == "development"
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    token,
+		Path:     "/api/auth",
+		HttpOnly: true,
+		Secure:   !isDevelopment,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(RefreshTokenTTL().Seconds()),
 	})
 }
 
@@ -125,4 +150,13 @@ func ClearTokenCookie(w http.ResponseWriter) {
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   -1,
 	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/api/auth",
+		HttpOnly: true,
+		Secure:   !isDevelopment,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   -1,
+	})
 }
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerificationKey is a public key tokens can be verified with.
+type VerificationKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Public crypto.PublicKey
+}
+
+// Keyring holds the key new tokens are signed with and every key tokens are
+// still accepted from. Keys are rotated without downtime by first adding the
+// new key as a verification key on all replicas, then making it the signing
+// key, and finally removing the old key once its tokens have expired.
+type Keyring struct {
+	signingKey  crypto.Signer
+	signingID   string
+	signingAlg  jwt.SigningMethod
+	verifyByKid map[string]VerificationKey
+	verifyOrder []string
+}
+
+var currentKeyring atomic.Pointer[Keyring]
+
+// SetKeyring makes the keyring the one GenerateToken and ValidateToken use.
+func SetKeyring(k *Keyring) {
+	currentKeyring.Store(k)
+}
+
+func keyring() (*Keyring, error) {
+	k := currentKeyring.Load()
+	if k == nil {
+		return nil, errors.New("The JWT keyring has not been loaded")
+	}
+	return k, nil
+}
+
+// NewKeyring builds a keyring that signs with signingKey and also accepts
+// tokens signed by the private or public keys in verificationKeys. Only RSA
+// (RS256) and Ed25519 (EdDSA) keys are supported.
+func NewKeyring(signingKey crypto.Signer, verificationKeys ...crypto.PublicKey) (*Keyring, error) {
+	k := &Keyring{verifyByKid: make(map[string]VerificationKey)}
+
+	signing, err := k.addVerificationKey(signingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	k.signingKey = signingKey
+	k.signingID = signing.ID
+	k.signingAlg = signing.Method
+
+	for _, pub := range verificationKeys {
+		if _, err := k.addVerificationKey(pub); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *Keyring) addVerificationKey(pub crypto.PublicKey) (VerificationKey, error) {
+	var method jwt.SigningMethod
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return VerificationKey{}, fmt.Errorf("unsupported JWT key type %T", pub)
+	}
+
+	jwk, err := publicJWK(pub)
+	if err != nil {
+		return VerificationKey{}, err
+	}
+	key := VerificationKey{ID: jwk.Kid, Method: method, Public: pub}
+	if _, ok := k.verifyByKid[key.ID]; !ok {
+		k.verifyByKid[key.ID] = key
+		k.verifyOrder = append(k.verifyOrder, key.ID)
+	}
+	return key, nil
+}
+
+// LoadKeyringFromEnv reads the PEM encoded signing key from
+// JWT_PRIVATE_KEY_FILE and the extra verification keys, private or public,
+// from the comma separated JWT_VERIFICATION_KEY_FILES. In development a
+// throwaway Ed25519 key is generated when no signing key is configured.
+func LoadKeyringFromEnv() (*Keyring, error) {
+	var signingKey crypto.Signer
+	if path := strings.TrimSpace(os.Getenv("JWT_PRIVATE_KEY_FILE")); path != "" {
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE %s does not hold a private key", path)
+		}
+		signingKey = signer
+	} else if os.Getenv("APP_ENV") == "development" {
+		log.Println("JWT_PRIVATE_KEY_FILE is not set, signing tokens with a temporary key that is lost on restart")
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate JWT key: %w", err)
+		}
+		signingKey = priv
+	} else {
+		return nil, errors.New("The JWT private key file is not found in env")
+	}
+
+	var verificationKeys []crypto.PublicKey
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return NewKeyring(signingKey, verificationKeys...)
+}
+
+// readPEMKey parses a PKCS#8 or PKCS#1 private key or a PKIX public key.
+func readPEMKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to read JWT key %s: no PEM block found", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("failed to read JWT key %s: unsupported PEM block %q", path, block.Type)
+	}
+}
+
+// JWK is the JSON Web Key form of a public verification key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every key tokens are accepted from, for other services to
+// verify Kira tokens with.
+func (k *Keyring) JWKS() (JWKS, error) {
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range k.verifyOrder {
+		jwk, err := publicJWK(k.verifyByKid[kid].Public)
+		if err != nil {
+			return JWKS{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// CurrentJWKS returns the JWKS of the loaded keyring.
+func CurrentJWKS() (JWKS, error) {
+	k, err := keyring()
+	if err != nil {
+		return JWKS{}, err
+	}
+	return k.JWKS()
+}
+
+// publicJWK encodes the public key as a JWK whose kid is its RFC 7638
+// thumbprint, so the same key always gets the same id on every replica.
+func publicJWK(pub crypto.PublicKey) (JWK, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	var jwk JWK
+	var thumbprintInput []byte
+	var err error
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{Kty: "RSA", Alg: jwt.SigningMethodRS256.Alg(), N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+		thumbprintInput, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	case ed25519.PublicKey:
+		jwk = JWK{Kty: "OKP", Alg: jwt.SigningMethodEdDSA.Alg(), Crv: "Ed25519", X: b64(key)}
+		thumbprintInput, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	default:
+		return JWK{}, fmt.Errorf("unsupported JWT key type %T", pub)
+	}
+	if err != nil {
+		return JWK{}, fmt.Errorf("failed to encode JWK: %w", err)
+	}
+
+	sum := sha256.Sum256(thumbprintInput)
+	jwk.Kid = b64(sum[:])
+	jwk.Use = "sig"
+	return jwk, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// LockoutPolicy decides how long further login attempts are refused after a
+// number of consecutive failures. Every failure below MaxFailures doubles the
+// delay, starting at BaseDelay, and reaching MaxFailures locks logins for
+// LockoutDuration. Failures older than FailureWindow are forgotten.
+type LockoutPolicy struct {
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	FailureWindow   time.Duration
+}
+
+// AccountLockoutPolicyFromEnv is the policy for failures against a single
+// email address: 1s, 2s, 4s and 8s delays, then a 15 minute lockout on the
+// fifth failure by default.
+func AccountLockoutPolicyFromEnv() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:     intFromEnv("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		BaseDelay:       durationFromEnv("LOGIN_BASE_DELAY", time.Second),
+		MaxDelay:        durationFromEnv("LOGIN_MAX_DELAY", 30*time.Second),
+		LockoutDuration: durationFromEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		FailureWindow:   durationFromEnv("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// IPLockoutPolicyFromEnv is the policy for failures from a single IP, which
+// catches guessing spread over many accounts. There is no delay before the
+// lockout, so people sharing an address are not slowed down by each other's
+// typos.
+func IPLockoutPolicyFromEnv() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:     intFromEnv("LOGIN_MAX_IP_FAILURES", 50),
+		LockoutDuration: durationFromEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		FailureWindow:   durationFromEnv("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// BlockFor returns how long logins are refused after the given number of
+// consecutive failures.
+func (p LockoutPolicy) BlockFor(failures int) time.Duration {
+	if p.MaxFailures > 0 && failures >= p.MaxFailures {
+		return p.LockoutDuration
+	}
+	if p.BaseDelay <= 0 || failures <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func intFromEnv(key string, defaultValue int) int {
+	n, err := strconv.Atoi(utils.GetEnvOrDefault(key, strconv.Itoa(defaultValue)))
+	if err != nil || n <= 0 {
+		return defaultValue
+	}
+	return n
+}
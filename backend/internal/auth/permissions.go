@@ -0,0 +1,47 @@
+package auth
+
+import "github.com/sajidcodesdotcom/kira/internal/models"
+
+type Permission string
+
+const (
+	PermUsersRead        Permission = "users:read"
+	PermUsersWrite       Permission = "users:write"
+	PermUsersDelete      Permission = "users:delete"
+	PermUsersManageRoles Permission = "users:manage_roles"
+	PermUsersUnlock      Permission = "users:unlock"
+	PermAuditRead        Permission = "audit:read"
+)
+
+// rolePermissions is the central table of what each global role may do.
+// Project level rights are handled by project membership roles instead.
+var rolePermissions = map[string][]Permission{
+	models.RoleUser: {
+		PermUsersRead,
+	},
+	models.RoleAdmin: {
+		PermUsersRead,
+		PermUsersWrite,
+		PermUsersDelete,
+		PermUsersManageRoles,
+		PermUsersUnlock,
+		PermAuditRead,
+	},
+}
+
+// HasPermission reports whether the role grants the permission. Unknown roles
+// have no permissions.
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRole reports whether role is one of the known global roles.
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
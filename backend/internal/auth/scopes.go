@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from JWTs and spotted by secret scanners.
+const PersonalAccessTokenPrefix = "kira_pat_"
+
+// Scopes a personal access token can be limited to.
+const (
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeUsersRead     = "users:read"
+)
+
+// IsPersonalAccessToken reports whether the bearer token is a personal
+// access token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// ScopeAllows reports whether the granted scopes allow the requested one. A
+// write scope implies the read scope of the same resource.
+func ScopeAllows(granted []string, scope string) bool {
+	if slices.Contains(granted, scope) {
+		return true
+	}
+	resource, action, ok := strings.Cut(scope, ":")
+	return ok && action == "read" && slices.Contains(granted, resource+":write")
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// GenerateOpaqueToken returns a random URL-safe token together with the hash
+// that is stored in the database in its place.
+func GenerateOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the hex encoded SHA-256 of the token. The tokens
+// carry 256 bits of randomness, so an unsalted fast hash is enough.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AccessTokenTTL is how long an access token is valid, ACCESS_TOKEN_TTL in
+// the env, 15 minutes by default.
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL is how long a refresh token is valid, REFRESH_TOKEN_TTL in
+// the env, 30 days by default.
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// PasswordResetTTL is how long a password reset link works,
+// PASSWORD_RESET_TTL in the env, 1 hour by default.
+func PasswordResetTTL() time.Duration {
+	return durationFromEnv("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// EmailVerificationTTL is how long an email verification link works,
+// EMAIL_VERIFICATION_TTL in the env, 48 hours by default.
+func EmailVerificationTTL() time.Duration {
+	return durationFromEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(utils.GetEnvOrDefault(key, defaultValue.String()))
+	if err != nil || d <= 0 {
+		return defaultValue
+	}
+	return d
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists eight digit codes; six digit codes are their
+	// last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestTOTPCodeSecretFormat(t *testing.T) {
+	want, err := TOTPCode(rfc6238Secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := TOTPCode(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", 1)
+	if err != nil {
+		t.Fatalf("lower case secret: %v", err)
+	}
+	if got != want {
+		t.Errorf("lower case secret gave %s, want %s", got, want)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("invalid secret was accepted")
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TOTPStep(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"two steps back", -2, false},
+		{"previous step", -1, true},
+		{"current step", 0, true},
+		{"next step", 1, true},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, step+tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, ok := ValidateTOTP(rfc6238Secret, code, now)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && matched != step+tt.offset {
+			t.Errorf("%s: matched step %d, want %d", tt.name, matched, step+tt.offset)
+		}
+	}
+}
+
+func TestValidateTOTPCodeFormat(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"exact", "050471", true},
+		{"surrounding space", " 050471\n", true},
+		{"wrong code", "050472", false},
+		{"too short", "50471", false},
+		{"too long", "0504710", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(rfc6238Secret, tt.code, now); ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+// TestValidateTOTPReplayStep checks that a code reports the step it was made
+// for at every time it is accepted, which is what UseStep refuses to see
+// twice.
+func TestValidateTOTPReplayStep(t *testing.T) {
+	start := time.Unix(1111111111, 0)
+	step := TOTPStep(start)
+	code, err := TOTPCode(rfc6238Secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, later := range []time.Duration{0, 10 * time.Second, totpPeriod * time.Second} {
+		matched, ok := ValidateTOTP(rfc6238Secret, code, start.Add(later))
+		if !ok || matched != step {
+			t.Errorf("%v later: got step %d, %v, want %d", later, matched, ok, step)
+		}
+	}
+}
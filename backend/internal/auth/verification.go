@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// Actions that the email verification policy can hold back from accounts
+// whose email is not verified yet.
+const (
+	ActionCreateProject = "projects:create"
+	ActionCreateTask    = "tasks:create"
+	ActionAddMember     = "members:add"
+)
+
+// VerificationPolicy is the set of actions that require a verified email.
+type VerificationPolicy struct {
+	restricted map[string]bool
+}
+
+func NewVerificationPolicy(actions ...string) VerificationPolicy {
+	policy := VerificationPolicy{restricted: make(map[string]bool)}
+	for _, action := range actions {
+		if action = strings.TrimSpace(action); action != "" {
+			policy.restricted[action] = true
+		}
+	}
+	return policy
+}
+
+// VerificationPolicyFromEnv reads the comma separated restricted actions from
+// UNVERIFIED_RESTRICTED_ACTIONS. By default unverified accounts cannot create
+// projects; set it to "none" to lift every restriction.
+func VerificationPolicyFromEnv() VerificationPolicy {
+	value := utils.GetEnvOrDefault("UNVERIFIED_RESTRICTED_ACTIONS", ActionCreateProject)
+	if value == "none" {
+		return NewVerificationPolicy()
+	}
+	return NewVerificationPolicy(strings.Split(value, ",")...)
+}
+
+// Restricts reports whether the action requires a verified email.
+func (p VerificationPolicy) Restricts(action string) bool {
+	return p.restricted[action]
+}
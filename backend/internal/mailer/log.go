@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// LogMailer writes emails to a file, or to the server log when no file is
+// set, instead of delivering them. It is meant for local development and
+// tests, where the links in the emails can be read back from the file.
+type LogMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewLogMailer(path, from string) *LogMailer {
+	return &LogMailer{path: path, from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.path == "" {
+		log.Printf("mail from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buildMessage(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+	if _, err := f.WriteString("\r\n\r\n"); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+	return nil
+}
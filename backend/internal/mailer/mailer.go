@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends transactional emails such as password reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv builds the mailer selected by MAILER. "smtp" sends through the
+// SMTP_* settings, anything else (the default "log") writes the emails to
+// MAIL_LOG_FILE or, when that is empty, to the server log.
+func NewFromEnv() (Mailer, error) {
+	from := utils.GetEnvOrDefault("MAIL_FROM", "Kira <no-reply@localhost>")
+
+	switch strings.ToLower(utils.GetEnvOrDefault("MAILER", "log")) {
+	case "smtp":
+		host := utils.GetEnvOrDefault("SMTP_HOST", "")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required when MAILER is smtp")
+		}
+		return NewSMTPMailer(
+			host,
+			utils.GetEnvOrDefault("SMTP_PORT", "587"),
+			utils.GetEnvOrDefault("SMTP_USERNAME", ""),
+			utils.GetEnvOrDefault("SMTP_PASSWORD", ""),
+			from,
+		), nil
+	default:
+		return NewLogMailer(utils.GetEnvOrDefault("MAIL_LOG_FILE", ""), from), nil
+	}
+}
@@ -2,29 +2,68 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/services"
 	"github.com/sajidcodesdotcom/kira/utils"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString, err := auth.ExtractTokenFromRequest(r)
-		if err != nil {
-			utils.RespondWithError(w, "Unauthorized, failed to get auth token from Bearer or http cookie"+err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		claims, err := auth.ValidateToken(tokenString)
-		if err != nil {
-			utils.RespondWithError(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		ctx = context.WithValue(ctx, "username", claims.Username)
-		ctx = context.WithValue(ctx, "role", claims.Role)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// AuthMiddleware authenticates the request with either a JWT access token,
+// whose session must not have been revoked by a logout, or a personal access
+// token. Personal access tokens put their scopes into the context under
+// "token_scopes" for RequireScope to check.
+func AuthMiddleware(sessionRepo services.SessionRepository, tokenRepo services.PersonalAccessTokenRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, err := auth.ExtractTokenFromRequest(r)
+			if err != nil {
+				utils.RespondWithError(w, "Unauthorized, failed to get auth token from Bearer or http cookie"+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if auth.IsPersonalAccessToken(tokenString) {
+				owner, err := tokenRepo.Authenticate(r.Context(), auth.HashOpaqueToken(tokenString))
+				if err != nil {
+					if errors.Is(err, services.ErrInvalidAccessToken) {
+						utils.RespondWithError(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+						return
+					}
+					utils.RespondWithError(w, "Failed to check token: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), "user_id", owner.UserID)
+				ctx = context.WithValue(ctx, "username", owner.Username)
+				ctx = context.WithValue(ctx, "role", owner.Role)
+				ctx = context.WithValue(ctx, "token_id", owner.TokenID)
+				ctx = context.WithValue(ctx, "token_scopes", owner.Scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			claims, err := auth.ValidateToken(tokenString)
+			if err != nil {
+				utils.RespondWithError(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			active, err := sessionRepo.IsActive(r.Context(), claims.SessionID)
+			if err != nil {
+				utils.RespondWithError(w, "Failed to check session: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				utils.RespondWithError(w, "Invalid token: session has been revoked", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+			ctx = context.WithValue(ctx, "username", claims.Username)
+			ctx = context.WithValue(ctx, "role", claims.Role)
+			ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/ratelimit"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// RateLimit limits the requests to a group of routes. Requests are counted
+// per personal access token, else per user, else per IP, so it keys by user
+// only when it runs after AuthMiddleware. Every response carries the
+// RateLimit-* headers, refused ones also Retry-After. When the store fails
+// requests are let through rather than taking the API down with it.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.Off() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := store.Take(r.Context(), group+":"+rateLimitKey(r), limit)
+			if err != nil {
+				log.Printf("rate limit check failed: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+			header.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				utils.RespondWithError(w, "Too many requests, try again later", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if tokenID, ok := r.Context().Value("token_id").(uuid.UUID); ok {
+		return "token:" + tokenID.String()
+	}
+	if userID, ok := r.Context().Value("user_id").(uuid.UUID); ok {
+		return "user:" + userID.String()
+	}
+	return "ip:" + utils.ClientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
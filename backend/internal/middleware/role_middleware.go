@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// RequirePermission only lets requests through whose role is granted the
+// permission in the auth permission table. It must run after AuthMiddleware.
+func RequirePermission(permission auth.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value("role").(string)
+			if !auth.HasPermission(role, permission) {
+				utils.RespondWithError(w, "Forbidden, missing permission "+string(permission), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
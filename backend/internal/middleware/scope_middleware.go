@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// RequireScope limits requests made with a personal access token to tokens
+// granted the scope. Requests authenticated with a login session are not
+// limited. It must run after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isToken := r.Context().Value("token_scopes").([]string)
+			if isToken && !auth.ScopeAllows(scopes, scope) {
+				utils.RespondWithError(w, "Forbidden, token is missing scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly refuses requests made with a personal access token. Account
+// settings such as tokens, passwords and two-factor can only be changed from
+// a login session. It must run after AuthMiddleware.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, isToken := r.Context().Value("token_scopes").([]string); isToken {
+			utils.RespondWithError(w, "Forbidden, personal access tokens cannot be used here", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sajidcodesdotcom/kira/internal/auth"
+	"github.com/sajidcodesdotcom/kira/internal/services"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// RequireVerifiedEmail blocks the action for users whose email is not
+// verified, when the policy restricts it. It must run after AuthMiddleware.
+func RequireVerifiedEmail(userRepo services.UserRepository, policy auth.VerificationPolicy, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !policy.Restricts(action) {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value("user_id").(uuid.UUID)
+			user, err := userRepo.GetByID(r.Context(), userID)
+			if err != nil {
+				utils.RespondWithError(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if user.EmailVerifiedAt == nil {
+				utils.RespondWithError(w, "Forbidden, please verify your email address first", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
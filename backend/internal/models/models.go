@@ -1,23 +1,30 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	FullName  string    `json:"full_name"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	Username  string    `json:"username"`
-	Role      string    `json:"role"`
-	AvatarURL string    `json:"avatar_url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uuid.UUID  `json:"id"`
+	FullName        string     `json:"full_name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	Username        string     `json:"username"`
+	Role            string     `json:"role"`
+	AvatarURL       string     `json:"avatar_url"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 func NewUser(ID uuid.UUID, fullName, email, password, username, role, avatarURL string) *User {
 	now := time.Now()
 	return &User{
@@ -39,8 +46,11 @@ type Project struct {
 	Description string    `json:"description"`
 	OwnerID     uuid.UUID `json:"owner_id"`
 	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	// RequireBlockersDone keeps tasks from being done while a task that
+	// blocks them is still open.
+	RequireBlockersDone bool      `json:"require_blockers_done"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
 }
 
 func NewProject(id uuid.UUID, name, description string, ownerId uuid.UUID, status string) *Project {
@@ -57,30 +67,604 @@ func NewProject(id uuid.UUID, name, description string, ownerId uuid.UUID, statu
 }
 
 type Task struct {
-	ID          uuid.UUID  `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	ProjectID   uuid.UUID  `json:"project_id"`
-	AssigneeID  *uuid.UUID `json:"assignee_id"`
-	Status      string     `json:"status"`
-	Priority    string     `json:"priority"`
-	DueDate     *time.Time `json:"due_date"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID                       uuid.UUID      `json:"id"`
+	Type                     string         `json:"type"`
+	ParentID                 *uuid.UUID     `json:"parent_id"`
+	Title                    string         `json:"title"`
+	Description              string         `json:"description"`
+	ProjectID                uuid.UUID      `json:"project_id"`
+	AssigneeID               *uuid.UUID     `json:"assignee_id"`
+	Status                   string         `json:"status"`
+	Position                 int            `json:"position"`
+	Priority                 string         `json:"priority"`
+	DueDate                  *time.Time     `json:"due_date"`
+	SprintID                 *uuid.UUID     `json:"sprint_id"`
+	StoryPoints              *int           `json:"story_points"`
+	OriginalEstimateMinutes  *int           `json:"original_estimate_minutes"`
+	RemainingEstimateMinutes *int           `json:"remaining_estimate_minutes"`
+	TimeSpentMinutes         int            `json:"time_spent_minutes"`
+	LabelIDs                 []uuid.UUID    `json:"label_ids"`
+	CustomFields             map[string]any `json:"custom_fields"`
+	CreatedAt                time.Time      `json:"created_at"`
+	UpdatedAt                time.Time      `json:"updated_at"`
 }
 
 func NewTask(id uuid.UUID, title, description string, productId uuid.UUID, assigneeId *uuid.UUID, status, priority string, dueDate *time.Time) *Task {
 	now := time.Now()
 	return &Task{
+		ID:           id,
+		Type:         TaskTypeTask,
+		Title:        title,
+		Description:  description,
+		ProjectID:    productId,
+		AssigneeID:   assigneeId,
+		Status:       status,
+		Priority:     priority,
+		DueDate:      dueDate,
+		LabelIDs:     []uuid.UUID{},
+		CustomFields: map[string]any{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+const (
+	TaskTypeEpic    = "epic"
+	TaskTypeStory   = "story"
+	TaskTypeTask    = "task"
+	TaskTypeBug     = "bug"
+	TaskTypeSubtask = "subtask"
+)
+
+// taskTypeLevels places each task type in the hierarchy: epics hold stories,
+// tasks and bugs, which hold subtasks.
+var taskTypeLevels = map[string]int{
+	TaskTypeEpic:    0,
+	TaskTypeStory:   1,
+	TaskTypeTask:    1,
+	TaskTypeBug:     1,
+	TaskTypeSubtask: 2,
+}
+
+// TaskTypeCanParent reports whether a task of parentType can have children of
+// childType.
+func TaskTypeCanParent(parentType, childType string) bool {
+	parentLevel, ok := taskTypeLevels[parentType]
+	childLevel, childOK := taskTypeLevels[childType]
+	return ok && childOK && childLevel == parentLevel+1
+}
+
+// TaskTypeNeedsParent reports whether a task of taskType only exists under a
+// parent.
+func TaskTypeNeedsParent(taskType string) bool {
+	return taskType == TaskTypeSubtask
+}
+
+// TaskStatusDone is the status of a finished task in the default workflow.
+const TaskStatusDone = "done"
+
+const (
+	StatusCategoryTodo       = "todo"
+	StatusCategoryInProgress = "in_progress"
+	StatusCategoryDone       = "done"
+)
+
+const (
+	// GuardAssigneeOnly lets only the task's assignee take the transition.
+	GuardAssigneeOnly = "assignee_only"
+	// GuardAdminOnly lets only project admins and owners take the transition.
+	GuardAdminOnly = "admin_only"
+	// GuardSubtasksDone holds the transition back until every child task is
+	// done.
+	GuardSubtasksDone = "subtasks_done"
+)
+
+// WorkflowGuardValid reports whether guard is one of the known guards.
+func WorkflowGuardValid(guard string) bool {
+	switch guard {
+	case GuardAssigneeOnly, GuardAdminOnly, GuardSubtasksDone:
+		return true
+	}
+	return false
+}
+
+type WorkflowStatus struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// WorkflowTransition allows moving a task from one status to another. A nil
+// From allows it from any status.
+type WorkflowTransition struct {
+	From   *string  `json:"from"`
+	To     string   `json:"to"`
+	Guards []string `json:"guards"`
+}
+
+// Workflow is the set of statuses a project's tasks go through, in board
+// order, and the transitions between them. A workflow without transitions
+// lets tasks move freely between its statuses.
+//
+// Projects that haven't defined a workflow get the default one, which keeps
+// task statuses free-form with the board columns as its known statuses.
+type Workflow struct {
+	ProjectID   uuid.UUID            `json:"project_id"`
+	Default     bool                 `json:"default"`
+	Statuses    []WorkflowStatus     `json:"statuses"`
+	Transitions []WorkflowTransition `json:"transitions"`
+}
+
+func DefaultWorkflow(projectID uuid.UUID) *Workflow {
+	return &Workflow{
+		ProjectID: projectID,
+		Default:   true,
+		Statuses: []WorkflowStatus{
+			{Key: "todo", Name: "To Do", Category: StatusCategoryTodo},
+			{Key: "in_progress", Name: "In Progress", Category: StatusCategoryInProgress},
+			{Key: "in_review", Name: "In Review", Category: StatusCategoryInProgress},
+			{Key: TaskStatusDone, Name: "Done", Category: StatusCategoryDone},
+		},
+		Transitions: []WorkflowTransition{},
+	}
+}
+
+// Status returns the workflow status with the key.
+func (w *Workflow) Status(key string) (WorkflowStatus, bool) {
+	for _, status := range w.Statuses {
+		if status.Key == key {
+			return status, true
+		}
+	}
+	return WorkflowStatus{}, false
+}
+
+// IsDone reports whether a task with the status is finished.
+func (w *Workflow) IsDone(key string) bool {
+	status, ok := w.Status(key)
+	return ok && status.Category == StatusCategoryDone
+}
+
+// DoneStatuses returns the keys of the statuses in the done category.
+func (w *Workflow) DoneStatuses() []string {
+	keys := []string{}
+	for _, status := range w.Statuses {
+		if status.Category == StatusCategoryDone {
+			keys = append(keys, status.Key)
+		}
+	}
+	return keys
+}
+
+// StatusKeys returns the keys of every status in board order.
+func (w *Workflow) StatusKeys() []string {
+	keys := make([]string, 0, len(w.Statuses))
+	for _, status := range w.Statuses {
+		keys = append(keys, status.Key)
+	}
+	return keys
+}
+
+// Transition returns the transition that moves a task from one status to
+// another. A transition from that exact status wins over one from any status.
+func (w *Workflow) Transition(from, to string) (WorkflowTransition, bool) {
+	var fromAny *WorkflowTransition
+	for i, transition := range w.Transitions {
+		if transition.To != to {
+			continue
+		}
+		if transition.From == nil {
+			if fromAny == nil {
+				fromAny = &w.Transitions[i]
+			}
+			continue
+		}
+		if *transition.From == from {
+			return transition, true
+		}
+	}
+	if fromAny != nil {
+		return *fromAny, true
+	}
+	return WorkflowTransition{}, false
+}
+
+// InitialStatus is the status new tasks get: the first status of the todo
+// category.
+func (w *Workflow) InitialStatus() string {
+	for _, status := range w.Statuses {
+		if status.Category == StatusCategoryTodo {
+			return status.Key
+		}
+	}
+	return w.Statuses[0].Key
+}
+
+const (
+	ProjectRoleOwner  = "owner"
+	ProjectRoleAdmin  = "admin"
+	ProjectRoleMember = "member"
+	ProjectRoleViewer = "viewer"
+)
+
+// projectRoleRanks orders the project roles, each role can do everything
+// the roles ranked below it can.
+var projectRoleRanks = map[string]int{
+	ProjectRoleViewer: 1,
+	ProjectRoleMember: 2,
+	ProjectRoleAdmin:  3,
+	ProjectRoleOwner:  4,
+}
+
+// ProjectRoleAtLeast reports whether role grants at least the rights of min.
+func ProjectRoleAtLeast(role, min string) bool {
+	rank, ok := projectRoleRanks[role]
+	return ok && rank >= projectRoleRanks[min]
+}
+
+type ProjectMember struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username,omitempty"`
+	FullName  string    `json:"full_name,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewProjectMember(projectID, userID uuid.UUID, role string) *ProjectMember {
+	now := time.Now()
+	return &ProjectMember{
+		ProjectID: projectID,
+		UserID:    userID,
+		Role:      role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+const (
+	SprintPlanned = "planned"
+	SprintActive  = "active"
+	SprintClosed  = "closed"
+)
+
+// Sprint is a time-boxed iteration of a project. A sprint is planned, then
+// started, then closed, and a project has at most one active sprint.
+type Sprint struct {
+	ID        uuid.UUID  `json:"id"`
+	ProjectID uuid.UUID  `json:"project_id"`
+	Name      string     `json:"name"`
+	Goal      string     `json:"goal"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   time.Time  `json:"end_date"`
+	Status    string     `json:"status"`
+	StartedAt *time.Time `json:"started_at"`
+	ClosedAt  *time.Time `json:"closed_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func NewSprint(id, projectID uuid.UUID, name, goal string, startDate, endDate time.Time) *Sprint {
+	now := time.Now()
+	return &Sprint{
+		ID:        id,
+		ProjectID: projectID,
+		Name:      name,
+		Goal:      goal,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Status:    SprintPlanned,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Session is one login of a user on one device. Every refresh token issued
+// for that login belongs to the same session, so revoking the session revokes
+// the whole token family.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func NewSession(id, userID uuid.UUID, userAgent, ip string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// TwoFactor is a user's TOTP enrollment. The secret is stored encrypted and
+// the enrollment only counts once EnabledAt is set, after the user proved
+// their authenticator app produces valid codes.
+type TwoFactor struct {
+	UserID          uuid.UUID
+	SecretEncrypted string
+	EnabledAt       *time.Time
+	LastUsedStep    *int64
+	CreatedAt       time.Time
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func NewPersonalAccessToken(id, userID uuid.UUID, name, prefix string, scopes []string, expiresAt *time.Time) *PersonalAccessToken {
+	return &PersonalAccessToken{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Comment is a Markdown comment on a task. Replies point to the comment they
+// answer through ParentID. Deleted comments keep their place in the thread
+// with an empty body.
+type Comment struct {
+	ID             uuid.UUID   `json:"id"`
+	TaskID         uuid.UUID   `json:"task_id"`
+	AuthorID       uuid.UUID   `json:"author_id"`
+	AuthorUsername string      `json:"author_username"`
+	ParentID       *uuid.UUID  `json:"parent_id"`
+	Body           string      `json:"body"`
+	Mentions       []uuid.UUID `json:"mentions"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	DeletedAt      *time.Time  `json:"deleted_at,omitempty"`
+	Replies        []*Comment  `json:"replies,omitempty"`
+}
+
+func NewComment(id, taskID, authorID uuid.UUID, parentID *uuid.UUID, body string) *Comment {
+	now := time.Now()
+	return &Comment{
+		ID:        id,
+		TaskID:    taskID,
+		AuthorID:  authorID,
+		ParentID:  parentID,
+		Body:      body,
+		Mentions:  []uuid.UUID{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+const (
+	TaskLinkBlocks     = "blocks"
+	TaskLinkRelatesTo  = "relates_to"
+	TaskLinkDuplicates = "duplicates"
+)
+
+// TaskLink relates two tasks of a project: the source blocks, relates to or
+// duplicates the target. Blocked-by and duplicated-by are the same links seen
+// from the target.
+type TaskLink struct {
+	ID           uuid.UUID  `json:"id"`
+	SourceTaskID uuid.UUID  `json:"source_task_id"`
+	TargetTaskID uuid.UUID  `json:"target_task_id"`
+	Type         string     `json:"type"`
+	CreatedBy    *uuid.UUID `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func NewTaskLink(id, sourceTaskID, targetTaskID uuid.UUID, linkType string, createdBy uuid.UUID) *TaskLink {
+	return &TaskLink{
+		ID:           id,
+		SourceTaskID: sourceTaskID,
+		TargetTaskID: targetTaskID,
+		Type:         linkType,
+		CreatedBy:    &createdBy,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Label tags tasks of a project for triage, such as bug or tech-debt. Color
+// is a hex color like #d73a4a.
+type Label struct {
+	ID        uuid.UUID `json:"id"`
+	ProjectID uuid.UUID `json:"project_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewLabel(id, projectID uuid.UUID, name, color string) *Label {
+	now := time.Now()
+	return &Label{
+		ID:        id,
+		ProjectID: projectID,
+		Name:      name,
+		Color:     color,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+const (
+	CustomFieldText         = "text"
+	CustomFieldNumber       = "number"
+	CustomFieldDate         = "date"
+	CustomFieldSingleSelect = "single_select"
+	CustomFieldMultiSelect  = "multi_select"
+	CustomFieldUser         = "user"
+)
+
+// CustomField is a field a project adds to its tasks. Options are the
+// choices of single and multi select fields.
+type CustomField struct {
+	ID        uuid.UUID `json:"id"`
+	ProjectID uuid.UUID `json:"project_id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Options   []string  `json:"options"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CustomFieldHasOptions reports whether fields of the type pick their values
+// from a list of options.
+func CustomFieldHasOptions(fieldType string) bool {
+	return fieldType == CustomFieldSingleSelect || fieldType == CustomFieldMultiSelect
+}
+
+func NewCustomField(id, projectID uuid.UUID, name, fieldType string, options []string) *CustomField {
+	now := time.Now()
+	if options == nil {
+		options = []string{}
+	}
+	return &CustomField{
+		ID:        id,
+		ProjectID: projectID,
+		Name:      name,
+		Type:      fieldType,
+		Options:   options,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Worklog is time a user spent on a task on one day.
+type Worklog struct {
+	ID        uuid.UUID `json:"id"`
+	TaskID    uuid.UUID `json:"task_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	WorkDate  time.Time `json:"work_date"`
+	Minutes   int       `json:"minutes"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewWorklog(id, taskID, userID uuid.UUID, workDate time.Time, minutes int, comment string) *Worklog {
+	now := time.Now()
+	return &Worklog{
+		ID:        id,
+		TaskID:    taskID,
+		UserID:    userID,
+		WorkDate:  workDate,
+		Minutes:   minutes,
+		Comment:   comment,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+const (
+	ActivityEntityTask    = "task"
+	ActivityEntityProject = "project"
+)
+
+const (
+	ActivityCreated = "created"
+	ActivityUpdated = "updated"
+	ActivityMoved   = "moved"
+	ActivityDeleted = "deleted"
+)
+
+// Activity is one entry of the append-only history of a task or project. An
+// update produces one entry per changed field with its old and new value as
+// JSON.
+type Activity struct {
+	ID            int64           `json:"id"`
+	ProjectID     uuid.UUID       `json:"project_id"`
+	EntityType    string          `json:"entity_type"`
+	EntityID      uuid.UUID       `json:"entity_id"`
+	ActorID       *uuid.UUID      `json:"actor_id"`
+	ActorUsername *string         `json:"actor_username"`
+	Action        string          `json:"action"`
+	Field         *string         `json:"field,omitempty"`
+	OldValue      json.RawMessage `json:"old_value,omitempty"`
+	NewValue      json.RawMessage `json:"new_value,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+const (
+	AuditLoginSucceeded  = "auth.login_succeeded"
+	AuditLoginFailed     = "auth.login_failed"
+	AuditLogout          = "auth.logout"
+	AuditLogoutAll       = "auth.logout_all"
+	AuditLoginUnlocked   = "auth.login_unlocked"
+	AuditUserRoleChanged = "user.role_changed"
+	AuditUserDeleted     = "user.deleted"
+	AuditTokenCreated    = "token.created"
+	AuditTokenRevoked    = "token.revoked"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+const (
+	AuditTargetUser  = "user"
+	AuditTargetToken = "personal_access_token"
+	AuditTargetIP    = "ip"
+)
+
+// AuditLog is one entry of the tamper-evident audit log. Each entry's Hash
+// covers its own fields and the Hash of the entry before it, so changing or
+// removing an entry breaks the chain from there on.
+type AuditLog struct {
+	ID         int64             `json:"id"`
+	EventType  string            `json:"event_type"`
+	Outcome    string            `json:"outcome"`
+	ActorID    *uuid.UUID        `json:"actor_id"`
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty"`
+	IP         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	RequestID  string            `json:"request_id"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+// UserIdentity links a user to their account at an external OpenID Connect
+// provider, identified by the provider's issuer and subject.
+type UserIdentity struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func NewUserIdentity(id, userID uuid.UUID, issuer, subject, email string) *UserIdentity {
+	now := time.Now()
+	return &UserIdentity{
 		ID:          id,
-		Title:       title,
-		Description: description,
-		ProjectID:   productId,
-		AssigneeID:  assigneeId,
-		Status:      status,
-		Priority:    priority,
-		DueDate:     dueDate,
+		UserID:      userID,
+		Issuer:      issuer,
+		Subject:     subject,
+		Email:       email,
 		CreatedAt:   now,
-		UpdatedAt:   now,
+		LastLoginAt: now,
 	}
 }
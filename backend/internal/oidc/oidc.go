@@ -0,0 +1,233 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+var ErrNotConfigured = errors.New("single sign-on is not configured")
+
+// Config describes the OpenID Connect provider Kira logs users in through.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AllowedEmailDomains limits logins to these email domains. Empty allows
+	// every domain.
+	AllowedEmailDomains []string
+	// AutoProvision creates an account on the first login of someone who does
+	// not have one yet.
+	AutoProvision bool
+	// SkipTwoFactor trusts the provider's login alone for users who enrolled
+	// in two-factor authentication. Off by default, so those users are asked
+	// for their code after single sign-on as after a password.
+	SkipTwoFactor bool
+}
+
+// ConfigFromEnv reads the OIDC_* settings. It returns ErrNotConfigured when
+// OIDC_ISSUER is empty, so single sign-on stays off by default.
+func ConfigFromEnv() (Config, error) {
+	issuer := strings.TrimSuffix(utils.GetEnvOrDefault("OIDC_ISSUER", ""), "/")
+	if issuer == "" {
+		return Config{}, ErrNotConfigured
+	}
+	clientID := utils.GetEnvOrDefault("OIDC_CLIENT_ID", "")
+	if clientID == "" {
+		return Config{}, fmt.Errorf("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+
+	var domains []string
+	for _, domain := range strings.Split(utils.GetEnvOrDefault("OIDC_ALLOWED_EMAIL_DOMAINS", ""), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	return Config{
+		Issuer:              issuer,
+		ClientID:            clientID,
+		ClientSecret:        utils.GetEnvOrDefault("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:         utils.GetEnvOrDefault("OIDC_REDIRECT_URL", "http://localhost:8080/api/auth/oidc/callback"),
+		Scopes:              strings.Fields(utils.GetEnvOrDefault("OIDC_SCOPES", "openid email profile")),
+		AllowedEmailDomains: domains,
+		AutoProvision:       utils.GetEnvOrDefault("OIDC_AUTO_PROVISION", "true") == "true",
+		SkipTwoFactor:       utils.GetEnvOrDefault("OIDC_SKIP_TWO_FACTOR", "false") == "true",
+	}, nil
+}
+
+// EmailAllowed reports whether the email's domain is on the allowlist.
+func (c Config) EmailAllowed(email string) bool {
+	if len(c.AllowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range c.AllowedEmailDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// discovery is the part of the provider's discovery document Kira uses.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one OpenID Connect provider. The discovery document and
+// signing keys are fetched on first use and cached, so the server starts even
+// when the provider is unreachable.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *keySet
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) Config() Config {
+	return p.config
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discovery
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", doc.Issuer, p.config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing an endpoint")
+	}
+
+	p.discovery = &doc
+	p.keys = newKeySet(doc.JWKSURI, p.getJSON)
+	return p.discovery, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// AuthCodeURL returns the provider URL the user is sent to for logging in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the authorization code and returns the verified claims of
+// the ID token that came with it.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDTokenClaims, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, token.IDToken, nonce)
+}
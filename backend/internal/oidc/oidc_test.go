@@ -0,0 +1,258 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "kira"
+	testKeyID    = "test-key"
+	testNonce    = "test-nonce"
+)
+
+// testIssuer is a provider serving discovery, its signing key and a token
+// endpoint that hands out whatever ID token the test set.
+type testIssuer struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: testKeyID,
+			Use: "sig",
+			N:   encode(key.N.Bytes()),
+			E:   encode(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "authorization_code" || r.FormValue("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{IDToken: issuer.idToken})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:      i.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}, i.server.Client())
+}
+
+// claims are the claims of a token the provider accepts.
+func (i *testIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.server.URL,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          testNonce,
+		"email":          "ada@example.com",
+		"email_verified": "true",
+	}
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		key    *rsa.PrivateKey
+		kid    string
+		nonce  string
+		ok     bool
+	}{
+		{name: "valid", ok: true},
+		{name: "wrong nonce", nonce: "other-nonce"},
+		{name: "missing nonce", change: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "wrong audience", change: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "several audiences without azp", change: func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "someone-else"} }},
+		{name: "several audiences with other azp", change: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "someone-else"}
+			c["azp"] = "someone-else"
+		}},
+		{name: "several audiences with azp", change: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "someone-else"}
+			c["azp"] = testClientID
+		}, ok: true},
+		{name: "expired", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-5 * time.Minute).Unix() }},
+		{name: "expired within leeway", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }, ok: true},
+		{name: "missing expiry", change: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", change: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "wrong issuer", change: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "missing subject", change: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "signed with another key", key: otherKey},
+		{name: "unknown key id", kid: "other-key"},
+	}
+	for _, tt := range tests {
+		claims := issuer.claims()
+		if tt.change != nil {
+			tt.change(claims)
+		}
+		key, kid, nonce := issuer.key, testKeyID, testNonce
+		if tt.key != nil {
+			key = tt.key
+		}
+		if tt.kid != "" {
+			kid = tt.kid
+		}
+		if tt.nonce != "" {
+			nonce = tt.nonce
+		}
+		issuer.idToken = issuer.sign(t, claims, key, kid)
+
+		got, err := issuer.provider().Exchange(context.Background(), "code", "verifier", nonce)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("%s: token was accepted", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.Subject != "user-1" || got.Email != "ada@example.com" || !bool(got.EmailVerified) {
+			t.Errorf("%s: claims = %+v", tt.name, got)
+		}
+	}
+}
+
+func TestExchangeRejectsUnsignedToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, issuer.claims())
+	token.Header["kid"] = testKeyID
+	unsigned, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.idToken = unsigned
+
+	if _, err := issuer.provider().Exchange(context.Background(), "code", "verifier", testNonce); err == nil {
+		t.Error("unsigned token was accepted")
+	}
+}
+
+func TestExchangeRejectsTokenError(t *testing.T) {
+	issuer := newTestIssuer(t)
+	if _, err := issuer.provider().Exchange(context.Background(), "wrong-code", "verifier", testNonce); err == nil {
+		t.Error("token endpoint error was ignored")
+	}
+}
+
+func TestGetDiscoveryRejectsOtherIssuer(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+	provider.config.Issuer = strings.Replace(issuer.server.URL, "127.0.0.1", "localhost", 1)
+	provider.client = &http.Client{Transport: rewriteHost{to: issuer.server.Listener.Addr().String()}}
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", testNonce, "challenge"); err == nil {
+		t.Error("discovery document of another issuer was accepted")
+	}
+}
+
+// rewriteHost sends every request to one address whatever its URL says.
+type rewriteHost struct {
+	to string
+}
+
+func (rt rewriteHost) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Host = rt.to
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := issuer.provider().AuthCodeURL(context.Background(), "the-state", testNonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := authURL.Scheme+"://"+authURL.Host+authURL.Path, issuer.server.URL+"/authorize"; got != want {
+		t.Errorf("endpoint = %s, want %s", got, want)
+	}
+
+	query := authURL.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 testNonce,
+		"code_challenge":        CodeChallenge(verifier),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
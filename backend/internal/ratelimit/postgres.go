@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgStore keeps the buckets in Postgres so every replica shares the same
+// limits. Time is taken from the database, so clock skew between replicas
+// doesn't matter.
+type PgStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPgStore(db *pgxpool.Pool) *PgStore {
+	return &PgStore{db: db}
+}
+
+func (s *PgStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to begin rate limit transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the no-op update locks an existing bucket until the transaction ends
+	query := `
+	insert into rate_limit_buckets as b (key, tokens, updated_at, expires_at)
+	values ($1, $2, now(), now())
+	on conflict (key) do update set tokens = b.tokens
+	returning tokens, extract(epoch from now() - updated_at)::float8
+	`
+	var tokens, elapsed float64
+	if err := tx.QueryRow(ctx, query, key, limit.Requests).Scan(&tokens, &elapsed); err != nil {
+		return Result{}, fmt.Errorf("failed to get rate limit bucket: %w", err)
+	}
+
+	tokens, result := take(tokens, seconds(elapsed), limit)
+
+	updateQuery := `
+	update rate_limit_buckets
+	set tokens = $2, updated_at = now(), expires_at = now() + make_interval(secs => $3)
+	where key = $1
+	`
+	if _, err := tx.Exec(ctx, updateQuery, key, tokens, result.Reset.Seconds()); err != nil {
+		return Result{}, fmt.Errorf("failed to update rate limit bucket: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Result{}, fmt.Errorf("failed to commit rate limit bucket: %w", err)
+	}
+	return result, nil
+}
+
+// Prune deletes the buckets that have refilled completely, every interval
+// until ctx is done.
+func (s *PgStore) Prune(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.Exec(ctx, `delete from rate_limit_buckets where expires_at < now()`); err != nil && ctx.Err() == nil {
+				log.Printf("failed to prune rate limit buckets: %v", err)
+			}
+		}
+	}
+}
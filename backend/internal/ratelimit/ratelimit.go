@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/utils"
+)
+
+// Limit allows Requests requests per Period. Limits are token buckets: a
+// client can spend the whole allowance in a burst, after which it refills
+// steadily over the period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Off reports whether the limit lets everything through.
+func (l Limit) Off() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// ratePerSecond is how fast the bucket refills.
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseLimit reads a limit such as "100/m", "10/s", "1000/h" or "300/5m".
+// "off" disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return Limit{}, nil
+	}
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected requests/period", value)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive number", value)
+	}
+
+	switch period {
+	case "s":
+		period = "1s"
+	case "m":
+		period = "1m"
+	case "h":
+		period = "1h"
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad period", value)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// LimitFromEnv reads the limit from the env, falling back to defaultValue
+// when it is unset.
+func LimitFromEnv(key string, defaultValue Limit) (Limit, error) {
+	value := utils.GetEnvOrDefault(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+	limit, err := ParseLimit(value)
+	if err != nil {
+		return Limit{}, fmt.Errorf("%s: %w", key, err)
+	}
+	return limit, nil
+}
+
+// Result is the outcome of taking a request from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when
+	// this one was.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Take spends one request from the key's bucket.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// NewStoreFromEnv builds the store selected by RATE_LIMIT_STORE. "postgres"
+// shares the limits between all replicas through the database and prunes
+// full buckets in the background, anything else (the default "memory") keeps
+// them in this process.
+func NewStoreFromEnv(db *pgxpool.Pool) Store {
+	switch strings.ToLower(utils.GetEnvOrDefault("RATE_LIMIT_STORE", "memory")) {
+	case "postgres":
+		store := NewPgStore(db)
+		go store.Prune(context.Background(), 10*time.Minute)
+		return store
+	default:
+		return NewMemoryStore()
+	}
+}
+
+// take refills a bucket that held tokens elapsed ago and spends one request
+// from it, returning the tokens left and the result.
+func take(tokens float64, elapsed time.Duration, limit Limit) (float64, Result) {
+	capacity := float64(limit.Requests)
+	rate := limit.ratePerSecond()
+	tokens = math.Min(capacity, tokens+elapsed.Seconds()*rate)
+
+	result := Result{Limit: limit}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((capacity - tokens) / rate)
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
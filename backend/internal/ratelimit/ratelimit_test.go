@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "100/m", want: Limit{Requests: 100, Period: time.Minute}},
+		{value: "10/s", want: Limit{Requests: 10, Period: time.Second}},
+		{value: "1000/h", want: Limit{Requests: 1000, Period: time.Hour}},
+		{value: "300/5m", want: Limit{Requests: 300, Period: 5 * time.Minute}},
+		{value: " 5/30s ", want: Limit{Requests: 5, Period: 30 * time.Second}},
+		{value: "off", want: Limit{}},
+		{value: "", wantErr: true},
+		{value: "100", wantErr: true},
+		{value: "0/m", wantErr: true},
+		{value: "-1/m", wantErr: true},
+		{value: "abc/m", wantErr: true},
+		{value: "10/", wantErr: true},
+		{value: "10/d", wantErr: true},
+		{value: "10/0s", wantErr: true},
+		{value: "10/-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLimit(%q) = %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLimit(%q): %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLimitOff(t *testing.T) {
+	off, err := ParseLimit("off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !off.Off() {
+		t.Error("off limit isn't off")
+	}
+	if (Limit{Requests: 1, Period: time.Second}).Off() {
+		t.Error("1/s limit is off")
+	}
+}
+
+func TestTake(t *testing.T) {
+	// 60 requests a minute refill one token a second
+	limit := Limit{Requests: 60, Period: time.Minute}
+
+	tests := []struct {
+		name          string
+		tokens        float64
+		elapsed       time.Duration
+		wantTokens    float64
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+		wantReset     time.Duration
+	}{
+		{
+			name: "full bucket", tokens: 60, elapsed: 0,
+			wantTokens: 59, wantAllowed: true, wantRemaining: 59, wantReset: time.Second,
+		},
+		{
+			name: "refill is capped at capacity", tokens: 60, elapsed: time.Hour,
+			wantTokens: 59, wantAllowed: true, wantRemaining: 59, wantReset: time.Second,
+		},
+		{
+			name: "last token", tokens: 1, elapsed: 0,
+			wantTokens: 0, wantAllowed: true, wantRemaining: 0, wantReset: time.Minute,
+		},
+		{
+			name: "empty bucket", tokens: 0, elapsed: 0,
+			wantTokens: 0, wantAllowed: false, wantRemaining: 0, wantRetry: time.Second, wantReset: time.Minute,
+		},
+		{
+			name: "half refilled token", tokens: 0, elapsed: 500 * time.Millisecond,
+			wantTokens: 0.5, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond, wantReset: 59500 * time.Millisecond,
+		},
+		{
+			name: "refilled token", tokens: 0, elapsed: time.Second,
+			wantTokens: 0, wantAllowed: true, wantRemaining: 0, wantReset: time.Minute,
+		},
+		{
+			name: "partial refill", tokens: 10, elapsed: 5 * time.Second,
+			wantTokens: 14, wantAllowed: true, wantRemaining: 14, wantReset: 46 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		tokens, result := take(tt.tokens, tt.elapsed, limit)
+		if tokens != tt.wantTokens {
+			t.Errorf("%s: tokens = %v, want %v", tt.name, tokens, tt.wantTokens)
+		}
+		if result.Allowed != tt.wantAllowed {
+			t.Errorf("%s: allowed = %v, want %v", tt.name, result.Allowed, tt.wantAllowed)
+		}
+		if result.Remaining != tt.wantRemaining {
+			t.Errorf("%s: remaining = %d, want %d", tt.name, result.Remaining, tt.wantRemaining)
+		}
+		if result.RetryAfter != tt.wantRetry {
+			t.Errorf("%s: retry after = %v, want %v", tt.name, result.RetryAfter, tt.wantRetry)
+		}
+		if result.Reset != tt.wantReset {
+			t.Errorf("%s: reset = %v, want %v", tt.name, result.Reset, tt.wantReset)
+		}
+		if result.Limit != limit {
+			t.Errorf("%s: limit = %+v, want %+v", tt.name, result.Limit, limit)
+		}
+	}
+}
+
+// TestTakeBurst spends a whole bucket at once and checks that exactly its
+// capacity gets through.
+func TestTakeBurst(t *testing.T) {
+	limit := Limit{Requests: 5, Period: time.Minute}
+	tokens := float64(limit.Requests)
+	allowed := 0
+	for range 10 {
+		var result Result
+		tokens, result = take(tokens, 0, limit)
+		if result.Allowed {
+			allowed++
+		}
+	}
+	if allowed != limit.Requests {
+		t.Errorf("burst allowed %d requests, want %d", allowed, limit.Requests)
+	}
+}
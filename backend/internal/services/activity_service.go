@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+type ActivityRepository interface {
+	ListByEntity(ctx context.Context, entityType string, entityID uuid.UUID, limit, offset int) ([]*models.Activity, error)
+	ListByProject(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]*models.Activity, error)
+}
+
+type PgActivityRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgActivityRepository(db *pgxpool.Pool) *PgActivityRepository {
+	return &PgActivityRepository{db: db}
+}
+
+// fieldChange is a changed field with its values before and after.
+type fieldChange struct {
+	field    string
+	oldValue any
+	newValue any
+}
+
+// activity is what a mutation records. Repositories write it with
+// recordActivity inside their own transaction, so the history never misses
+// or invents a change.
+type activity struct {
+	projectID  uuid.UUID
+	entityType string
+	entityID   uuid.UUID
+	actorID    uuid.UUID
+	action     string
+	changes    []fieldChange
+}
+
+// recordActivity appends one entry per changed field, or a single entry
+// without a field when there are no changes to list. An update that changed
+// nothing records nothing.
+func recordActivity(ctx context.Context, tx pgx.Tx, a activity) error {
+	if a.action == models.ActivityUpdated && len(a.changes) == 0 {
+		return nil
+	}
+	changes := a.changes
+	if len(changes) == 0 {
+		changes = []fieldChange{{}}
+	}
+
+	var actorID *uuid.UUID
+	if a.actorID != uuid.Nil {
+		actorID = &a.actorID
+	}
+
+	query := `
+	insert into activities (project_id, entity_type, entity_id, actor_id, action, field, old_value, new_value)
+	values ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for _, change := range changes {
+		var field *string
+		var oldValue, newValue []byte
+		if change.field != "" {
+			field = &change.field
+			var err error
+			if oldValue, err = json.Marshal(change.oldValue); err != nil {
+				return fmt.Errorf("failed to encode activity value: %w", err)
+			}
+			if newValue, err = json.Marshal(change.newValue); err != nil {
+				return fmt.Errorf("failed to encode activity value: %w", err)
+			}
+		}
+		if _, err := tx.Exec(ctx, query, a.projectID, a.entityType, a.entityID, actorID, a.action, field, oldValue, newValue); err != nil {
+			return fmt.Errorf("failed to record activity: %w", err)
+		}
+	}
+	return nil
+}
+
+// diffField adds a change to changes when the values differ.
+func diffField[T comparable](changes []fieldChange, field string, oldValue, newValue T) []fieldChange {
+	if oldValue == newValue {
+		return changes
+	}
+	return append(changes, fieldChange{field: field, oldValue: oldValue, newValue: newValue})
+}
+
+func diffOptionalID(changes []fieldChange, field string, oldValue, newValue *uuid.UUID) []fieldChange {
+	if oldValue == nil && newValue == nil || oldValue != nil && newValue != nil && *oldValue == *newValue {
+		return changes
+	}
+	return append(changes, fieldChange{field: field, oldValue: oldValue, newValue: newValue})
+}
+
+func diffOptionalTime(changes []fieldChange, field string, oldValue, newValue *time.Time) []fieldChange {
+	if oldValue == nil && newValue == nil || oldValue != nil && newValue != nil && oldValue.Equal(*newValue) {
+		return changes
+	}
+	return append(changes, fieldChange{field: field, oldValue: oldValue, newValue: newValue})
+}
+
+func diffOptionalInt(changes []fieldChange, field string, oldValue, newValue *int) []fieldChange {
+	if oldValue == nil && newValue == nil || oldValue != nil && newValue != nil && *oldValue == *newValue {
+		return changes
+	}
+	return append(changes, fieldChange{field: field, oldValue: oldValue, newValue: newValue})
+}
+
+// diffIDs compares two sorted ID lists.
+func diffIDs(changes []fieldChange, field string, oldValue, newValue []uuid.UUID) []fieldChange {
+	if slices.Equal(oldValue, newValue) {
+		return changes
+	}
+	return append(changes, fieldChange{field: field, oldValue: oldValue, newValue: newValue})
+}
+
+func diffTask(oldTask, newTask *models.Task) []fieldChange {
+	var changes []fieldChange
+	changes = diffField(changes, "type", oldTask.Type, newTask.Type)
+	changes = diffOptionalID(changes, "parent_id", oldTask.ParentID, newTask.ParentID)
+	changes = diffField(changes, "title", oldTask.Title, newTask.Title)
+	changes = diffField(changes, "description", oldTask.Description, newTask.Description)
+	changes = diffOptionalID(changes, "assignee_id", oldTask.AssigneeID, newTask.AssigneeID)
+	changes = diffField(changes, "status", oldTask.Status, newTask.Status)
+	changes = diffField(changes, "priority", oldTask.Priority, newTask.Priority)
+	changes = diffOptionalTime(changes, "due_date", oldTask.DueDate, newTask.DueDate)
+	changes = diffOptionalInt(changes, "story_points", oldTask.StoryPoints, newTask.StoryPoints)
+	changes = diffOptionalInt(changes, "original_estimate_minutes", oldTask.OriginalEstimateMinutes, newTask.OriginalEstimateMinutes)
+	changes = diffOptionalInt(changes, "remaining_estimate_minutes", oldTask.RemainingEstimateMinutes, newTask.RemainingEstimateMinutes)
+	changes = diffIDs(changes, "label_ids", oldTask.LabelIDs, newTask.LabelIDs)
+	return changes
+}
+
+func diffProject(oldProject, newProject *models.Project) []fieldChange {
+	var changes []fieldChange
+	changes = diffField(changes, "name", oldProject.Name, newProject.Name)
+	changes = diffField(changes, "description", oldProject.Description, newProject.Description)
+	changes = diffField(changes, "status", oldProject.Status, newProject.Status)
+	changes = diffField(changes, "owner_id", oldProject.OwnerID, newProject.OwnerID)
+	changes = diffField(changes, "require_blockers_done", oldProject.RequireBlockersDone, newProject.RequireBlockersDone)
+	return changes
+}
+
+// activitySelect selects activities with their actor's username, in the
+// order scanActivity reads them.
+const activitySelect = `
+	select a.id, a.project_id, a.entity_type, a.entity_id, a.actor_id, u.username, a.action, a.field, a.old_value, a.new_value, a.created_at
+	from activities a
+	left join users u on u.id = a.actor_id
+	`
+
+// ListByEntity returns the history of one task or project, newest first.
+func (r *PgActivityRepository) ListByEntity(ctx context.Context, entityType string, entityID uuid.UUID, limit, offset int) ([]*models.Activity, error) {
+	query := activitySelect + `
+	where a.entity_type = $1 and a.entity_id = $2
+	order by a.id desc
+	limit $3 offset $4
+	`
+	return r.list(ctx, query, entityType, entityID, limit, offset)
+}
+
+// ListByProject returns the activity feed of a project and its tasks, newest
+// first.
+func (r *PgActivityRepository) ListByProject(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]*models.Activity, error) {
+	query := activitySelect + `
+	where a.project_id = $1
+	order by a.id desc
+	limit $2 offset $3
+	`
+	return r.list(ctx, query, projectID, limit, offset)
+}
+
+func (r *PgActivityRepository) list(ctx context.Context, query string, args ...any) ([]*models.Activity, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activities: %w", err)
+	}
+	defer rows.Close()
+
+	var activities []*models.Activity
+	for rows.Next() {
+		a := &models.Activity{}
+		err := rows.Scan(&a.ID, &a.ProjectID, &a.EntityType, &a.EntityID, &a.ActorID, &a.ActorUsername, &a.Action, &a.Field, &a.OldValue, &a.NewValue, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		activities = append(activities, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating activity rows: %w", err)
+	}
+
+	return activities, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+type CommentRepository interface {
+	Create(ctx context.Context, comment *models.Comment) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Comment, error)
+	Update(ctx context.Context, comment *models.Comment) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListByTask(ctx context.Context, taskID uuid.UUID) ([]*models.Comment, error)
+}
+
+// commentSelect selects comments with their author's username and the ids of
+// the users they mention, in the order scanComment reads them.
+const commentSelect = `
+	select c.id, c.task_id, c.author_id, u.username, c.parent_id, c.body,
+		coalesce(array_agg(m.user_id) filter (where m.user_id is not null), '{}'),
+		c.created_at, c.updated_at, c.deleted_at
+	from task_comments c
+	join users u on u.id = c.author_id
+	left join task_comment_mentions m on m.comment_id = c.id
+	`
+
+type PgCommentRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgCommentRepository(db *pgxpool.Pool) *PgCommentRepository {
+	return &PgCommentRepository{db: db}
+}
+
+func scanComment(row pgx.Row) (*models.Comment, error) {
+	comment := &models.Comment{}
+	err := row.Scan(
+		&comment.ID, &comment.TaskID, &comment.AuthorID, &comment.AuthorUsername, &comment.ParentID, &comment.Body,
+		&comment.Mentions, &comment.CreatedAt, &comment.UpdatedAt, &comment.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Create stores the comment together with its mentions.
+func (r *PgCommentRepository) Create(ctx context.Context, comment *models.Comment) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin comment transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	insert into task_comments (id, task_id, author_id, parent_id, body, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = tx.Exec(ctx, query, comment.ID, comment.TaskID, comment.AuthorID, comment.ParentID, comment.Body, comment.CreatedAt, comment.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	if err := replaceMentions(ctx, tx, comment.ID, comment.Mentions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit comment: %w", err)
+	}
+	return nil
+}
+
+// replaceMentions sets the users the comment mentions.
+func replaceMentions(ctx context.Context, tx pgx.Tx, commentID uuid.UUID, userIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `delete from task_comment_mentions where comment_id = $1`, commentID); err != nil {
+		return fmt.Errorf("failed to clear comment mentions: %w", err)
+	}
+	query := `
+	insert into task_comment_mentions (comment_id, user_id)
+	select $1, unnest($2::uuid[])
+	on conflict do nothing
+	`
+	if _, err := tx.Exec(ctx, query, commentID, userIDs); err != nil {
+		return fmt.Errorf("failed to store comment mentions: %w", err)
+	}
+	return nil
+}
+
+func (r *PgCommentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Comment, error) {
+	query := commentSelect + `
+	where c.id = $1
+	group by c.id, u.username
+	`
+	comment, err := scanComment(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("comment not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	return comment, nil
+}
+
+// Update changes the body and mentions of a comment that has not been
+// deleted.
+func (r *PgCommentRepository) Update(ctx context.Context, comment *models.Comment) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin comment transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	update task_comments set body = $2, updated_at = $3
+	where id = $1 and deleted_at is null
+	`
+	result, err := tx.Exec(ctx, query, comment.ID, comment.Body, comment.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update comment: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("comment not found: %w", pgx.ErrNoRows)
+	}
+
+	if err := replaceMentions(ctx, tx, comment.ID, comment.Mentions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit comment: %w", err)
+	}
+	return nil
+}
+
+// Delete blanks the comment instead of removing it, so the replies to it
+// keep their place in the thread.
+func (r *PgCommentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+	with deleted as (
+		update task_comments set body = '', deleted_at = now(), updated_at = now()
+		where id = $1 and deleted_at is null
+		returning id
+	)
+	delete from task_comment_mentions where comment_id in (select id from deleted)
+	`
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	return nil
+}
+
+// ListByTask returns every comment of the task, oldest first.
+func (r *PgCommentRepository) ListByTask(ctx context.Context, taskID uuid.UUID) ([]*models.Comment, error) {
+	query := commentSelect + `
+	where c.task_id = $1
+	group by c.id, u.username
+	order by c.created_at, c.id
+	`
+	rows, err := r.db.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating comment rows: %w", err)
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var ErrCustomFieldExists = errors.New("project already has a custom field with this name")
+
+type CustomFieldRepository interface {
+	Create(ctx context.Context, field *models.CustomField) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.CustomField, error)
+	Update(ctx context.Context, field *models.CustomField) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.CustomField, error)
+}
+
+// customFieldColumns is the column list every custom field query selects, in
+// the order scanCustomField reads them.
+const customFieldColumns = `id, project_id, name, field_type, options, created_at, updated_at`
+
+type PgCustomFieldRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgCustomFieldRepository(db *pgxpool.Pool) *PgCustomFieldRepository {
+	return &PgCustomFieldRepository{db: db}
+}
+
+func scanCustomField(row pgx.Row) (*models.CustomField, error) {
+	field := &models.CustomField{}
+	err := row.Scan(&field.ID, &field.ProjectID, &field.Name, &field.Type, &field.Options, &field.CreatedAt, &field.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+func (r *PgCustomFieldRepository) Create(ctx context.Context, field *models.CustomField) error {
+	query := `
+	insert into custom_fields (id, project_id, name, field_type, options, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(ctx, query, field.ID, field.ProjectID, field.Name, field.Type, field.Options, field.CreatedAt, field.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrCustomFieldExists
+		}
+		return fmt.Errorf("failed to create custom field: %w", err)
+	}
+	return nil
+}
+
+func (r *PgCustomFieldRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.CustomField, error) {
+	field, err := scanCustomField(r.db.QueryRow(ctx, `select `+customFieldColumns+` from custom_fields where id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("custom field not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get custom field: %w", err)
+	}
+	return field, nil
+}
+
+// Update renames the field and changes its options. Its type can't change,
+// and values already set keep options that were dropped.
+func (r *PgCustomFieldRepository) Update(ctx context.Context, field *models.CustomField) error {
+	query := `update custom_fields set name = $2, options = $3, updated_at = $4 where id = $1`
+	tag, err := r.db.Exec(ctx, query, field.ID, field.Name, field.Options, field.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrCustomFieldExists
+		}
+		return fmt.Errorf("failed to update custom field: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("custom field not found when tried to update: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+// Delete removes the field together with its value on every task.
+func (r *PgCustomFieldRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, `delete from custom_fields where id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete custom field: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("custom field not found when tried to delete: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+// ListByProject returns the project's custom fields in the order they were
+// added.
+func (r *PgCustomFieldRepository) ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.CustomField, error) {
+	rows, err := r.db.Query(ctx, `select `+customFieldColumns+` from custom_fields where project_id = $1 order by created_at`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list custom fields: %w", err)
+	}
+	fields, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.CustomField, error) {
+		return scanCustomField(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list custom fields: %w", err)
+	}
+	if fields == nil {
+		fields = []*models.CustomField{}
+	}
+	return fields, nil
+}
+
+// setCustomValues saves the task's custom field values that differ from
+// oldValues and removes the ones no longer set. The values must already be
+// valid for their fields. It returns the changes for the task's history.
+func setCustomValues(ctx context.Context, tx pgx.Tx, taskID uuid.UUID, oldValues, newValues map[string]any) ([]fieldChange, error) {
+	fieldIDs := make([]string, 0, len(oldValues)+len(newValues))
+	for fieldID := range oldValues {
+		fieldIDs = append(fieldIDs, fieldID)
+	}
+	for fieldID := range newValues {
+		if _, ok := oldValues[fieldID]; !ok {
+			fieldIDs = append(fieldIDs, fieldID)
+		}
+	}
+	sort.Strings(fieldIDs)
+
+	var changes []fieldChange
+	for _, fieldID := range fieldIDs {
+		oldValue, hadValue := oldValues[fieldID]
+		newValue, hasValue := newValues[fieldID]
+		oldJSON, err := json.Marshal(oldValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode custom field value: %w", err)
+		}
+		newJSON, err := json.Marshal(newValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode custom field value: %w", err)
+		}
+		if hadValue == hasValue && bytes.Equal(oldJSON, newJSON) {
+			continue
+		}
+
+		id, err := uuid.Parse(fieldID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid custom field id %q: %w", fieldID, err)
+		}
+		if hasValue {
+			query := `
+			insert into task_custom_values (task_id, field_id, value)
+			values ($1, $2, $3)
+			on conflict (task_id, field_id) do update set value = excluded.value
+			`
+			_, err = tx.Exec(ctx, query, taskID, id, newJSON)
+		} else {
+			_, err = tx.Exec(ctx, `delete from task_custom_values where task_id = $1 and field_id = $2`, taskID, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to save custom field value: %w", err)
+		}
+		changes = append(changes, fieldChange{field: "custom_field:" + fieldID, oldValue: oldValue, newValue: newValue})
+	}
+	return changes, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvalidVerificationToken = errors.New("email verification token is invalid, expired or already used")
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, userID uuid.UUID, email, tokenHash string, expiresAt time.Time) error
+	Consume(ctx context.Context, tokenHash string) (uuid.UUID, error)
+}
+
+type PgEmailVerificationRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgEmailVerificationRepository(db *pgxpool.Pool) *PgEmailVerificationRepository {
+	return &PgEmailVerificationRepository{db: db}
+}
+
+// Create stores a token that verifies the email it is sent to.
+func (r *PgEmailVerificationRepository) Create(ctx context.Context, userID uuid.UUID, email, tokenHash string, expiresAt time.Time) error {
+	query := `
+	insert into email_verification_tokens (user_id, email, token_hash, expires_at)
+	values ($1, $2, $3, $4)
+	`
+	if _, err := r.db.Exec(ctx, query, userID, email, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to create email verification token: %w", err)
+	}
+	return nil
+}
+
+// Consume marks the token and every other outstanding verification token of
+// the same user as used, marks the user's email verified and returns the
+// user. The token only works while the user still has the email it was sent
+// to; the user row is locked so the email can't change in between.
+func (r *PgEmailVerificationRepository) Consume(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	query := `
+	with token as (
+		select t.user_id
+		from email_verification_tokens t
+		join users u on u.id = t.user_id
+		where t.token_hash = $1 and t.used_at is null and t.expires_at > now() and t.email = u.email
+		for update of u
+	), used as (
+		update email_verification_tokens
+		set used_at = now()
+		where user_id = (select user_id from token) and used_at is null
+	)
+	update users
+	set email_verified_at = coalesce(email_verified_at, now()), updated_at = now()
+	where id = (select user_id from token)
+	returning id
+	`
+	rows, err := r.db.Query(ctx, query, tokenHash)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to consume email verification token: %w", err)
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to consume email verification token: %w", err)
+	}
+	if len(userIDs) == 0 {
+		return uuid.Nil, ErrInvalidVerificationToken
+	}
+	return userIDs[0], nil
+}
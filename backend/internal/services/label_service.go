@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrLabelExists       = errors.New("project already has a label with this name")
+	ErrLabelNotInProject = errors.New("label not found in the task's project")
+)
+
+type LabelRepository interface {
+	Create(ctx context.Context, label *models.Label) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Label, error)
+	Update(ctx context.Context, label *models.Label) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.Label, error)
+}
+
+// labelColumns is the column list every label query selects, in the order
+// scanLabel reads them.
+const labelColumns = `id, project_id, name, color, created_at, updated_at`
+
+type PgLabelRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgLabelRepository(db *pgxpool.Pool) *PgLabelRepository {
+	return &PgLabelRepository{db: db}
+}
+
+func scanLabel(row pgx.Row) (*models.Label, error) {
+	label := &models.Label{}
+	err := row.Scan(&label.ID, &label.ProjectID, &label.Name, &label.Color, &label.CreatedAt, &label.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+func (r *PgLabelRepository) Create(ctx context.Context, label *models.Label) error {
+	query := `
+	insert into labels (id, project_id, name, color, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(ctx, query, label.ID, label.ProjectID, label.Name, label.Color, label.CreatedAt, label.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrLabelExists
+		}
+		return fmt.Errorf("failed to create label: %w", err)
+	}
+	return nil
+}
+
+func (r *PgLabelRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Label, error) {
+	label, err := scanLabel(r.db.QueryRow(ctx, `select `+labelColumns+` from labels where id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("label not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get label: %w", err)
+	}
+	return label, nil
+}
+
+func (r *PgLabelRepository) Update(ctx context.Context, label *models.Label) error {
+	tag, err := r.db.Exec(ctx, `update labels set name = $2, color = $3, updated_at = $4 where id = $1`, label.ID, label.Name, label.Color, label.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrLabelExists
+		}
+		return fmt.Errorf("failed to update label: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("label not found when tried to update: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+// Delete removes the label, which takes it off every task it tags.
+func (r *PgLabelRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, `delete from labels where id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete label: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("label not found when tried to delete: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+// ListByProject returns the project's labels ordered by name.
+func (r *PgLabelRepository) ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.Label, error) {
+	rows, err := r.db.Query(ctx, `select `+labelColumns+` from labels where project_id = $1 order by lower(name)`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list labels: %w", err)
+	}
+	labels, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Label, error) {
+		return scanLabel(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list labels: %w", err)
+	}
+	if labels == nil {
+		labels = []*models.Label{}
+	}
+	return labels, nil
+}
+
+// sortLabelIDs returns the label IDs sorted and without duplicates, in the
+// order task queries list them.
+func sortLabelIDs(labelIDs []uuid.UUID) []uuid.UUID {
+	sorted := append([]uuid.UUID{}, labelIDs...)
+	slices.SortFunc(sorted, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	return slices.Compact(sorted)
+}
+
+// setTaskLabels makes the task's label IDs its labels. Every label has to
+// belong to the task's project.
+func setTaskLabels(ctx context.Context, tx pgx.Tx, task *models.Task) error {
+	labelIDs := sortLabelIDs(task.LabelIDs)
+
+	var found int
+	if err := tx.QueryRow(ctx, `select count(*) from labels where project_id = $1 and id = any($2::uuid[])`, task.ProjectID, labelIDs).Scan(&found); err != nil {
+		return fmt.Errorf("failed to check task labels: %w", err)
+	}
+	if found != len(labelIDs) {
+		return ErrLabelNotInProject
+	}
+
+	if _, err := tx.Exec(ctx, `delete from task_labels where task_id = $1 and label_id <> all($2::uuid[])`, task.ID, labelIDs); err != nil {
+		return fmt.Errorf("failed to remove task labels: %w", err)
+	}
+	query := `
+	insert into task_labels (task_id, label_id)
+	select $1, unnest($2::uuid[])
+	on conflict do nothing
+	`
+	if _, err := tx.Exec(ctx, query, task.ID, labelIDs); err != nil {
+		return fmt.Errorf("failed to add task labels: %w", err)
+	}
+	task.LabelIDs = labelIDs
+	return nil
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidListQuery is returned for filters, sorts and searches a list
+// doesn't support.
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+// The filter operators. Ranges combine gte and lte, in takes a comma
+// separated list of values.
+const (
+	FilterEq  = "eq"
+	FilterNe  = "ne"
+	FilterGt  = "gt"
+	FilterGte = "gte"
+	FilterLt  = "lt"
+	FilterLte = "lte"
+	FilterIn  = "in"
+)
+
+var filterOperators = map[string]string{
+	FilterEq:  "=",
+	FilterNe:  "<>",
+	FilterGt:  ">",
+	FilterGte: ">=",
+	FilterLt:  "<",
+	FilterLte: "<=",
+}
+
+// ListFilter compares a field of the listed records with a value, both as
+// the client named them.
+type ListFilter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+type ListSort struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery is what a list endpoint was asked for: every filter has to
+// match, records are ordered by Sort and then by the list's default order,
+// and Search matches text in the list's searchable columns. Field names are
+// only ever looked up in the list's fields, so nothing the client sends
+// becomes part of the SQL text.
+type ListQuery struct {
+	Filters []ListFilter
+	Sort    []ListSort
+	Search  string
+	Limit   int
+	Offset  int
+}
+
+type listFieldKind int
+
+const (
+	listFieldText listFieldKind = iota
+	listFieldUUID
+	listFieldTime
+	listFieldInt
+	listFieldBool
+)
+
+// listField is a field a list can be filtered and sorted by. Nullable
+// fields also take null as a value for eq and ne.
+type listField struct {
+	column   string
+	kind     listFieldKind
+	nullable bool
+}
+
+// listSpec describes what a list can be filtered, sorted and searched by.
+// The default order goes after the requested sort and should end in a
+// unique column, so pages don't overlap.
+type listSpec struct {
+	fields       map[string]listField
+	search       []string
+	defaultOrder string
+}
+
+// queryBuilder collects the conditions and arguments of a query. Each
+// condition marks its argument with ?, which becomes the argument's
+// placeholder.
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+func (b *queryBuilder) where(condition string, args ...any) {
+	for _, arg := range args {
+		b.args = append(b.args, arg)
+		condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(b.args)), 1)
+	}
+	b.conditions = append(b.conditions, condition)
+}
+
+// whereClause returns the collected conditions as a where clause, or nothing
+// without conditions.
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return ` where ` + strings.Join(b.conditions, " and ")
+}
+
+// page adds the limit and offset arguments and returns their clause.
+func (b *queryBuilder) page(limit, offset int) string {
+	b.args = append(b.args, limit, offset)
+	return fmt.Sprintf(` limit $%d offset $%d`, len(b.args)-1, len(b.args))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// apply adds the query's filters and search to b and returns its order by
+// clause.
+func (s listSpec) apply(b *queryBuilder, q ListQuery) (string, error) {
+	for _, filter := range q.Filters {
+		if err := s.applyFilter(b, filter); err != nil {
+			return "", err
+		}
+	}
+
+	if search := strings.TrimSpace(q.Search); search != "" {
+		if len(s.search) == 0 {
+			return "", fmt.Errorf("%w: this list can't be searched", ErrInvalidListQuery)
+		}
+		matches := make([]string, 0, len(s.search))
+		for _, column := range s.search {
+			matches = append(matches, column+" ilike ?")
+		}
+		pattern := "%" + likeEscaper.Replace(search) + "%"
+		args := make([]any, len(matches))
+		for i := range args {
+			args[i] = pattern
+		}
+		b.where("("+strings.Join(matches, " or ")+")", args...)
+	}
+
+	order := make([]string, 0, len(q.Sort)+1)
+	for _, sort := range q.Sort {
+		field, ok := s.fields[sort.Field]
+		if !ok {
+			return "", fmt.Errorf("%w: can't sort by %q", ErrInvalidListQuery, sort.Field)
+		}
+		if sort.Desc {
+			order = append(order, field.column+" desc nulls last")
+		} else {
+			order = append(order, field.column+" asc nulls last")
+		}
+	}
+	order = append(order, s.defaultOrder)
+	return ` order by ` + strings.Join(order, ", "), nil
+}
+
+func (s listSpec) applyFilter(b *queryBuilder, filter ListFilter) error {
+	field, ok := s.fields[filter.Field]
+	if !ok {
+		return fmt.Errorf("%w: can't filter by %q", ErrInvalidListQuery, filter.Field)
+	}
+
+	if filter.Value == "null" && field.nullable {
+		switch filter.Op {
+		case FilterEq:
+			b.where(field.column + " is null")
+			return nil
+		case FilterNe:
+			b.where(field.column + " is not null")
+			return nil
+		}
+	}
+
+	if filter.Op == FilterIn {
+		if field.kind == listFieldBool {
+			return fmt.Errorf("%w: %s doesn't support %s", ErrInvalidListQuery, filter.Field, filter.Op)
+		}
+		values, err := parseListValues(field.kind, strings.Split(filter.Value, ","))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidListQuery, filter.Field, err)
+		}
+		b.where(field.column+" = any(?)", values)
+		return nil
+	}
+
+	operator, ok := filterOperators[filter.Op]
+	if !ok {
+		return fmt.Errorf("%w: unknown filter operator %q", ErrInvalidListQuery, filter.Op)
+	}
+	// text, ids and flags only compare for equality
+	rangeOp := filter.Op != FilterEq && filter.Op != FilterNe
+	if rangeOp && field.kind != listFieldTime && field.kind != listFieldInt {
+		return fmt.Errorf("%w: %s doesn't support %s", ErrInvalidListQuery, filter.Field, filter.Op)
+	}
+	value, err := parseListValue(field.kind, filter.Value)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidListQuery, filter.Field, err)
+	}
+	b.where(field.column+" "+operator+" ?", value)
+	return nil
+}
+
+// parseListValue converts a filter value to the type of its field. Times are
+// RFC 3339 timestamps or dates, which mean midnight UTC.
+func parseListValue(kind listFieldKind, value string) (any, error) {
+	switch kind {
+	case listFieldUUID:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, errors.New("invalid ID format")
+		}
+		return id, nil
+	case listFieldTime:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, errors.New("invalid time, expected RFC 3339 or a date")
+		}
+		return t, nil
+	case listFieldInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid number")
+		}
+		return n, nil
+	case listFieldBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("invalid boolean")
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// parseListValues converts the values of an in filter to a slice of their
+// field's type, so they are sent as a typed array.
+func parseListValues(kind listFieldKind, valueStrs []string) (any, error) {
+	var texts []string
+	var ids []uuid.UUID
+	var times []time.Time
+	var ints []int
+	for _, valueStr := range valueStrs {
+		value, err := parseListValue(kind, strings.TrimSpace(valueStr))
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case string:
+			texts = append(texts, v)
+		case uuid.UUID:
+			ids = append(ids, v)
+		case time.Time:
+			times = append(times, v)
+		case int:
+			ints = append(ints, v)
+		}
+	}
+	switch kind {
+	case listFieldUUID:
+		return ids, nil
+	case listFieldTime:
+		return times, nil
+	case listFieldInt:
+		return ints, nil
+	}
+	return texts, nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var testListSpec = listSpec{
+	fields: map[string]listField{
+		"name":       {column: "name"},
+		"owner_id":   {column: "owner_id", kind: listFieldUUID},
+		"parent_id":  {column: "parent_id", kind: listFieldUUID, nullable: true},
+		"points":     {column: "story_points", kind: listFieldInt, nullable: true},
+		"verified":   {column: "(verified_at is not null)", kind: listFieldBool},
+		"created_at": {column: "created_at", kind: listFieldTime},
+	},
+	search:       []string{"name", "description"},
+	defaultOrder: "created_at desc, id",
+}
+
+func TestQueryBuilderPlaceholders(t *testing.T) {
+	var b queryBuilder
+	b.where("project_id = ?", 1)
+	b.where("deleted_at is null")
+	b.where("(a = ? or b = ?)", 2, 3)
+	b.where("c between ? and ?", 4, 5)
+
+	if got, want := b.whereClause(), ` where project_id = $1 and deleted_at is null and (a = $2 or b = $3) and c between $4 and $5`; got != want {
+		t.Errorf("whereClause() = %q, want %q", got, want)
+	}
+	if got, want := b.page(10, 20), ` limit $6 offset $7`; got != want {
+		t.Errorf("page() = %q, want %q", got, want)
+	}
+	if want := []any{1, 2, 3, 4, 5, 10, 20}; !reflect.DeepEqual(b.args, want) {
+		t.Errorf("args = %v, want %v", b.args, want)
+	}
+}
+
+func TestQueryBuilderWithoutConditions(t *testing.T) {
+	var b queryBuilder
+	if got := b.whereClause(); got != "" {
+		t.Errorf("whereClause() = %q, want nothing", got)
+	}
+	if got, want := b.page(5, 0), ` limit $1 offset $2`; got != want {
+		t.Errorf("page() = %q, want %q", got, want)
+	}
+}
+
+func TestListSpecApply(t *testing.T) {
+	ownerID := uuid.MustParse("7c9e6679-7425-40de-944b-e07fc1f90ae7")
+	otherID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	day := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		q         ListQuery
+		wantWhere string
+		wantOrder string
+		wantArgs  []any
+	}{
+		{
+			name:      "empty",
+			wantOrder: ` order by created_at desc, id`,
+		},
+		{
+			name:      "equality",
+			q:         ListQuery{Filters: []ListFilter{{Field: "name", Op: FilterEq, Value: "kira"}, {Field: "owner_id", Op: FilterNe, Value: ownerID.String()}}},
+			wantWhere: ` where name = $1 and owner_id <> $2`,
+			wantOrder: ` order by created_at desc, id`,
+			wantArgs:  []any{"kira", ownerID},
+		},
+		{
+			name: "range",
+			q: ListQuery{Filters: []ListFilter{
+				{Field: "created_at", Op: FilterGte, Value: "2025-08-01"},
+				{Field: "created_at", Op: FilterLt, Value: "2025-08-02T00:00:00Z"},
+				{Field: "points", Op: FilterGt, Value: "3"},
+			}},
+			wantWhere: ` where created_at >= $1 and created_at < $2 and story_points > $3`,
+			wantOrder: ` order by created_at desc, id`,
+			wantArgs:  []any{day, day.AddDate(0, 0, 1), 3},
+		},
+		{
+			name:      "in",
+			q:         ListQuery{Filters: []ListFilter{{Field: "owner_id", Op: FilterIn, Value: ownerID.String() + ", " + otherID.String()}}},
+			wantWhere: ` where owner_id = any($1)`,
+			wantOrder: ` order by created_at desc, id`,
+			wantArgs:  []any{[]uuid.UUID{ownerID, otherID}},
+		},
+		{
+			name:      "null",
+			q:         ListQuery{Filters: []ListFilter{{Field: "parent_id", Op: FilterEq, Value: "null"}, {Field: "points", Op: FilterNe, Value: "null"}}},
+			wantWhere: ` where parent_id is null and story_points is not null`,
+			wantOrder: ` order by created_at desc, id`,
+		},
+		{
+			name:      "bool expression",
+			q:         ListQuery{Filters: []ListFilter{{Field: "verified", Op: FilterEq, Value: "true"}}},
+			wantWhere: ` where (verified_at is not null) = $1`,
+			wantOrder: ` order by created_at desc, id`,
+			wantArgs:  []any{true},
+		},
+		{
+			name:      "search escapes wildcards",
+			q:         ListQuery{Search: " 50%_off\\ "},
+			wantWhere: ` where (name ilike $1 or description ilike $2)`,
+			wantOrder: ` order by created_at desc, id`,
+			wantArgs:  []any{`%50\%\_off\\%`, `%50\%\_off\\%`},
+		},
+		{
+			name:      "sort",
+			q:         ListQuery{Sort: []ListSort{{Field: "points", Desc: true}, {Field: "name"}}},
+			wantOrder: ` order by story_points desc nulls last, name asc nulls last, created_at desc, id`,
+		},
+		{
+			name: "filters before search",
+			q: ListQuery{
+				Filters: []ListFilter{{Field: "name", Op: FilterEq, Value: "a"}},
+				Search:  "b",
+			},
+			wantWhere: ` where name = $1 and (name ilike $2 or description ilike $3)`,
+			wantOrder: ` order by created_at desc, id`,
+			wantArgs:  []any{"a", "%b%", "%b%"},
+		},
+	}
+	for _, tt := range tests {
+		var b queryBuilder
+		order, err := testListSpec.apply(&b, tt.q)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.whereClause(); got != tt.wantWhere {
+			t.Errorf("%s: where = %q, want %q", tt.name, got, tt.wantWhere)
+		}
+		if order != tt.wantOrder {
+			t.Errorf("%s: order = %q, want %q", tt.name, order, tt.wantOrder)
+		}
+		if !reflect.DeepEqual(b.args, tt.wantArgs) {
+			t.Errorf("%s: args = %#v, want %#v", tt.name, b.args, tt.wantArgs)
+		}
+	}
+}
+
+// TestListSpecApplyRejects checks that only the spec's fields and operators
+// get through, so nothing a client names ends up in the SQL.
+func TestListSpecApplyRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		q    ListQuery
+	}{
+		{"unknown filter field", ListQuery{Filters: []ListFilter{{Field: "password", Op: FilterEq, Value: "x"}}}},
+		{"column name as field", ListQuery{Filters: []ListFilter{{Field: "story_points", Op: FilterEq, Value: "1"}}}},
+		{"injected field", ListQuery{Filters: []ListFilter{{Field: "name = name or 1=1 --", Op: FilterEq, Value: "x"}}}},
+		{"unknown operator", ListQuery{Filters: []ListFilter{{Field: "name", Op: "like", Value: "x"}}}},
+		{"injected operator", ListQuery{Filters: []ListFilter{{Field: "name", Op: "= '' or 1=1 --", Value: "x"}}}},
+		{"range on text", ListQuery{Filters: []ListFilter{{Field: "name", Op: FilterGt, Value: "a"}}}},
+		{"range on id", ListQuery{Filters: []ListFilter{{Field: "owner_id", Op: FilterLt, Value: uuid.NewString()}}}},
+		{"in on bool", ListQuery{Filters: []ListFilter{{Field: "verified", Op: FilterIn, Value: "true,false"}}}},
+		{"null on required field", ListQuery{Filters: []ListFilter{{Field: "owner_id", Op: FilterEq, Value: "null"}}}},
+		{"bad id", ListQuery{Filters: []ListFilter{{Field: "owner_id", Op: FilterEq, Value: "1 or 1=1"}}}},
+		{"bad id in list", ListQuery{Filters: []ListFilter{{Field: "owner_id", Op: FilterIn, Value: uuid.NewString() + ",x"}}}},
+		{"bad time", ListQuery{Filters: []ListFilter{{Field: "created_at", Op: FilterGte, Value: "yesterday"}}}},
+		{"bad number", ListQuery{Filters: []ListFilter{{Field: "points", Op: FilterGt, Value: "1.5"}}}},
+		{"bad bool", ListQuery{Filters: []ListFilter{{Field: "verified", Op: FilterEq, Value: "maybe"}}}},
+		{"unknown sort field", ListQuery{Sort: []ListSort{{Field: "password"}}}},
+		{"injected sort field", ListQuery{Sort: []ListSort{{Field: "name; drop table users"}}}},
+	}
+	for _, tt := range tests {
+		var b queryBuilder
+		if _, err := testListSpec.apply(&b, tt.q); !errors.Is(err, ErrInvalidListQuery) {
+			t.Errorf("%s: err = %v, want ErrInvalidListQuery", tt.name, err)
+		}
+	}
+}
+
+func TestListSpecApplyWithoutSearch(t *testing.T) {
+	spec := listSpec{fields: testListSpec.fields, defaultOrder: "id"}
+	var b queryBuilder
+	if _, err := spec.apply(&b, ListQuery{Search: "x"}); !errors.Is(err, ErrInvalidListQuery) {
+		t.Errorf("err = %v, want ErrInvalidListQuery", err)
+	}
+	// blank searches are ignored
+	if _, err := spec.apply(&b, ListQuery{Search: "  "}); err != nil {
+		t.Errorf("blank search: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginThrottleRepository counts consecutive failed logins per key, such as
+// an email address or an IP, and how long further attempts are blocked.
+type LoginThrottleRepository interface {
+	BlockedUntil(ctx context.Context, keys ...string) (time.Time, error)
+	RecordFailure(ctx context.Context, key string, window time.Duration, blockFor func(failures int) time.Duration) (time.Time, error)
+	Reset(ctx context.Context, keys ...string) error
+}
+
+type PgLoginThrottleRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgLoginThrottleRepository(db *pgxpool.Pool) *PgLoginThrottleRepository {
+	return &PgLoginThrottleRepository{db: db}
+}
+
+// BlockedUntil returns the latest time any of the keys is blocked until, or
+// the zero time when none of them is blocked.
+func (r *PgLoginThrottleRepository) BlockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	query := `
+	select max(blocked_until) from login_throttles
+	where key = any($1) and blocked_until > now()
+	`
+	var blockedUntil *time.Time
+	if err := r.db.QueryRow(ctx, query, keys).Scan(&blockedUntil); err != nil {
+		return time.Time{}, fmt.Errorf("failed to check login throttle: %w", err)
+	}
+	if blockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *blockedUntil, nil
+}
+
+// RecordFailure counts a failed login for the key, starting over when the
+// previous failure is older than window, and blocks the key for as long as
+// blockFor returns for the new count. It returns the time the key is blocked
+// until.
+func (r *PgLoginThrottleRepository) RecordFailure(ctx context.Context, key string, window time.Duration, blockFor func(failures int) time.Duration) (time.Time, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin login throttle transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	insert into login_throttles (key, failures, last_failure_at)
+	values ($1, 1, now())
+	on conflict (key) do update set
+		failures = case
+			when login_throttles.last_failure_at < now() - make_interval(secs => $2) then 1
+			else login_throttles.failures + 1
+		end,
+		last_failure_at = now()
+	returning failures
+	`
+	var failures int
+	if err := tx.QueryRow(ctx, query, key, window.Seconds()).Scan(&failures); err != nil {
+		return time.Time{}, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	blockedUntil := time.Now().Add(blockFor(failures))
+	blockQuery := `
+	update login_throttles set blocked_until = $2
+	where key = $1
+	`
+	if _, err := tx.Exec(ctx, blockQuery, key, blockedUntil); err != nil {
+		return time.Time{}, fmt.Errorf("failed to block login: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("failed to commit login failure: %w", err)
+	}
+	return blockedUntil, nil
+}
+
+// Reset forgets the failures of the keys and lifts their blocks.
+func (r *PgLoginThrottleRepository) Reset(ctx context.Context, keys ...string) error {
+	if _, err := r.db.Exec(ctx, `delete from login_throttles where key = any($1)`, keys); err != nil {
+		return fmt.Errorf("failed to reset login throttle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvalidLoginState = errors.New("single sign-on login state is invalid, expired or already used")
+
+// OIDCLoginState is what the server remembers between redirecting the user to
+// the identity provider and the provider redirecting them back.
+type OIDCLoginState struct {
+	Nonce        string
+	CodeVerifier string
+	RedirectTo   string
+}
+
+type OIDCStateRepository interface {
+	Create(ctx context.Context, stateHash string, state *OIDCLoginState, expiresAt time.Time) error
+	Consume(ctx context.Context, stateHash string) (*OIDCLoginState, error)
+}
+
+type PgOIDCStateRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgOIDCStateRepository(db *pgxpool.Pool) *PgOIDCStateRepository {
+	return &PgOIDCStateRepository{db: db}
+}
+
+func (r *PgOIDCStateRepository) Create(ctx context.Context, stateHash string, state *OIDCLoginState, expiresAt time.Time) error {
+	query := `
+	insert into oidc_login_states (state_hash, nonce, code_verifier, redirect_to, expires_at)
+	values ($1, $2, $3, $4, $5)
+	`
+	if _, err := r.db.Exec(ctx, query, stateHash, state.Nonce, state.CodeVerifier, state.RedirectTo, expiresAt); err != nil {
+		return fmt.Errorf("failed to create login state: %w", err)
+	}
+	return nil
+}
+
+// Consume deletes the state so it can only be used once, and returns it when
+// it has not expired. Expired states are cleaned up on the way.
+func (r *PgOIDCStateRepository) Consume(ctx context.Context, stateHash string) (*OIDCLoginState, error) {
+	if _, err := r.db.Exec(ctx, `delete from oidc_login_states where expires_at < now()`); err != nil {
+		return nil, fmt.Errorf("failed to delete expired login states: %w", err)
+	}
+
+	query := `
+	delete from oidc_login_states
+	where state_hash = $1 and expires_at > now()
+	returning nonce, code_verifier, redirect_to
+	`
+	state := &OIDCLoginState{}
+	err := r.db.QueryRow(ctx, query, stateHash).Scan(&state.Nonce, &state.CodeVerifier, &state.RedirectTo)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidLoginState
+		}
+		return nil, fmt.Errorf("failed to consume login state: %w", err)
+	}
+	return state, nil
+}
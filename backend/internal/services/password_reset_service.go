@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvalidResetToken = errors.New("password reset token is invalid, expired or already used")
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	Reset(ctx context.Context, tokenHash, hashedPassword string) (uuid.UUID, error)
+}
+
+type PgPasswordResetRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgPasswordResetRepository(db *pgxpool.Pool) *PgPasswordResetRepository {
+	return &PgPasswordResetRepository{db: db}
+}
+
+func (r *PgPasswordResetRepository) Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	query := `
+	insert into password_reset_tokens (user_id, token_hash, expires_at)
+	values ($1, $2, $3)
+	`
+	if _, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+// Reset uses up the token, sets the password of the user it was issued for
+// and revokes all of their sessions, all or nothing. Every other outstanding
+// token of that user is used up along with it, so only one link from a batch
+// of reset emails ever works.
+func (r *PgPasswordResetRepository) Reset(ctx context.Context, tokenHash, hashedPassword string) (uuid.UUID, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin password reset transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	update password_reset_tokens
+	set used_at = now()
+	where user_id = (
+		select user_id from password_reset_tokens
+		where token_hash = $1 and used_at is null and expires_at > now()
+	) and used_at is null
+	returning user_id
+	`
+	rows, err := tx.Query(ctx, query, tokenHash)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+	if len(userIDs) == 0 {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+	userID := userIDs[0]
+
+	result, err := tx.Exec(ctx, `update users set password = $2, updated_at = now() where id = $1`, userID, hashedPassword)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update user password: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return uuid.Nil, fmt.Errorf("user not found when tried to update password")
+	}
+	if _, err := tx.Exec(ctx, `update sessions set revoked_at = now() where user_id = $1 and revoked_at is null`, userID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	return userID, nil
+}
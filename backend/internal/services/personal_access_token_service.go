@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var ErrInvalidAccessToken = errors.New("personal access token is invalid, expired or revoked")
+
+// TokenOwner is who a personal access token acts for.
+type TokenOwner struct {
+	TokenID  uuid.UUID
+	UserID   uuid.UUID
+	Username string
+	Role     string
+	Scopes   []string
+}
+
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken, tokenHash string) error
+	Authenticate(ctx context.Context, tokenHash string) (*TokenOwner, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.PersonalAccessToken, error)
+	Revoke(ctx context.Context, id, userID uuid.UUID) error
+}
+
+type PgPersonalAccessTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgPersonalAccessTokenRepository(db *pgxpool.Pool) *PgPersonalAccessTokenRepository {
+	return &PgPersonalAccessTokenRepository{db: db}
+}
+
+func (r *PgPersonalAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken, tokenHash string) error {
+	query := `
+	insert into personal_access_tokens (id, user_id, name, token_prefix, token_hash, scopes, expires_at, created_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.Exec(ctx, query, token.ID, token.UserID, token.Name, token.Prefix, tokenHash, token.Scopes, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create personal access token: %w", err)
+	}
+	return nil
+}
+
+// Authenticate looks up a live token, records that it was used and returns
+// the user it belongs to.
+func (r *PgPersonalAccessTokenRepository) Authenticate(ctx context.Context, tokenHash string) (*TokenOwner, error) {
+	query := `
+	update personal_access_tokens t set last_used_at = now()
+	from users u
+	where t.token_hash = $1 and u.id = t.user_id
+		and t.revoked_at is null and (t.expires_at is null or t.expires_at > now())
+	returning t.id, t.user_id, u.username, u.role, t.scopes
+	`
+	owner := &TokenOwner{}
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&owner.TokenID, &owner.UserID, &owner.Username, &owner.Role, &owner.Scopes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, fmt.Errorf("failed to authenticate personal access token: %w", err)
+	}
+	return owner, nil
+}
+
+func (r *PgPersonalAccessTokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.PersonalAccessToken, error) {
+	query := `
+	select id, user_id, name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+	from personal_access_tokens
+	where user_id = $1
+	order by created_at desc
+	`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.PersonalAccessToken
+	for rows.Next() {
+		token := &models.PersonalAccessToken{}
+		err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.Scopes, &token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt, &token.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan personal access token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating personal access token rows: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Revoke revokes one of the user's tokens. Tokens of other users are reported
+// as not found.
+func (r *PgPersonalAccessTokenRepository) Revoke(ctx context.Context, id, userID uuid.UUID) error {
+	query := `
+	update personal_access_tokens set revoked_at = now()
+	where id = $1 and user_id = $2 and revoked_at is null
+	`
+	result, err := r.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke personal access token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("personal access token not found: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrLastProjectOwner = errors.New("a project must keep at least one owner")
+	ErrAlreadyMember    = errors.New("user is already a member of this project")
+)
+
+type ProjectMemberRepository interface {
+	Add(ctx context.Context, member *models.ProjectMember) error
+	GetRole(ctx context.Context, projectID, userID uuid.UUID) (string, error)
+	UpdateRole(ctx context.Context, projectID, userID uuid.UUID, role string) error
+	Remove(ctx context.Context, projectID, userID uuid.UUID) error
+	ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.ProjectMember, error)
+}
+
+type PgProjectMemberRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgProjectMemberRepository(db *pgxpool.Pool) *PgProjectMemberRepository {
+	return &PgProjectMemberRepository{db: db}
+}
+
+func (r *PgProjectMemberRepository) Add(ctx context.Context, member *models.ProjectMember) error {
+	query := `
+	insert into project_members (project_id, user_id, role, created_at, updated_at)
+	values ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.Exec(ctx, query, member.ProjectID, member.UserID, member.Role, member.CreatedAt, member.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrAlreadyMember
+		}
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			return fmt.Errorf("user or project not found when adding member: %w", pgx.ErrNoRows)
+		}
+		return fmt.Errorf("failed to add project member: %w", err)
+	}
+	return nil
+}
+
+// GetRole returns the user's role in the project, or an error wrapping
+// pgx.ErrNoRows when the user is not a member.
+func (r *PgProjectMemberRepository) GetRole(ctx context.Context, projectID, userID uuid.UUID) (string, error) {
+	query := `
+	select role from project_members
+	where project_id = $1 and user_id = $2
+	`
+	var role string
+	err := r.db.QueryRow(ctx, query, projectID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("project member not found: %w", err)
+		}
+		return "", fmt.Errorf("failed to get project member role: %w", err)
+	}
+	return role, nil
+}
+
+func (r *PgProjectMemberRepository) UpdateRole(ctx context.Context, projectID, userID uuid.UUID, role string) error {
+	return r.changeMember(ctx, projectID, userID, role != models.ProjectRoleOwner, func(tx pgx.Tx) (pgconn.CommandTag, error) {
+		return tx.Exec(ctx, `
+		update project_members set role = $3, updated_at = now()
+		where project_id = $1 and user_id = $2
+		`, projectID, userID, role)
+	})
+}
+
+func (r *PgProjectMemberRepository) Remove(ctx context.Context, projectID, userID uuid.UUID) error {
+	return r.changeMember(ctx, projectID, userID, true, func(tx pgx.Tx) (pgconn.CommandTag, error) {
+		return tx.Exec(ctx, `
+		delete from project_members
+		where project_id = $1 and user_id = $2
+		`, projectID, userID)
+	})
+}
+
+// changeMember runs change with the project row locked. When dropsOwner is
+// set and the member is the project's only owner the change is refused, so
+// concurrent demotions cannot leave a project without an owner.
+func (r *PgProjectMemberRepository) changeMember(ctx context.Context, projectID, userID uuid.UUID, dropsOwner bool, change func(tx pgx.Tx) (pgconn.CommandTag, error)) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin member transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `select id from projects where id = $1 for update`, projectID); err != nil {
+		return fmt.Errorf("failed to lock project: %w", err)
+	}
+
+	if dropsOwner {
+		var isOwner bool
+		var owners int
+		err := tx.QueryRow(ctx, `
+		select
+			coalesce(bool_or(user_id = $2), false),
+			count(*)
+		from project_members
+		where project_id = $1 and role = 'owner'
+		`, projectID, userID).Scan(&isOwner, &owners)
+		if err != nil {
+			return fmt.Errorf("failed to count project owners: %w", err)
+		}
+		if isOwner && owners == 1 {
+			return ErrLastProjectOwner
+		}
+	}
+
+	result, err := change(tx)
+	if err != nil {
+		return fmt.Errorf("failed to change project member: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("project member not found: %w", pgx.ErrNoRows)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit member change: %w", err)
+	}
+	return nil
+}
+
+func (r *PgProjectMemberRepository) ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.ProjectMember, error) {
+	query := `
+	select pm.project_id, pm.user_id, u.username, u.full_name, pm.role, pm.created_at, pm.updated_at
+	from project_members pm
+	join users u on u.id = pm.user_id
+	where pm.project_id = $1
+	order by pm.created_at
+	`
+	rows, err := r.db.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*models.ProjectMember
+	for rows.Next() {
+		member := &models.ProjectMember{}
+		err := rows.Scan(&member.ProjectID, &member.UserID, &member.Username, &member.FullName, &member.Role, &member.CreatedAt, &member.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project member rows: %w", err)
+	}
+
+	return members, nil
+}
@@ -13,13 +13,18 @@ import (
 
 type ProjectRepository interface {
 	Create(ctx context.Context, project *models.Project) error
-	Update(ctx context.Context, project *models.Project) error
+	Update(ctx context.Context, project *models.Project, actorID uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Project, error)
 	GetByOwner(ctx context.Context, ownerID uuid.UUID) (*models.Project, error)
-	Delete(ctx context.Context, id uuid.UUID) error
-	List(ctx context.Context, limit, offset int) ([]*models.Project, error)
+	Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error
+	List(ctx context.Context, q ListQuery) ([]*models.Project, error)
+	ListByMember(ctx context.Context, userID uuid.UUID, q ListQuery) ([]*models.Project, error)
 }
 
+// projectColumns is the column list every project query selects, in the
+// order scanProject reads them.
+const projectColumns = `id, name, description, status, require_blockers_done, owner_id, created_at, updated_at`
+
 type PgProjectRepository struct {
 	db *pgxpool.Pool
 }
@@ -30,40 +35,101 @@ func NewPgProjectRepository(db *pgxpool.Pool) *PgProjectRepository {
 	}
 }
 
+// Create inserts the project and makes its owner the first member with the
+// owner role.
 func (r *PgProjectRepository) Create(ctx context.Context, project *models.Project) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin project transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
-	insert into projects (id, name, description, status, owner_id, created_at, updated_at)
-	values($1, $2, $3, $4, $5, $6, $7)
+	insert into projects (id, name, description, status, require_blockers_done, owner_id, created_at, updated_at)
+	values($1, $2, $3, $4, $5, $6, $7, $8)
 	`
-	_, err := r.db.Exec(context.Background(), query, project.ID, project.Name, project.Description, project.Status, project.OwnerID, project.CreatedAt, project.UpdatedAt)
+	_, err = tx.Exec(ctx, query, project.ID, project.Name, project.Description, project.Status, project.RequireBlockersDone, project.OwnerID, project.CreatedAt, project.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("Failed to create project in db: %w", err)
 	}
+
+	memberQuery := `
+	insert into project_members (project_id, user_id, role, created_at, updated_at)
+	values ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.Exec(ctx, memberQuery, project.ID, project.OwnerID, models.ProjectRoleOwner, project.CreatedAt, project.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add project owner as member: %w", err)
+	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  project.ID,
+		entityType: models.ActivityEntityProject,
+		entityID:   project.ID,
+		actorID:    project.OwnerID,
+		action:     models.ActivityCreated,
+		changes:    []fieldChange{{field: "name", newValue: project.Name}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit project creation: %w", err)
+	}
 	return nil
 }
 
-func (r *PgProjectRepository) Update(ctx context.Context, project *models.Project) error {
+// Update saves the project and records every changed field in its history.
+func (r *PgProjectRepository) Update(ctx context.Context, project *models.Project, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin project transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	oldProject, err := scanProject(tx.QueryRow(ctx, `select `+projectColumns+` from projects where id = $1 for update`, project.ID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("project record not found when tried to update: %w", err)
+		}
+		return fmt.Errorf("failed to get project to update: %w", err)
+	}
+
 	query := `
-	update projects set name = $1, description = $2, status = $3, owner_id = $4, updated_at = $5
-	where id = $6
+	update projects set name = $1, description = $2, status = $3, owner_id = $4, updated_at = $5, require_blockers_done = $6
+	where id = $7
 	`
-	_, err := r.db.Exec(ctx, query, project.Name, project.Description, project.Status, project.OwnerID, project.UpdatedAt, project.ID)
+	_, err = tx.Exec(ctx, query, project.Name, project.Description, project.Status, project.OwnerID, project.UpdatedAt, project.RequireBlockersDone, project.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update project in db: %w", err)
 	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  project.ID,
+		entityType: models.ActivityEntityProject,
+		entityID:   project.ID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    diffProject(oldProject, project),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit project update: %w", err)
+	}
 	return nil
 }
 
 func (r *PgProjectRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Project, error) {
 	query := `
-	select id, name, description, status, owner_id, created_at, updated_at
+	select ` + projectColumns + `
 	from projects
 	where id = $1
 	`
-	project := &models.Project{}
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt,
-	)
+	project, err := scanProject(r.db.QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("project record not found (finding by id): %w", err)
@@ -76,14 +142,11 @@ func (r *PgProjectRepository) GetByID(ctx context.Context, id uuid.UUID) (*model
 
 func (r *PgProjectRepository) GetByOwner(ctx context.Context, ownerID uuid.UUID) (*models.Project, error) {
 	query := `
-	select id, name, description, status, owner_id, created_at, updated_at
+	select ` + projectColumns + `
 	from projects
 	where owner_id = $1
 	`
-	project := &models.Project{}
-	err := r.db.QueryRow(ctx, query, ownerID).Scan(
-		&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt,
-	)
+	project, err := scanProject(r.db.QueryRow(ctx, query, ownerID))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("project record not found (finding by owner id): %w", err)
@@ -93,25 +156,79 @@ func (r *PgProjectRepository) GetByOwner(ctx context.Context, ownerID uuid.UUID)
 	return project, nil
 }
 
-func (r *PgProjectRepository) Delete(ctx context.Context, id uuid.UUID) error {
+func (r *PgProjectRepository) Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin project transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 	delete from projects
 	where id = $1
+	returning name
 	`
-	_, err := r.db.Exec(ctx, query, id)
-	if err != nil {
+	var name string
+	if err := tx.QueryRow(ctx, query, id).Scan(&name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("project record not found when tried to delete: %w", err)
+		}
 		return fmt.Errorf("failed to delete project from db: %w", err)
 	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  id,
+		entityType: models.ActivityEntityProject,
+		entityID:   id,
+		actorID:    actorID,
+		action:     models.ActivityDeleted,
+		changes:    []fieldChange{{field: "name", oldValue: name}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit project deletion: %w", err)
+	}
 	return nil
 }
 
-func (r *PgProjectRepository) List(ctx context.Context, limit, offset int) ([]*models.Project, error) {
+// projectListSpec is what project lists can be filtered, sorted and searched
+// by.
+var projectListSpec = listSpec{
+	fields: map[string]listField{
+		"name":       {column: "name"},
+		"status":     {column: "status"},
+		"owner_id":   {column: "owner_id", kind: listFieldUUID},
+		"created_at": {column: "created_at", kind: listFieldTime},
+		"updated_at": {column: "updated_at", kind: listFieldTime},
+	},
+	search:       []string{"name", "description"},
+	defaultOrder: "created_at desc, id",
+}
+
+func (r *PgProjectRepository) List(ctx context.Context, q ListQuery) ([]*models.Project, error) {
+	return r.list(ctx, &queryBuilder{}, q)
+}
+
+// ListByMember returns the projects the user is a member of that match the
+// query.
+func (r *PgProjectRepository) ListByMember(ctx context.Context, userID uuid.UUID, q ListQuery) ([]*models.Project, error) {
+	var b queryBuilder
+	b.where("id in (select project_id from project_members where user_id = ?)", userID)
+	return r.list(ctx, &b, q)
+}
+
+func (r *PgProjectRepository) list(ctx context.Context, b *queryBuilder, q ListQuery) ([]*models.Project, error) {
+	orderBy, err := projectListSpec.apply(b, q)
+	if err != nil {
+		return nil, err
+	}
 	query := `
-	select id, name, description, status, owner_id, created_at, updated_at
-	from projects
-	limit $1 offset $2
-	`
-	rows, err := r.db.Query(ctx, query, limit, offset)
+	select ` + projectColumns + `
+	from projects` + b.whereClause() + orderBy + b.page(q.Limit, q.Offset)
+	rows, err := r.db.Query(ctx, query, b.args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list projects: %w", err)
 	}
@@ -119,14 +236,26 @@ func (r *PgProjectRepository) List(ctx context.Context, limit, offset int) ([]*m
 
 	var projects []*models.Project
 	for rows.Next() {
-		project := &models.Project{}
-		err := rows.Scan(
-			&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt,
-		)
+		project, err := scanProject(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan project: %w", err)
 		}
 		projects = append(projects, project)
 	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project rows: %w", err)
+	}
 	return projects, nil
 }
+
+func scanProject(row pgx.Row) (*models.Project, error) {
+	project := &models.Project{}
+	err := row.Scan(
+		&project.ID, &project.Name, &project.Description, &project.Status, &project.RequireBlockersDone, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
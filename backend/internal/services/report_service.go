@@ -0,0 +1,615 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+// reportDateLayout is the format of the dates in report series.
+const reportDateLayout = "2006-01-02"
+
+const (
+	// ReportUnitTasks counts work in tasks.
+	ReportUnitTasks = "tasks"
+	// ReportUnitPoints counts work in story points, unestimated tasks count
+	// zero.
+	ReportUnitPoints = "points"
+)
+
+// ReportScope selects the work a report covers: the tasks of a sprint, or
+// every task of the project when SprintID is nil, over the days From to To.
+// Days are UTC days, To included. Unit is what work is counted in.
+type ReportScope struct {
+	Unit      string
+	ProjectID uuid.UUID
+	SprintID  *uuid.UUID
+	From      time.Time
+	To        time.Time
+	// Cutoff ends the last day early, at the moment a sprint was closed,
+	// before its unfinished tasks were carried over.
+	Cutoff *time.Time
+}
+
+// history is the part of the task history the report replays.
+func (s ReportScope) history() historyScope {
+	h := historyScope{projectID: s.ProjectID, from: truncateDay(s.From), until: truncateDay(s.To).AddDate(0, 0, 1)}
+	if s.Cutoff != nil && s.Cutoff.Before(h.until) {
+		h.until = *s.Cutoff
+	}
+	if s.SprintID != nil {
+		h.sprintIDs = []uuid.UUID{*s.SprintID}
+	}
+	return h
+}
+
+type BurndownPoint struct {
+	Date           string   `json:"date"`
+	Scope          int      `json:"scope"`
+	Completed      int      `json:"completed"`
+	Remaining      int      `json:"remaining"`
+	IdealRemaining *float64 `json:"ideal_remaining,omitempty"`
+}
+
+// BurndownReport has one point per day with the remaining work for a burndown
+// chart, and the scope and completed work for a burnup chart.
+type BurndownReport struct {
+	Unit   string          `json:"unit"`
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Series []BurndownPoint `json:"series"`
+}
+
+type VelocitySprint struct {
+	SprintID  uuid.UUID `json:"sprint_id"`
+	Name      string    `json:"name"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	Committed int       `json:"committed"`
+	Completed int       `json:"completed"`
+}
+
+// VelocityReport compares the work committed to at the start of each closed
+// sprint with the work completed by its close, oldest sprint first.
+type VelocityReport struct {
+	Unit             string           `json:"unit"`
+	Sprints          []VelocitySprint `json:"sprints"`
+	AverageCompleted float64          `json:"average_completed"`
+}
+
+type CumulativeFlowPoint struct {
+	Date   string         `json:"date"`
+	Counts map[string]int `json:"counts"`
+}
+
+// CumulativeFlowReport has the work in each status at the end of every day.
+type CumulativeFlowReport struct {
+	Unit     string                `json:"unit"`
+	Statuses []string              `json:"statuses"`
+	Series   []CumulativeFlowPoint `json:"series"`
+}
+
+// ReportRepository computes the agile charts by replaying the task history
+// recorded in the activity log.
+type ReportRepository interface {
+	Burndown(ctx context.Context, scope ReportScope) (*BurndownReport, error)
+	Velocity(ctx context.Context, projectID uuid.UUID, sprintCount int, unit string) (*VelocityReport, error)
+	CumulativeFlow(ctx context.Context, scope ReportScope) (*CumulativeFlowReport, error)
+}
+
+type PgReportRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgReportRepository(db *pgxpool.Pool) *PgReportRepository {
+	return &PgReportRepository{db: db}
+}
+
+func (r *PgReportRepository) Burndown(ctx context.Context, scope ReportScope) (*BurndownReport, error) {
+	timeline, err := r.loadTimeline(ctx, scope.history())
+	if err != nil {
+		return nil, err
+	}
+	workflow, err := loadWorkflow(ctx, r.db, scope.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BurndownReport{
+		Unit:   scope.Unit,
+		From:   scope.From.Format(reportDateLayout),
+		To:     scope.To.Format(reportDateLayout),
+		Series: []BurndownPoint{},
+	}
+	days := reportDays(scope)
+	for i, day := range days {
+		point := BurndownPoint{Date: day.date}
+		for _, task := range timeline.stateAt(day.end) {
+			if !task.inScope(scope.SprintID) {
+				continue
+			}
+			point.Scope += task.work(scope.Unit)
+			if workflow.IsDone(task.status) {
+				point.Completed += task.work(scope.Unit)
+			}
+		}
+		point.Remaining = point.Scope - point.Completed
+		report.Series = append(report.Series, point)
+
+		// the ideal line burns the sprint's starting scope down evenly to zero
+		// by its last day
+		if scope.SprintID != nil {
+			start := float64(report.Series[0].Scope)
+			ideal := start
+			if total := totalDays(scope); total > 1 {
+				ideal = start - start*float64(i)/float64(total-1)
+			}
+			report.Series[i].IdealRemaining = &ideal
+		}
+	}
+	return report, nil
+}
+
+// Velocity reports the last sprintCount closed sprints of the project.
+func (r *PgReportRepository) Velocity(ctx context.Context, projectID uuid.UUID, sprintCount int, unit string) (*VelocityReport, error) {
+	query := `
+	select ` + sprintColumns + `
+	from sprints
+	where project_id = $1 and status = 'closed'
+	order by closed_at desc
+	limit $2
+	`
+	rows, err := r.db.Query(ctx, query, projectID, sprintCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list closed sprints: %w", err)
+	}
+	sprints, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Sprint, error) {
+		return scanSprint(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list closed sprints: %w", err)
+	}
+	slices.Reverse(sprints)
+
+	report := &VelocityReport{Unit: unit, Sprints: []VelocitySprint{}}
+	if len(sprints) == 0 {
+		return report, nil
+	}
+	history := historyScope{projectID: projectID}
+	for _, sprint := range sprints {
+		history.sprintIDs = append(history.sprintIDs, sprint.ID)
+		if sprint.ClosedAt != nil && sprint.ClosedAt.After(history.until) {
+			history.until = *sprint.ClosedAt
+		}
+	}
+	timeline, err := r.loadTimeline(ctx, history)
+	if err != nil {
+		return nil, err
+	}
+	workflow, err := loadWorkflow(ctx, r.db, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, sprint := range sprints {
+		entry := VelocitySprint{
+			SprintID:  sprint.ID,
+			Name:      sprint.Name,
+			StartDate: sprint.StartDate.Format(reportDateLayout),
+			EndDate:   sprint.EndDate.Format(reportDateLayout),
+		}
+		if sprint.StartedAt != nil {
+			for _, task := range timeline.stateAt(*sprint.StartedAt) {
+				if task.inScope(&sprint.ID) {
+					entry.Committed += task.work(unit)
+				}
+			}
+		}
+		if sprint.ClosedAt != nil {
+			for _, task := range timeline.stateAt(*sprint.ClosedAt) {
+				if task.inScope(&sprint.ID) && workflow.IsDone(task.status) {
+					entry.Completed += task.work(unit)
+				}
+			}
+		}
+		total += entry.Completed
+		report.Sprints = append(report.Sprints, entry)
+	}
+	if len(report.Sprints) > 0 {
+		report.AverageCompleted = float64(total) / float64(len(report.Sprints))
+	}
+	return report, nil
+}
+
+func (r *PgReportRepository) CumulativeFlow(ctx context.Context, scope ReportScope) (*CumulativeFlowReport, error) {
+	timeline, err := r.loadTimeline(ctx, scope.history())
+	if err != nil {
+		return nil, err
+	}
+	workflow, err := loadWorkflow(ctx, r.db, scope.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CumulativeFlowReport{Unit: scope.Unit, Series: []CumulativeFlowPoint{}}
+	seen := make(map[string]bool)
+	for _, day := range reportDays(scope) {
+		point := CumulativeFlowPoint{Date: day.date, Counts: make(map[string]int)}
+		for _, task := range timeline.stateAt(day.end) {
+			if task.inScope(scope.SprintID) {
+				point.Counts[task.status] += task.work(scope.Unit)
+				seen[task.status] = true
+			}
+		}
+		report.Series = append(report.Series, point)
+	}
+
+	// workflow statuses first, in board order, then any other status
+	report.Statuses = []string{}
+	for _, status := range workflow.StatusKeys() {
+		report.Statuses = append(report.Statuses, status)
+		delete(seen, status)
+	}
+	var others []string
+	for status := range seen {
+		others = append(others, status)
+	}
+	sort.Strings(others)
+	report.Statuses = append(report.Statuses, others...)
+	// every point lists every status, so the chart's bands line up
+	for _, point := range report.Series {
+		for _, status := range report.Statuses {
+			if _, ok := point.Counts[status]; !ok {
+				point.Counts[status] = 0
+			}
+		}
+	}
+	return report, nil
+}
+
+type reportDay struct {
+	date string
+	end  time.Time
+}
+
+// reportDays returns the days of the scope up to today, each with the moment
+// the day's state is taken at.
+func reportDays(scope ReportScope) []reportDay {
+	from := truncateDay(scope.From)
+	to := truncateDay(scope.To)
+	if today := truncateDay(time.Now()); to.After(today) {
+		to = today
+	}
+
+	var days []reportDay
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		if scope.Cutoff != nil && scope.Cutoff.Before(end) {
+			end = *scope.Cutoff
+			if end.Before(day) {
+				break
+			}
+		}
+		if now := time.Now(); now.Before(end) {
+			end = now
+		}
+		days = append(days, reportDay{date: day.Format(reportDateLayout), end: end})
+	}
+	return days
+}
+
+// totalDays is the number of days in the scope, including those still ahead.
+func totalDays(scope ReportScope) int {
+	return int(truncateDay(scope.To).Sub(truncateDay(scope.From)).Hours()/24) + 1
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// taskState is what the reports need to know about a task at one moment.
+type taskState struct {
+	exists   bool
+	status   string
+	sprintID *uuid.UUID
+	points   int
+}
+
+// work is how much work the task counts for in unit.
+func (s *taskState) work(unit string) int {
+	if unit == ReportUnitPoints {
+		return s.points
+	}
+	return 1
+}
+
+func (s *taskState) inScope(sprintID *uuid.UUID) bool {
+	if !s.exists {
+		return false
+	}
+	if sprintID == nil {
+		return true
+	}
+	return s.sprintID != nil && *s.sprintID == *sprintID
+}
+
+const (
+	taskEventCreated = iota
+	taskEventDeleted
+	taskEventStatus
+	taskEventSprint
+	taskEventPoints
+)
+
+type taskEvent struct {
+	at       time.Time
+	taskID   uuid.UUID
+	kind     int
+	status   string
+	sprintID *uuid.UUID
+	points   int
+}
+
+// taskTimeline replays the task events of a project. States are computed by
+// applying events in order, so asking for increasing moments is cheap.
+type taskTimeline struct {
+	initial map[uuid.UUID]taskState
+	events  []taskEvent
+	applied int
+	states  map[uuid.UUID]*taskState
+}
+
+// stateAt returns the state of every task just before the moment at.
+func (t *taskTimeline) stateAt(at time.Time) map[uuid.UUID]*taskState {
+	if t.states == nil || t.applied > 0 && !t.events[t.applied-1].at.Before(at) {
+		t.states = make(map[uuid.UUID]*taskState, len(t.initial))
+		t.applied = 0
+	}
+	for ; t.applied < len(t.events) && t.events[t.applied].at.Before(at); t.applied++ {
+		event := t.events[t.applied]
+		state := t.states[event.taskID]
+		if state == nil {
+			initial := t.initial[event.taskID]
+			state = &initial
+			t.states[event.taskID] = state
+		}
+		switch event.kind {
+		case taskEventCreated:
+			state.exists = true
+		case taskEventDeleted:
+			state.exists = false
+		case taskEventStatus:
+			state.status = event.status
+		case taskEventSprint:
+			state.sprintID = event.sprintID
+		case taskEventPoints:
+			state.points = event.points
+		}
+	}
+	return t.states
+}
+
+// historyScope selects the task history a report replays: the tasks that
+// were ever in one of the sprints, or without sprints every task of the
+// project not deleted before from, as they were up to the moment until.
+type historyScope struct {
+	projectID uuid.UUID
+	sprintIDs []uuid.UUID
+	from      time.Time
+	until     time.Time
+}
+
+// scopedTaskIDs selects the ids of the tasks in a historyScope, given as $1
+// project id, $2 sprint ids, $3 from and $4 until.
+const scopedTaskIDs = `
+	select id from tasks
+	where project_id = $1 and created_at < $4 and ($2::uuid[] is null or sprint_id = any($2))
+	union
+	select entity_id from activities
+	where project_id = $1 and entity_type = 'task'
+		and ($2::uuid[] is null and action = 'deleted' and created_at >= $3
+			or field = 'sprint_id' and (old_value #>> '{}' = any($2::uuid[]::text[]) or new_value #>> '{}' = any($2::uuid[]::text[])))
+	`
+
+// loadTimeline builds the task timeline of the scope from the activity log
+// and the current tasks. The state a task was created in comes from its
+// created entry, or for tasks older than the activity log from the first
+// recorded change or its current state. Changes after the scope are only
+// read for that first change.
+func (r *PgReportRepository) loadTimeline(ctx context.Context, scope historyScope) (*taskTimeline, error) {
+	timeline := &taskTimeline{initial: make(map[uuid.UUID]taskState)}
+	created := make(map[uuid.UUID]bool)
+	statusKnown := make(map[uuid.UUID]bool)
+	sprintKnown := make(map[uuid.UUID]bool)
+	pointsKnown := make(map[uuid.UUID]bool)
+
+	query := `
+	(
+		select entity_id, action, field, old_value, new_value, created_at, id
+		from activities
+		where project_id = $1 and entity_type = 'task' and created_at < $4
+			and (action in ('created', 'deleted') or field in ('status', 'sprint_id', 'story_points'))
+			and entity_id in (` + scopedTaskIDs + `)
+	)
+	union all
+	(
+		select distinct on (entity_id, field) entity_id, action, field, old_value, new_value, created_at, id
+		from activities
+		where project_id = $1 and entity_type = 'task' and created_at >= $4
+			and field in ('status', 'sprint_id', 'story_points')
+			and entity_id in (` + scopedTaskIDs + `)
+		order by entity_id, field, created_at, id
+	)
+	order by created_at, id
+	`
+	rows, err := r.db.Query(ctx, query, scope.projectID, scope.sprintIDs, scope.from, scope.until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task history: %w", err)
+	}
+	var taskID uuid.UUID
+	var action string
+	var field *string
+	var oldValue, newValue json.RawMessage
+	var at time.Time
+	var id int64
+	_, err = pgx.ForEachRow(rows, []any{&taskID, &action, &field, &oldValue, &newValue, &at, &id}, func() error {
+		initial := timeline.initial[taskID]
+		switch {
+		case action == models.ActivityCreated:
+			if !created[taskID] {
+				created[taskID] = true
+				timeline.events = append(timeline.events, taskEvent{at: at, taskID: taskID, kind: taskEventCreated})
+			}
+			if field != nil && *field == "status" && !statusKnown[taskID] {
+				statusKnown[taskID] = true
+				if err := json.Unmarshal(newValue, &initial.status); err != nil {
+					return err
+				}
+			}
+			if field != nil && *field == "story_points" && !pointsKnown[taskID] {
+				pointsKnown[taskID] = true
+				points, err := decodePoints(newValue)
+				if err != nil {
+					return err
+				}
+				initial.points = points
+			}
+		case action == models.ActivityDeleted:
+			if field == nil || *field == "title" {
+				timeline.events = append(timeline.events, taskEvent{at: at, taskID: taskID, kind: taskEventDeleted})
+			}
+			if field != nil && *field == "status" && !statusKnown[taskID] {
+				statusKnown[taskID] = true
+				if err := json.Unmarshal(oldValue, &initial.status); err != nil {
+					return err
+				}
+			}
+		case field == nil:
+		case *field == "status":
+			event := taskEvent{at: at, taskID: taskID, kind: taskEventStatus}
+			if err := json.Unmarshal(newValue, &event.status); err != nil {
+				return err
+			}
+			if !statusKnown[taskID] {
+				statusKnown[taskID] = true
+				if err := json.Unmarshal(oldValue, &initial.status); err != nil {
+					return err
+				}
+			}
+			timeline.events = append(timeline.events, event)
+		case *field == "sprint_id":
+			event := taskEvent{at: at, taskID: taskID, kind: taskEventSprint}
+			if err := json.Unmarshal(newValue, &event.sprintID); err != nil {
+				return err
+			}
+			if !sprintKnown[taskID] {
+				sprintKnown[taskID] = true
+				if err := json.Unmarshal(oldValue, &initial.sprintID); err != nil {
+					return err
+				}
+			}
+			timeline.events = append(timeline.events, event)
+		case *field == "story_points":
+			points, err := decodePoints(newValue)
+			if err != nil {
+				return err
+			}
+			if !pointsKnown[taskID] {
+				pointsKnown[taskID] = true
+				if initial.points, err = decodePoints(oldValue); err != nil {
+					return err
+				}
+			}
+			timeline.events = append(timeline.events, taskEvent{at: at, taskID: taskID, kind: taskEventPoints, points: points})
+		}
+		timeline.initial[taskID] = initial
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task history: %w", err)
+	}
+
+	query = `
+	select id, status, sprint_id, coalesce(story_points, 0), created_at
+	from tasks
+	where id in (` + scopedTaskIDs + `) and created_at < $4
+	order by created_at, id
+	`
+	rows, err = r.db.Query(ctx, query, scope.projectID, scope.sprintIDs, scope.from, scope.until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tasks: %w", err)
+	}
+	var status string
+	var sprintID *uuid.UUID
+	var points int
+	var createdAt time.Time
+	var older []taskEvent
+	_, err = pgx.ForEachRow(rows, []any{&taskID, &status, &sprintID, &points, &createdAt}, func() error {
+		initial := timeline.initial[taskID]
+		if !statusKnown[taskID] {
+			initial.status = status
+		}
+		if !sprintKnown[taskID] {
+			initial.sprintID = sprintID
+		}
+		if !pointsKnown[taskID] {
+			initial.points = points
+		}
+		timeline.initial[taskID] = initial
+		if !created[taskID] {
+			older = append(older, taskEvent{at: createdAt, taskID: taskID, kind: taskEventCreated})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tasks: %w", err)
+	}
+
+	// both are in order, the creation of tasks older than the activity log is
+	// merged into the history
+	timeline.events = mergeEvents(timeline.events, older)
+	return timeline, nil
+}
+
+// mergeEvents merges two lists of events ordered by time, the first list's
+// events going first at equal times.
+func mergeEvents(a, b []taskEvent) []taskEvent {
+	if len(b) == 0 {
+		return a
+	}
+	merged := make([]taskEvent, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if b[0].at.Before(a[0].at) {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// decodePoints reads story points recorded in the activity log, where an
+// unestimated task has null.
+func decodePoints(value json.RawMessage) (int, error) {
+	var points *int
+	if err := json.Unmarshal(value, &points); err != nil {
+		return 0, err
+	}
+	if points == nil {
+		return 0, nil
+	}
+	return *points, nil
+}
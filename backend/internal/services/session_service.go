@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session has been revoked")
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session, refreshTokenHash string, expiresAt time.Time) error
+	Rotate(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (*models.Session, error)
+	GetByRefreshToken(ctx context.Context, refreshTokenHash string) (*models.Session, error)
+	IsActive(ctx context.Context, id uuid.UUID) (bool, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type PgSessionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgSessionRepository(db *pgxpool.Pool) *PgSessionRepository {
+	return &PgSessionRepository{db: db}
+}
+
+// Create stores a new session together with its first refresh token.
+func (r *PgSessionRepository) Create(ctx context.Context, session *models.Session, refreshTokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin session transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	insert into sessions (id, user_id, user_agent, ip, created_at, last_used_at)
+	values ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = tx.Exec(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP, session.CreatedAt, session.LastUsedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	tokenQuery := `
+	insert into refresh_tokens (session_id, token_hash, expires_at)
+	values ($1, $2, $3)
+	`
+	if _, err := tx.Exec(ctx, tokenQuery, session.ID, refreshTokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit session: %w", err)
+	}
+	return nil
+}
+
+// Rotate exchanges a refresh token for a new one of the same session. A
+// token can only be exchanged once: presenting it again means it leaked, so
+// the whole session is revoked and ErrRefreshTokenReused is returned.
+func (r *PgSessionRepository) Rotate(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin rotate transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	select rt.id, rt.expires_at, rt.used_at,
+		s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_used_at, s.revoked_at
+	from refresh_tokens rt
+	join sessions s on s.id = rt.session_id
+	where rt.token_hash = $1
+	for update
+	`
+	var tokenID uuid.UUID
+	var tokenExpiresAt time.Time
+	var usedAt *time.Time
+	session := &models.Session{}
+	err = tx.QueryRow(ctx, query, refreshTokenHash).Scan(
+		&tokenID, &tokenExpiresAt, &usedAt,
+		&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if usedAt != nil {
+		if _, err := tx.Exec(ctx, `update sessions set revoked_at = now() where id = $1`, session.ID); err != nil {
+			return nil, fmt.Errorf("failed to revoke reused session: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit session revocation: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(tokenExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec(ctx, `update refresh_tokens set used_at = now() where id = $1`, tokenID); err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	tokenQuery := `
+	insert into refresh_tokens (session_id, token_hash, expires_at)
+	values ($1, $2, $3)
+	`
+	if _, err := tx.Exec(ctx, tokenQuery, session.ID, newRefreshTokenHash, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	session.LastUsedAt = time.Now()
+	if _, err := tx.Exec(ctx, `update sessions set last_used_at = $2 where id = $1`, session.ID, session.LastUsedAt); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+	return session, nil
+}
+
+// GetByRefreshToken returns the session a refresh token belongs to, used or
+// not, or ErrInvalidRefreshToken when the token is unknown.
+func (r *PgSessionRepository) GetByRefreshToken(ctx context.Context, refreshTokenHash string) (*models.Session, error) {
+	query := `
+	select s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_used_at, s.revoked_at
+	from refresh_tokens rt
+	join sessions s on s.id = rt.session_id
+	where rt.token_hash = $1
+	`
+	session := &models.Session{}
+	err := r.db.QueryRow(ctx, query, refreshTokenHash).Scan(
+		&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get session by refresh token: %w", err)
+	}
+	return session, nil
+}
+
+// IsActive reports whether the session exists and has not been revoked.
+func (r *PgSessionRepository) IsActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+	select exists (select 1 from sessions where id = $1 and revoked_at is null)
+	`
+	var active bool
+	if err := r.db.QueryRow(ctx, query, id).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
+
+func (r *PgSessionRepository) Revoke(ctx context.Context, id uuid.UUID) error {
+	query := `
+	update sessions set revoked_at = now()
+	where id = $1 and revoked_at is null
+	`
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+func (r *PgSessionRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	query := `
+	update sessions set revoked_at = now()
+	where user_id = $1 and revoked_at is null
+	`
+	if _, err := r.db.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+	return nil
+}
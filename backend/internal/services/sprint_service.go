@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrSprintAlreadyActive = errors.New("project already has an active sprint")
+	ErrSprintNotPlanned    = errors.New("only a planned sprint can be started")
+	ErrSprintNotActive     = errors.New("only an active sprint can be closed")
+	ErrSprintClosed        = errors.New("sprint is closed")
+	ErrNoNextSprint        = errors.New("project has no planned sprint to move unfinished tasks to")
+	ErrTaskNotInProject    = errors.New("task does not belong to the sprint's project")
+)
+
+// SprintCloseOptions says where the unfinished tasks of a closed sprint go.
+// They go back to the backlog unless ToSprint is set, then they move to
+// TargetSprintID, or to the project's next planned sprint when that is nil.
+type SprintCloseOptions struct {
+	ToSprint       bool
+	TargetSprintID *uuid.UUID
+}
+
+// SprintCloseResult is the outcome of closing a sprint.
+type SprintCloseResult struct {
+	Sprint           *models.Sprint `json:"sprint"`
+	CompletedTasks   int            `json:"completed_tasks"`
+	CarriedOverTasks int            `json:"carried_over_tasks"`
+	CarriedOverTo    *uuid.UUID     `json:"carried_over_to"`
+}
+
+type SprintRepository interface {
+	Create(ctx context.Context, sprint *models.Sprint) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Sprint, error)
+	ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.Sprint, error)
+	Update(ctx context.Context, sprint *models.Sprint) error
+	Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error
+	Start(ctx context.Context, id uuid.UUID) (*models.Sprint, error)
+	Close(ctx context.Context, id uuid.UUID, options SprintCloseOptions, actorID uuid.UUID) (*SprintCloseResult, error)
+	AddTasks(ctx context.Context, sprintID uuid.UUID, taskIDs []uuid.UUID, actorID uuid.UUID) error
+	RemoveTasks(ctx context.Context, projectID uuid.UUID, taskIDs []uuid.UUID, actorID uuid.UUID) error
+}
+
+// sprintColumns is the column list every sprint query selects, in the order
+// scanSprint reads them.
+const sprintColumns = `id, project_id, name, goal, start_date, end_date, status, started_at, closed_at, created_at, updated_at`
+
+type PgSprintRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgSprintRepository(db *pgxpool.Pool) *PgSprintRepository {
+	return &PgSprintRepository{db: db}
+}
+
+func (r *PgSprintRepository) Create(ctx context.Context, sprint *models.Sprint) error {
+	query := `
+	insert into sprints (id, project_id, name, goal, start_date, end_date, status, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(ctx, query, sprint.ID, sprint.ProjectID, sprint.Name, sprint.Goal, sprint.StartDate, sprint.EndDate, sprint.Status, sprint.CreatedAt, sprint.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create sprint in db: %w", err)
+	}
+	return nil
+}
+
+func (r *PgSprintRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Sprint, error) {
+	sprint, err := scanSprint(r.db.QueryRow(ctx, `select `+sprintColumns+` from sprints where id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("sprint not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get sprint: %w", err)
+	}
+	return sprint, nil
+}
+
+// ListByProject returns the project's sprints in the order they are planned.
+func (r *PgSprintRepository) ListByProject(ctx context.Context, projectID uuid.UUID) ([]*models.Sprint, error) {
+	query := `
+	select ` + sprintColumns + `
+	from sprints
+	where project_id = $1
+	order by start_date, created_at
+	`
+	rows, err := r.db.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sprints: %w", err)
+	}
+	defer rows.Close()
+
+	sprints := []*models.Sprint{}
+	for rows.Next() {
+		sprint, err := scanSprint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sprint: %w", err)
+		}
+		sprints = append(sprints, sprint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sprint rows: %w", err)
+	}
+	return sprints, nil
+}
+
+// Update saves the sprint's name, goal and dates. Closed sprints can't be
+// changed any more.
+func (r *PgSprintRepository) Update(ctx context.Context, sprint *models.Sprint) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin sprint transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockSprint(ctx, tx, sprint.ID)
+	if err != nil {
+		return err
+	}
+	if current.Status == models.SprintClosed {
+		return ErrSprintClosed
+	}
+
+	query := `
+	update sprints set name = $2, goal = $3, start_date = $4, end_date = $5, updated_at = $6
+	where id = $1
+	`
+	if _, err := tx.Exec(ctx, query, sprint.ID, sprint.Name, sprint.Goal, sprint.StartDate, sprint.EndDate, sprint.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update sprint in db: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit sprint update: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the sprint and moves its tasks back to the backlog. Closed
+// sprints can't be deleted.
+func (r *PgSprintRepository) Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin sprint transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sprint, err := lockSprint(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if sprint.Status == models.SprintClosed {
+		return ErrSprintClosed
+	}
+	taskIDs, err := sprintTaskIDs(ctx, tx, id, nil)
+	if err != nil {
+		return err
+	}
+	if err := setTaskSprint(ctx, tx, sprint.ProjectID, taskIDs, nil, actorID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `delete from sprints where id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete sprint from db: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit sprint deletion: %w", err)
+	}
+	return nil
+}
+
+// Start makes a planned sprint the project's active sprint.
+func (r *PgSprintRepository) Start(ctx context.Context, id uuid.UUID) (*models.Sprint, error) {
+	query := `
+	update sprints set status = 'active', started_at = now(), updated_at = now()
+	where id = $1 and status = 'planned'
+	returning ` + sprintColumns
+	sprint, err := scanSprint(r.db.QueryRow(ctx, query, id))
+	if err == nil {
+		return sprint, nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return nil, ErrSprintAlreadyActive
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to start sprint: %w", err)
+	}
+	// the sprint is either missing or not planned
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrSprintNotPlanned
+}
+
+// Close closes the active sprint and moves its unfinished tasks as the
+// options say. Finished tasks stay with the sprint as its record.
+func (r *PgSprintRepository) Close(ctx context.Context, id uuid.UUID, options SprintCloseOptions, actorID uuid.UUID) (*SprintCloseResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin sprint transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sprint, err := lockSprint(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sprint.Status != models.SprintActive {
+		return nil, ErrSprintNotActive
+	}
+
+	var target *uuid.UUID
+	if options.ToSprint {
+		target, err = carryOverTarget(ctx, tx, sprint, options.TargetSprintID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workflow, err := loadWorkflow(ctx, tx, sprint.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	unfinished, err := sprintTaskIDs(ctx, tx, id, workflow.DoneStatuses())
+	if err != nil {
+		return nil, err
+	}
+	if err := setTaskSprint(ctx, tx, sprint.ProjectID, unfinished, target, actorID); err != nil {
+		return nil, err
+	}
+
+	result := &SprintCloseResult{CarriedOverTasks: len(unfinished), CarriedOverTo: target}
+	if err := tx.QueryRow(ctx, `select count(*) from tasks where sprint_id = $1`, id).Scan(&result.CompletedTasks); err != nil {
+		return nil, fmt.Errorf("failed to count completed tasks: %w", err)
+	}
+
+	query := `
+	update sprints set status = 'closed', closed_at = now(), updated_at = now()
+	where id = $1
+	returning ` + sprintColumns
+	result.Sprint, err = scanSprint(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to close sprint: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit sprint closing: %w", err)
+	}
+	return result, nil
+}
+
+// carryOverTarget returns the sprint unfinished tasks move to, which is
+// targetID or else the project's next planned sprint.
+func carryOverTarget(ctx context.Context, tx pgx.Tx, sprint *models.Sprint, targetID *uuid.UUID) (*uuid.UUID, error) {
+	if targetID == nil {
+		query := `
+		select id from sprints
+		where project_id = $1 and status = 'planned'
+		order by start_date, created_at
+		limit 1
+		`
+		var nextID uuid.UUID
+		if err := tx.QueryRow(ctx, query, sprint.ProjectID).Scan(&nextID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrNoNextSprint
+			}
+			return nil, fmt.Errorf("failed to find next sprint: %w", err)
+		}
+		return &nextID, nil
+	}
+
+	target, err := lockSprint(ctx, tx, *targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target.ID == sprint.ID || target.ProjectID != sprint.ProjectID {
+		return nil, fmt.Errorf("target sprint %s is not another sprint of the project: %w", target.ID, pgx.ErrNoRows)
+	}
+	if target.Status == models.SprintClosed {
+		return nil, ErrSprintClosed
+	}
+	return &target.ID, nil
+}
+
+// AddTasks moves tasks of the sprint's project into the sprint, out of the
+// backlog or another sprint.
+func (r *PgSprintRepository) AddTasks(ctx context.Context, sprintID uuid.UUID, taskIDs []uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin sprint transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sprint, err := lockSprint(ctx, tx, sprintID)
+	if err != nil {
+		return err
+	}
+	if sprint.Status == models.SprintClosed {
+		return ErrSprintClosed
+	}
+	if err := setTaskSprint(ctx, tx, sprint.ProjectID, taskIDs, &sprint.ID, actorID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit sprint tasks: %w", err)
+	}
+	return nil
+}
+
+// RemoveTasks moves tasks of the project back to the backlog.
+func (r *PgSprintRepository) RemoveTasks(ctx context.Context, projectID uuid.UUID, taskIDs []uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin sprint transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setTaskSprint(ctx, tx, projectID, taskIDs, nil, actorID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit sprint tasks: %w", err)
+	}
+	return nil
+}
+
+func lockSprint(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*models.Sprint, error) {
+	sprint, err := scanSprint(tx.QueryRow(ctx, `select `+sprintColumns+` from sprints where id = $1 for update`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("sprint not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get sprint: %w", err)
+	}
+	return sprint, nil
+}
+
+// sprintTaskIDs returns the IDs of the sprint's tasks, leaving out those in
+// one of the excluded statuses.
+func sprintTaskIDs(ctx context.Context, tx pgx.Tx, sprintID uuid.UUID, excludedStatuses []string) ([]uuid.UUID, error) {
+	query := `
+	select id from tasks
+	where sprint_id = $1 and status <> all(coalesce($2, '{}'::text[]))
+	`
+	rows, err := tx.Query(ctx, query, sprintID, excludedStatuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sprint tasks: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sprint tasks: %w", err)
+	}
+	return ids, nil
+}
+
+// setTaskSprint moves the tasks to the sprint, or to the backlog when
+// sprintID is nil, and records the change in each task's history. Every task
+// has to belong to the project.
+func setTaskSprint(ctx context.Context, tx pgx.Tx, projectID uuid.UUID, taskIDs []uuid.UUID, sprintID *uuid.UUID, actorID uuid.UUID) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+
+	query := `
+	select t.id, t.sprint_id, coalesce(s.status = 'closed', false)
+	from tasks t
+	left join sprints s on s.id = t.sprint_id
+	where t.id = any($1) and t.project_id = $2
+	for update of t
+	`
+	rows, err := tx.Query(ctx, query, taskIDs, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to get tasks: %w", err)
+	}
+	oldSprints := make(map[uuid.UUID]*uuid.UUID, len(taskIDs))
+	var taskID uuid.UUID
+	var oldSprintID *uuid.UUID
+	var inClosedSprint bool
+	_, err = pgx.ForEachRow(rows, []any{&taskID, &oldSprintID, &inClosedSprint}, func() error {
+		// closed sprints keep their tasks as the record of what was done
+		if inClosedSprint {
+			return fmt.Errorf("task %s: %w", taskID, ErrSprintClosed)
+		}
+		oldSprints[taskID] = oldSprintID
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrSprintClosed) {
+			return err
+		}
+		return fmt.Errorf("failed to get tasks: %w", err)
+	}
+	for _, id := range taskIDs {
+		if _, ok := oldSprints[id]; !ok {
+			return fmt.Errorf("task %s: %w", id, ErrTaskNotInProject)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `update tasks set sprint_id = $2, updated_at = now() where id = any($1)`, taskIDs, sprintID); err != nil {
+		return fmt.Errorf("failed to move tasks to sprint: %w", err)
+	}
+
+	for id, oldSprintID := range oldSprints {
+		err := recordActivity(ctx, tx, activity{
+			projectID:  projectID,
+			entityType: models.ActivityEntityTask,
+			entityID:   id,
+			actorID:    actorID,
+			action:     models.ActivityUpdated,
+			changes:    diffOptionalID(nil, "sprint_id", oldSprintID, sprintID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanSprint(row pgx.Row) (*models.Sprint, error) {
+	sprint := &models.Sprint{}
+	err := row.Scan(
+		&sprint.ID, &sprint.ProjectID, &sprint.Name, &sprint.Goal, &sprint.StartDate, &sprint.EndDate, &sprint.Status, &sprint.StartedAt, &sprint.ClosedAt, &sprint.CreatedAt, &sprint.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sprint, nil
+}
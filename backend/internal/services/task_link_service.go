@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrLinkAcrossProjects = errors.New("linked tasks must belong to the same project")
+	ErrLinkExists         = errors.New("tasks are already linked this way")
+	ErrBlockingCycle      = errors.New("link would make the tasks block each other")
+	ErrTaskBlocked        = errors.New("task is blocked by tasks that are not done yet")
+)
+
+type TaskLinkRepository interface {
+	Create(ctx context.Context, link *models.TaskLink) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.TaskLink, error)
+	Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error
+	ListByTask(ctx context.Context, taskID uuid.UUID) ([]*models.TaskLink, error)
+	Graph(ctx context.Context, projectID uuid.UUID) (*DependencyGraph, error)
+}
+
+// taskLinkColumns is the column list every link query selects, in the order
+// scanTaskLink reads them.
+const taskLinkColumns = `id, source_task_id, target_task_id, link_type, created_by, created_at`
+
+// DependencyNode is a linked task in a dependency graph. Blocked is set while
+// any task that blocks it is not done.
+type DependencyNode struct {
+	ID      uuid.UUID `json:"id"`
+	Title   string    `json:"title"`
+	Type    string    `json:"type"`
+	Status  string    `json:"status"`
+	Blocked bool      `json:"blocked"`
+}
+
+// DependencyGraph has every linked task of a project as a node and every link
+// as an edge from source to target.
+type DependencyGraph struct {
+	Nodes []DependencyNode   `json:"nodes"`
+	Links []*models.TaskLink `json:"links"`
+}
+
+type PgTaskLinkRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgTaskLinkRepository(db *pgxpool.Pool) *PgTaskLinkRepository {
+	return &PgTaskLinkRepository{db: db}
+}
+
+func scanTaskLink(row pgx.Row) (*models.TaskLink, error) {
+	link := &models.TaskLink{}
+	err := row.Scan(&link.ID, &link.SourceTaskID, &link.TargetTaskID, &link.Type, &link.CreatedBy, &link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// Create links two tasks of the same project. The project row is locked while
+// the link is checked and stored, so two links that together close a
+// blocking cycle can't both get in.
+func (r *PgTaskLinkRepository) Create(ctx context.Context, link *models.TaskLink) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin link transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `select project_id from tasks where id = any($1)`, []uuid.UUID{link.SourceTaskID, link.TargetTaskID})
+	if err != nil {
+		return fmt.Errorf("failed to get linked tasks: %w", err)
+	}
+	projectIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to get linked tasks: %w", err)
+	}
+	if len(projectIDs) != 2 {
+		return fmt.Errorf("linked task not found: %w", pgx.ErrNoRows)
+	}
+	if projectIDs[0] != projectIDs[1] {
+		return ErrLinkAcrossProjects
+	}
+	projectID := projectIDs[0]
+
+	if _, err := tx.Exec(ctx, `select id from projects where id = $1 for update`, projectID); err != nil {
+		return fmt.Errorf("failed to lock project for link: %w", err)
+	}
+
+	switch link.Type {
+	case models.TaskLinkRelatesTo:
+		// relates-to goes both ways, so the reverse link is the same link
+		var exists bool
+		query := `select exists (select 1 from task_links where source_task_id = $1 and target_task_id = $2 and link_type = $3)`
+		if err := tx.QueryRow(ctx, query, link.TargetTaskID, link.SourceTaskID, link.Type).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check existing links: %w", err)
+		}
+		if exists {
+			return ErrLinkExists
+		}
+	case models.TaskLinkBlocks:
+		blocked, err := blocksTransitively(ctx, tx, link.TargetTaskID, link.SourceTaskID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlockingCycle
+		}
+	}
+
+	query := `
+	insert into task_links (id, source_task_id, target_task_id, link_type, created_by, created_at)
+	values ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = tx.Exec(ctx, query, link.ID, link.SourceTaskID, link.TargetTaskID, link.Type, link.CreatedBy, link.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrLinkExists
+		}
+		return fmt.Errorf("failed to create link: %w", err)
+	}
+
+	var actorID uuid.UUID
+	if link.CreatedBy != nil {
+		actorID = *link.CreatedBy
+	}
+	err = recordActivity(ctx, tx, activity{
+		projectID:  projectID,
+		entityType: models.ActivityEntityTask,
+		entityID:   link.SourceTaskID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    []fieldChange{{field: link.Type, newValue: link.TargetTaskID}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit link: %w", err)
+	}
+	return nil
+}
+
+// blocksTransitively reports whether from blocks to, directly or through a
+// chain of blocking links.
+func blocksTransitively(ctx context.Context, tx pgx.Tx, from, to uuid.UUID) (bool, error) {
+	query := `
+	with recursive reachable (task_id) as (
+		select target_task_id from task_links where source_task_id = $1 and link_type = 'blocks'
+		union
+		select task_links.target_task_id from task_links
+		join reachable on task_links.source_task_id = reachable.task_id
+		where task_links.link_type = 'blocks'
+	)
+	select exists (select 1 from reachable where task_id = $2)
+	`
+	var blocks bool
+	if err := tx.QueryRow(ctx, query, from, to).Scan(&blocks); err != nil {
+		return false, fmt.Errorf("failed to check blocking chain: %w", err)
+	}
+	return blocks, nil
+}
+
+// checkBlockers returns ErrTaskBlocked when the project requires blockers to
+// be done first and a task blocking taskID is still open.
+func checkBlockers(ctx context.Context, tx pgx.Tx, workflow *models.Workflow, taskID uuid.UUID) error {
+	var required bool
+	if err := tx.QueryRow(ctx, `select require_blockers_done from projects where id = $1`, workflow.ProjectID).Scan(&required); err != nil {
+		return fmt.Errorf("failed to get project settings: %w", err)
+	}
+	if !required {
+		return nil
+	}
+
+	query := `
+	select exists (
+		select 1 from task_links
+		join tasks blocker on blocker.id = task_links.source_task_id
+		where task_links.target_task_id = $1 and task_links.link_type = 'blocks' and blocker.status <> all($2::text[])
+	)
+	`
+	var blocked bool
+	if err := tx.QueryRow(ctx, query, taskID, workflow.DoneStatuses()).Scan(&blocked); err != nil {
+		return fmt.Errorf("failed to check blockers: %w", err)
+	}
+	if blocked {
+		return ErrTaskBlocked
+	}
+	return nil
+}
+
+func (r *PgTaskLinkRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.TaskLink, error) {
+	link, err := scanTaskLink(r.db.QueryRow(ctx, `select `+taskLinkColumns+` from task_links where id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("link not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+	return link, nil
+}
+
+func (r *PgTaskLinkRepository) Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin link transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	delete from task_links l
+	using tasks t
+	where l.id = $1 and t.id = l.source_task_id
+	returning t.project_id, l.source_task_id, l.target_task_id, l.link_type
+	`
+	var projectID, sourceTaskID, targetTaskID uuid.UUID
+	var linkType string
+	if err := tx.QueryRow(ctx, query, id).Scan(&projectID, &sourceTaskID, &targetTaskID, &linkType); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("link not found when tried to delete: %w", err)
+		}
+		return fmt.Errorf("failed to delete link: %w", err)
+	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  projectID,
+		entityType: models.ActivityEntityTask,
+		entityID:   sourceTaskID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    []fieldChange{{field: linkType, oldValue: targetTaskID}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit link deletion: %w", err)
+	}
+	return nil
+}
+
+// ListByTask returns the links from and to a task, oldest first.
+func (r *PgTaskLinkRepository) ListByTask(ctx context.Context, taskID uuid.UUID) ([]*models.TaskLink, error) {
+	query := `
+	select ` + taskLinkColumns + `
+	from task_links
+	where source_task_id = $1 or target_task_id = $1
+	order by created_at
+	`
+	return r.list(ctx, query, taskID)
+}
+
+func (r *PgTaskLinkRepository) Graph(ctx context.Context, projectID uuid.UUID) (*DependencyGraph, error) {
+	workflow, err := loadWorkflow(ctx, r.db, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	select ` + taskLinkColumns + `
+	from task_links
+	where source_task_id in (select id from tasks where project_id = $1)
+	order by created_at
+	`
+	links, err := r.list(ctx, query, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	select t.id, t.title, t.type, t.status,
+		exists (
+			select 1 from task_links l
+			join tasks blocker on blocker.id = l.source_task_id
+			where l.target_task_id = t.id and l.link_type = 'blocks' and blocker.status <> all($2::text[])
+		)
+	from tasks t
+	where t.project_id = $1
+		and exists (select 1 from task_links l where l.source_task_id = t.id or l.target_task_id = t.id)
+	order by t.created_at
+	`
+	rows, err := r.db.Query(ctx, query, projectID, workflow.DoneStatuses())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependency graph: %w", err)
+	}
+	nodes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (DependencyNode, error) {
+		var node DependencyNode
+		err := row.Scan(&node.ID, &node.Title, &node.Type, &node.Status, &node.Blocked)
+		return node, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependency graph: %w", err)
+	}
+	if nodes == nil {
+		nodes = []DependencyNode{}
+	}
+	return &DependencyGraph{Nodes: nodes, Links: links}, nil
+}
+
+func (r *PgTaskLinkRepository) list(ctx context.Context, query string, args ...any) ([]*models.TaskLink, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.TaskLink, error) {
+		return scanTaskLink(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	if links == nil {
+		links = []*models.TaskLink{}
+	}
+	return links, nil
+}
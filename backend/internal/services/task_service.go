@@ -0,0 +1,801 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+type TaskRepository interface {
+	Create(ctx context.Context, task *models.Task, actorID uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Task, error)
+	Update(ctx context.Context, task *models.Task, actorID uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error
+	ListByProject(ctx context.Context, projectID uuid.UUID, filter TaskFilter, q ListQuery) ([]*models.Task, error)
+	ListByAssignee(ctx context.Context, assigneeID, viewerID uuid.UUID, limit, offset int) ([]*models.Task, error)
+	ListBoard(ctx context.Context, projectID uuid.UUID) ([]*models.Task, error)
+	ListBySprint(ctx context.Context, sprintID uuid.UUID) ([]*models.Task, error)
+	ListBacklog(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]*models.Task, error)
+	Move(ctx context.Context, id uuid.UUID, status string, position int, actorID uuid.UUID) (*models.Task, error)
+	GetTree(ctx context.Context, id uuid.UUID) (*TaskTree, error)
+}
+
+var (
+	ErrParentNotFound     = errors.New("parent task not found")
+	ErrParentNotInProject = errors.New("parent task belongs to another project")
+	ErrInvalidParentType  = errors.New("parent task type can't have children of this type")
+	ErrSubtaskNeedsParent = errors.New("a subtask needs a parent task")
+	ErrChildTypeConflict  = errors.New("task has children its new type can't have")
+)
+
+// TaskFilter narrows down a task list. Tasks match LabelIDs when they have
+// any of the labels, or all of them with MatchAllLabels, and they have to
+// match every custom value filter. An empty filter matches every task.
+type TaskFilter struct {
+	LabelIDs       []uuid.UUID
+	MatchAllLabels bool
+	CustomValues   []CustomValueFilter
+}
+
+// CustomValueFilter matches tasks whose value of the custom field equals
+// Value, or for multi selects, includes it.
+type CustomValueFilter struct {
+	FieldID uuid.UUID
+	Value   any
+}
+
+// taskColumns is the column list every task query selects, in the order
+// scanTask reads them. The task's label IDs come sorted.
+const taskColumns = `id, type, parent_id, title, description, project_id, assignee_id, status, position, priority, due_date, sprint_id,
+	story_points, original_estimate_minutes, remaining_estimate_minutes, time_spent_minutes,
+	array(select label_id from task_labels where task_id = tasks.id order by label_id),
+	coalesce((select jsonb_object_agg(field_id, value) from task_custom_values where task_id = tasks.id), '{}'),
+	created_at, updated_at`
+
+type PgTaskRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgTaskRepository(db *pgxpool.Pool) *PgTaskRepository {
+	return &PgTaskRepository{db: db}
+}
+
+// Create inserts the task. A task without a status starts in the initial
+// status of the project's workflow.
+func (r *PgTaskRepository) Create(ctx context.Context, task *models.Task, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin task transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the same lock Move and workflow changes take, so concurrent creates
+	// don't share a position and the status can't be dropped meanwhile
+	if _, err := tx.Exec(ctx, `select id from projects where id = $1 for update`, task.ProjectID); err != nil {
+		return fmt.Errorf("failed to lock project for task: %w", err)
+	}
+
+	if err := checkParent(ctx, tx, task); err != nil {
+		return err
+	}
+	workflow, err := loadWorkflow(ctx, tx, task.ProjectID)
+	if err != nil {
+		return err
+	}
+	if task.Status == "" {
+		task.Status = workflow.InitialStatus()
+	} else if _, ok := workflow.Status(task.Status); !ok && !workflow.Default {
+		return fmt.Errorf("%w: %s", ErrUnknownStatus, task.Status)
+	}
+
+	query := `
+	insert into tasks (id, title, description, project_id, assignee_id, status, position, priority, due_date,
+		story_points, original_estimate_minutes, remaining_estimate_minutes, type, parent_id, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6,
+		(select coalesce(max(position) + 1, 0) from tasks where project_id = $4 and status = $6),
+		$7, $8, $9, $10, $11, $12, $13, $14, $15)
+	returning position
+	`
+	err = tx.QueryRow(ctx, query, task.ID, task.Title, task.Description, task.ProjectID, task.AssigneeID, task.Status, task.Priority, task.DueDate,
+		task.StoryPoints, task.OriginalEstimateMinutes, task.RemainingEstimateMinutes, task.Type, task.ParentID, task.CreatedAt, task.UpdatedAt).Scan(&task.Position)
+	if err != nil {
+		return fmt.Errorf("failed to create task in db: %w", err)
+	}
+
+	changes := []fieldChange{
+		{field: "title", newValue: task.Title},
+		{field: "status", newValue: task.Status},
+	}
+	if task.StoryPoints != nil {
+		changes = append(changes, fieldChange{field: "story_points", newValue: task.StoryPoints})
+	}
+	if task.ParentID != nil {
+		changes = append(changes, fieldChange{field: "parent_id", newValue: task.ParentID})
+	}
+	if len(task.LabelIDs) > 0 {
+		if err := setTaskLabels(ctx, tx, task); err != nil {
+			return err
+		}
+		changes = append(changes, fieldChange{field: "label_ids", newValue: task.LabelIDs})
+	} else {
+		task.LabelIDs = []uuid.UUID{}
+	}
+	customChanges, err := setCustomValues(ctx, tx, task.ID, nil, task.CustomFields)
+	if err != nil {
+		return err
+	}
+	changes = append(changes, customChanges...)
+	if task.CustomFields == nil {
+		task.CustomFields = map[string]any{}
+	}
+	err = recordActivity(ctx, tx, activity{
+		projectID:  task.ProjectID,
+		entityType: models.ActivityEntityTask,
+		entityID:   task.ID,
+		actorID:    actorID,
+		action:     models.ActivityCreated,
+		changes:    changes,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit task creation: %w", err)
+	}
+	return nil
+}
+
+func (r *PgTaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Task, error) {
+	query := `
+	select ` + taskColumns + `
+	from tasks
+	where id = $1
+	`
+	task, err := scanTask(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task record not found (finding by id): %w", err)
+		}
+		return nil, fmt.Errorf("failed to get task by id: %w", err)
+	}
+	return task, nil
+}
+
+// Update saves the task and records every changed field in its history. A
+// status change has to be allowed by the project's workflow.
+func (r *PgTaskRepository) Update(ctx context.Context, task *models.Task, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin task transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// a status change moves the task to the end of another column and has
+	// to be allowed by the workflow, so the project is locked first, in the
+	// same order as Move, to give it a position no concurrent change takes
+	// and keep the workflow from changing until the task is saved
+	var projectID uuid.UUID
+	if err := tx.QueryRow(ctx, `select project_id from tasks where id = $1`, task.ID).Scan(&projectID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("task not found when tried to update: %w", err)
+		}
+		return fmt.Errorf("failed to get task to update: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `select id from projects where id = $1 for update`, projectID); err != nil {
+		return fmt.Errorf("failed to lock project for task: %w", err)
+	}
+
+	oldTask, err := scanTask(tx.QueryRow(ctx, `select `+taskColumns+` from tasks where id = $1 for update`, task.ID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("task not found when tried to update: %w", err)
+		}
+		return fmt.Errorf("failed to get task to update: %w", err)
+	}
+	if err := checkParent(ctx, tx, task); err != nil {
+		return err
+	}
+	if task.Type != oldTask.Type {
+		if err := checkChildren(ctx, tx, task); err != nil {
+			return err
+		}
+	}
+	if task.Status != oldTask.Status {
+		if err := checkStatusChange(ctx, tx, oldTask, task.Status, actorID); err != nil {
+			return err
+		}
+	}
+	task.LabelIDs = sortLabelIDs(task.LabelIDs)
+	if !slices.Equal(task.LabelIDs, oldTask.LabelIDs) {
+		if err := setTaskLabels(ctx, tx, task); err != nil {
+			return err
+		}
+	}
+
+	query := `
+	update tasks t
+	set title = $2, description = $3, assignee_id = $4, priority = $6, due_date = $7, updated_at = $8,
+		story_points = $9, original_estimate_minutes = $10, remaining_estimate_minutes = $11, type = $12, parent_id = $13,
+		position = case when t.status = $5 then t.position
+			else (select coalesce(max(position) + 1, 0) from tasks where project_id = t.project_id and status = $5) end,
+		status = $5
+	where t.id = $1
+	returning t.position, t.time_spent_minutes
+	`
+	err = tx.QueryRow(ctx, query, task.ID, task.Title, task.Description, task.AssigneeID, task.Status, task.Priority, task.DueDate, task.UpdatedAt,
+		task.StoryPoints, task.OriginalEstimateMinutes, task.RemainingEstimateMinutes, task.Type, task.ParentID).Scan(&task.Position, &task.TimeSpentMinutes)
+	if err != nil {
+		return fmt.Errorf("failed to update task in db: %w", err)
+	}
+
+	customChanges, err := setCustomValues(ctx, tx, task.ID, oldTask.CustomFields, task.CustomFields)
+	if err != nil {
+		return err
+	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  oldTask.ProjectID,
+		entityType: models.ActivityEntityTask,
+		entityID:   task.ID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    append(diffTask(oldTask, task), customChanges...),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit task update: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the task together with its subtasks. Other children, such
+// as the stories of an epic, stay and lose their parent.
+func (r *PgTaskRepository) Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin task transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := releaseChildren(ctx, tx, id, actorID); err != nil {
+		return err
+	}
+	if err := deleteTask(ctx, tx, id, actorID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit task deletion: %w", err)
+	}
+	return nil
+}
+
+// deleteTask deletes one task and records the deletion.
+func deleteTask(ctx context.Context, tx pgx.Tx, id uuid.UUID, actorID uuid.UUID) error {
+	query := `
+	delete from tasks
+	where id = $1
+	returning project_id, title, status
+	`
+	var projectID uuid.UUID
+	var title, status string
+	if err := tx.QueryRow(ctx, query, id).Scan(&projectID, &title, &status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("task not found when tried to delete: %w", err)
+		}
+		return fmt.Errorf("failed to delete task from db: %w", err)
+	}
+
+	return recordActivity(ctx, tx, activity{
+		projectID:  projectID,
+		entityType: models.ActivityEntityTask,
+		entityID:   id,
+		actorID:    actorID,
+		action:     models.ActivityDeleted,
+		changes: []fieldChange{
+			{field: "title", oldValue: title},
+			{field: "status", oldValue: status},
+		},
+	})
+}
+
+// releaseChildren deletes the subtasks of a task that is about to be deleted
+// and takes its other children out of the hierarchy.
+func releaseChildren(ctx context.Context, tx pgx.Tx, parentID uuid.UUID, actorID uuid.UUID) error {
+	rows, err := tx.Query(ctx, `select id, project_id, type from tasks where parent_id = $1 for update`, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to get child tasks: %w", err)
+	}
+	type child struct {
+		id        uuid.UUID
+		projectID uuid.UUID
+		taskType  string
+	}
+	var children []child
+	var c child
+	_, err = pgx.ForEachRow(rows, []any{&c.id, &c.projectID, &c.taskType}, func() error {
+		children = append(children, c)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get child tasks: %w", err)
+	}
+
+	for _, c := range children {
+		if models.TaskTypeNeedsParent(c.taskType) {
+			if err := deleteTask(ctx, tx, c.id, actorID); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(ctx, `update tasks set parent_id = null, updated_at = now() where id = $1`, c.id); err != nil {
+			return fmt.Errorf("failed to detach child task: %w", err)
+		}
+		err = recordActivity(ctx, tx, activity{
+			projectID:  c.projectID,
+			entityType: models.ActivityEntityTask,
+			entityID:   c.id,
+			actorID:    actorID,
+			action:     models.ActivityUpdated,
+			changes:    []fieldChange{{field: "parent_id", oldValue: parentID, newValue: nil}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkParent makes sure the task's parent exists in the same project and
+// its type can hold the task. The parent row is locked so its type can't
+// change underneath the new child.
+func checkParent(ctx context.Context, tx pgx.Tx, task *models.Task) error {
+	if task.ParentID == nil {
+		if models.TaskTypeNeedsParent(task.Type) {
+			return ErrSubtaskNeedsParent
+		}
+		return nil
+	}
+	if *task.ParentID == task.ID {
+		return ErrInvalidParentType
+	}
+
+	var projectID uuid.UUID
+	var parentType string
+	err := tx.QueryRow(ctx, `select project_id, type from tasks where id = $1 for share`, *task.ParentID).Scan(&projectID, &parentType)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrParentNotFound
+		}
+		return fmt.Errorf("failed to get parent task: %w", err)
+	}
+	if projectID != task.ProjectID {
+		return ErrParentNotInProject
+	}
+	if !models.TaskTypeCanParent(parentType, task.Type) {
+		return ErrInvalidParentType
+	}
+	return nil
+}
+
+// checkChildren makes sure the task's new type can still hold its children.
+func checkChildren(ctx context.Context, tx pgx.Tx, task *models.Task) error {
+	rows, err := tx.Query(ctx, `select distinct type from tasks where parent_id = $1`, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get child task types: %w", err)
+	}
+	childTypes, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("failed to get child task types: %w", err)
+	}
+	for _, childType := range childTypes {
+		if !models.TaskTypeCanParent(task.Type, childType) {
+			return ErrChildTypeConflict
+		}
+	}
+	return nil
+}
+
+// taskListSpec is what project task lists can be filtered, sorted and
+// searched by, next to their labels and custom values.
+var taskListSpec = listSpec{
+	fields: map[string]listField{
+		"title":        {column: "title"},
+		"status":       {column: "status"},
+		"priority":     {column: "priority"},
+		"type":         {column: "type"},
+		"assignee_id":  {column: "assignee_id", kind: listFieldUUID, nullable: true},
+		"sprint_id":    {column: "sprint_id", kind: listFieldUUID, nullable: true},
+		"parent_id":    {column: "parent_id", kind: listFieldUUID, nullable: true},
+		"due_date":     {column: "due_date", kind: listFieldTime, nullable: true},
+		"story_points": {column: "story_points", kind: listFieldInt, nullable: true},
+		"created_at":   {column: "created_at", kind: listFieldTime},
+		"updated_at":   {column: "updated_at", kind: listFieldTime},
+	},
+	search:       []string{"title", "description"},
+	defaultOrder: "created_at desc, id",
+}
+
+func (r *PgTaskRepository) ListByProject(ctx context.Context, projectID uuid.UUID, filter TaskFilter, q ListQuery) ([]*models.Task, error) {
+	var b queryBuilder
+	b.where("project_id = ?", projectID)
+	if len(filter.LabelIDs) > 0 {
+		labelIDs := sortLabelIDs(filter.LabelIDs)
+		required := 1
+		if filter.MatchAllLabels {
+			required = len(labelIDs)
+		}
+		b.where("(select count(*) from task_labels where task_id = tasks.id and label_id = any(?)) >= ?", labelIDs, required)
+	}
+	if len(filter.CustomValues) > 0 {
+		var fieldIDs []uuid.UUID
+		var fieldValues []string
+		for _, custom := range filter.CustomValues {
+			value, err := json.Marshal(custom.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode custom field filter: %w", err)
+			}
+			fieldIDs = append(fieldIDs, custom.FieldID)
+			fieldValues = append(fieldValues, string(value))
+		}
+		// a json array contains a scalar it has as an element, so one
+		// containment check covers single values and multi selects
+		b.where(`not exists (
+			select 1 from unnest(?::uuid[], ?::jsonb[]) as f(field_id, value)
+			where not exists (
+				select 1 from task_custom_values v
+				where v.task_id = tasks.id and v.field_id = f.field_id and v.value @> f.value
+			)
+		)`, fieldIDs, fieldValues)
+	}
+	orderBy, err := taskListSpec.apply(&b, q)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	select ` + taskColumns + `
+	from tasks` + b.whereClause() + orderBy + b.page(q.Limit, q.Offset)
+	return r.list(ctx, query, b.args...)
+}
+
+// ListByAssignee returns the tasks assigned to the assignee in projects the
+// viewer is a member of. Tasks the viewer can't see are left out before
+// paging, so pages stay full and don't give away that hidden tasks exist.
+func (r *PgTaskRepository) ListByAssignee(ctx context.Context, assigneeID, viewerID uuid.UUID, limit, offset int) ([]*models.Task, error) {
+	query := `
+	select ` + taskColumns + `
+	from tasks
+	where assignee_id = $1
+		and project_id in (select project_id from project_members where user_id = $2)
+	order by created_at desc, id
+	limit $3 offset $4
+	`
+	return r.list(ctx, query, assigneeID, viewerID, limit, offset)
+}
+
+// ListBoard returns every task of the project ordered by status column and
+// rank within the column.
+func (r *PgTaskRepository) ListBoard(ctx context.Context, projectID uuid.UUID) ([]*models.Task, error) {
+	query := `
+	select ` + taskColumns + `
+	from tasks
+	where project_id = $1
+	order by status, position, created_at
+	`
+	return r.list(ctx, query, projectID)
+}
+
+// ListBySprint returns the tasks of the sprint ordered like the board.
+func (r *PgTaskRepository) ListBySprint(ctx context.Context, sprintID uuid.UUID) ([]*models.Task, error) {
+	query := `
+	select ` + taskColumns + `
+	from tasks
+	where sprint_id = $1
+	order by status, position, created_at
+	`
+	return r.list(ctx, query, sprintID)
+}
+
+// ListBacklog returns the project's tasks that are not planned into a sprint.
+func (r *PgTaskRepository) ListBacklog(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]*models.Task, error) {
+	query := `
+	select ` + taskColumns + `
+	from tasks
+	where project_id = $1 and sprint_id is null
+	order by created_at desc
+	limit $2 offset $3
+	`
+	return r.list(ctx, query, projectID, limit, offset)
+}
+
+// Move places the task at the given zero-based position of the status column
+// and renumbers the columns it left and entered. The project row is locked for
+// the duration of the transaction so concurrent moves within one project are
+// applied one after the other instead of interleaving their renumbering.
+func (r *PgTaskRepository) Move(ctx context.Context, id uuid.UUID, status string, position int, actorID uuid.UUID) (*models.Task, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin move transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var projectID uuid.UUID
+	var oldStatus string
+	err = tx.QueryRow(ctx, `select project_id, status from tasks where id = $1`, id).Scan(&projectID, &oldStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task not found when tried to move: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get task to move: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `select id from projects where id = $1 for update`, projectID); err != nil {
+		return nil, fmt.Errorf("failed to lock project for move: %w", err)
+	}
+
+	// the task may have been moved by another transaction while we waited for the lock
+	oldTask, err := scanTask(tx.QueryRow(ctx, `select `+taskColumns+` from tasks where id = $1`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task to move: %w", err)
+	}
+	oldStatus, oldPosition := oldTask.Status, oldTask.Position
+	if status != oldStatus {
+		if err := checkStatusChange(ctx, tx, oldTask, status, actorID); err != nil {
+			return nil, err
+		}
+	}
+
+	column, err := columnTaskIDs(ctx, tx, projectID, status, id)
+	if err != nil {
+		return nil, err
+	}
+	position = max(0, min(position, len(column)))
+	column = slices.Insert(column, position, id)
+
+	_, err = tx.Exec(ctx, `update tasks set status = $2, updated_at = now() where id = $1`, id, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move task: %w", err)
+	}
+	if err := renumberTasks(ctx, tx, column); err != nil {
+		return nil, err
+	}
+
+	if oldStatus != status {
+		oldColumn, err := columnTaskIDs(ctx, tx, projectID, oldStatus, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := renumberTasks(ctx, tx, oldColumn); err != nil {
+			return nil, err
+		}
+	}
+
+	task, err := scanTask(tx.QueryRow(ctx, `select `+taskColumns+` from tasks where id = $1`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moved task: %w", err)
+	}
+
+	var changes []fieldChange
+	changes = diffField(changes, "status", oldStatus, task.Status)
+	changes = diffField(changes, "position", oldPosition, task.Position)
+	if len(changes) > 0 {
+		err = recordActivity(ctx, tx, activity{
+			projectID:  projectID,
+			entityType: models.ActivityEntityTask,
+			entityID:   id,
+			actorID:    actorID,
+			action:     models.ActivityMoved,
+			changes:    changes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit task move: %w", err)
+	}
+	return task, nil
+}
+
+// checkStatusChange makes sure the task may move to status: the project's
+// workflow has to allow it, and a task moving into a done status must not be
+// held up by its blockers.
+func checkStatusChange(ctx context.Context, tx pgx.Tx, task *models.Task, status string, actorID uuid.UUID) error {
+	workflow, err := loadWorkflow(ctx, tx, task.ProjectID)
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(ctx, tx, workflow, task, status, actorID); err != nil {
+		return err
+	}
+	if workflow.IsDone(status) && !workflow.IsDone(task.Status) {
+		return checkBlockers(ctx, tx, workflow, task.ID)
+	}
+	return nil
+}
+
+// TaskRollup sums up the progress of everything below a task in the
+// hierarchy. Unestimated tasks count zero points.
+type TaskRollup struct {
+	Total           int `json:"total"`
+	Done            int `json:"done"`
+	Points          int `json:"points"`
+	RemainingPoints int `json:"remaining_points"`
+}
+
+// TaskNode is a task with its children and the roll-up of its subtree.
+type TaskNode struct {
+	*models.Task
+	Rollup   TaskRollup  `json:"rollup"`
+	Children []*TaskNode `json:"children"`
+}
+
+// TaskTree is the subtree under a task, with the chain of parents above it
+// from the top of the hierarchy down.
+type TaskTree struct {
+	Ancestors []*models.Task `json:"ancestors"`
+	Root      *TaskNode      `json:"root"`
+}
+
+// GetTree returns the task with its descendants and ancestors. Children are
+// ordered like the board.
+func (r *PgTaskRepository) GetTree(ctx context.Context, id uuid.UUID) (*TaskTree, error) {
+	query := `
+	with recursive subtree (node_id, depth) as (
+		select id, 0 from tasks where id = $1
+		union all
+		select tasks.id, subtree.depth + 1 from tasks join subtree on tasks.parent_id = subtree.node_id
+	)
+	select ` + taskColumns + `
+	from tasks
+	join subtree on node_id = tasks.id
+	order by depth, status, position, created_at
+	`
+	tasks, err := r.list(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("task record not found (building tree): %w", pgx.ErrNoRows)
+	}
+
+	query = `
+	with recursive ancestors (ancestor_id, depth) as (
+		select parent_id, 1 from tasks where id = $1 and parent_id is not null
+		union all
+		select tasks.parent_id, ancestors.depth + 1 from tasks join ancestors on tasks.id = ancestors.ancestor_id
+		where tasks.parent_id is not null
+	)
+	select ` + taskColumns + `
+	from tasks
+	join ancestors on ancestor_id = tasks.id
+	order by depth desc
+	`
+	ancestors, err := r.list(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if ancestors == nil {
+		ancestors = []*models.Task{}
+	}
+
+	// parents come before their children, ordered by depth
+	nodes := make(map[uuid.UUID]*TaskNode, len(tasks))
+	for _, task := range tasks {
+		node := &TaskNode{Task: task, Children: []*TaskNode{}}
+		nodes[task.ID] = node
+		if task.ID != id && task.ParentID != nil {
+			if parent, ok := nodes[*task.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+			}
+		}
+	}
+	workflow, err := loadWorkflow(ctx, r.db, tasks[0].ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	root := nodes[id]
+	rollUp(root, workflow)
+	return &TaskTree{Ancestors: ancestors, Root: root}, nil
+}
+
+// rollUp fills in the roll-up of the node and everything below it.
+func rollUp(node *TaskNode, workflow *models.Workflow) {
+	for _, child := range node.Children {
+		rollUp(child, workflow)
+		points := 0
+		if child.StoryPoints != nil {
+			points = *child.StoryPoints
+		}
+		done := workflow.IsDone(child.Status)
+
+		node.Rollup.Total += 1 + child.Rollup.Total
+		node.Rollup.Done += child.Rollup.Done
+		node.Rollup.Points += points + child.Rollup.Points
+		node.Rollup.RemainingPoints += child.Rollup.RemainingPoints
+		if done {
+			node.Rollup.Done++
+		} else {
+			node.Rollup.RemainingPoints += points
+		}
+	}
+}
+
+// columnTaskIDs returns the ids of a board column in rank order, leaving out
+// the excluded task.
+func columnTaskIDs(ctx context.Context, tx pgx.Tx, projectID uuid.UUID, status string, exclude uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, `
+	select id from tasks
+	where project_id = $1 and status = $2 and id <> $3
+	order by position, created_at
+	`, projectID, status, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read board column: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read board column: %w", err)
+	}
+	return ids, nil
+}
+
+// renumberTasks sets each task's position to its index in ids.
+func renumberTasks(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+	update tasks set position = v.ord - 1
+	from unnest($1::uuid[]) with ordinality as v(id, ord)
+	where tasks.id = v.id
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to renumber board column: %w", err)
+	}
+	return nil
+}
+
+func (r *PgTaskRepository) list(ctx context.Context, query string, args ...any) ([]*models.Task, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating task rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+func scanTask(row pgx.Row) (*models.Task, error) {
+	task := &models.Task{}
+	err := row.Scan(
+		&task.ID, &task.Type, &task.ParentID, &task.Title, &task.Description, &task.ProjectID, &task.AssigneeID, &task.Status, &task.Position, &task.Priority, &task.DueDate, &task.SprintID,
+		&task.StoryPoints, &task.OriginalEstimateMinutes, &task.RemainingEstimateMinutes, &task.TimeSpentMinutes, &task.LabelIDs, &task.CustomFields, &task.CreatedAt, &task.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
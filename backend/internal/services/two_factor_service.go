@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTwoFactorChallenge = errors.New("two-factor login has expired, please log in again")
+)
+
+// maxChallengeAttempts is how many codes can be tried against one login
+// challenge before the user has to start over with their password.
+const maxChallengeAttempts = 5
+
+type TwoFactorRepository interface {
+	SavePendingSecret(ctx context.Context, userID uuid.UUID, secretEncrypted string) error
+	Get(ctx context.Context, userID uuid.UUID) (*models.TwoFactor, error)
+	IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error)
+	Enable(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	Disable(ctx context.Context, userID uuid.UUID) error
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	CreateChallenge(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	AttemptChallenge(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error)
+	CompleteChallenge(ctx context.Context, id uuid.UUID) error
+}
+
+type PgTwoFactorRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgTwoFactorRepository(db *pgxpool.Pool) *PgTwoFactorRepository {
+	return &PgTwoFactorRepository{db: db}
+}
+
+// SavePendingSecret stores a new secret that still has to be confirmed,
+// replacing any earlier unconfirmed one.
+func (r *PgTwoFactorRepository) SavePendingSecret(ctx context.Context, userID uuid.UUID, secretEncrypted string) error {
+	query := `
+	insert into user_totp (user_id, secret_encrypted)
+	values ($1, $2)
+	on conflict (user_id) do update
+	set secret_encrypted = excluded.secret_encrypted, last_used_step = null, created_at = now()
+	where user_totp.enabled_at is null
+	`
+	result, err := r.db.Exec(ctx, query, userID, secretEncrypted)
+	if err != nil {
+		return fmt.Errorf("failed to save totp secret: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *PgTwoFactorRepository) Get(ctx context.Context, userID uuid.UUID) (*models.TwoFactor, error) {
+	query := `
+	select user_id, secret_encrypted, enabled_at, last_used_step, created_at
+	from user_totp
+	where user_id = $1
+	`
+	tf := &models.TwoFactor{}
+	err := r.db.QueryRow(ctx, query, userID).Scan(&tf.UserID, &tf.SecretEncrypted, &tf.EnabledAt, &tf.LastUsedStep, &tf.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("two-factor enrollment not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get two-factor enrollment: %w", err)
+	}
+	return tf, nil
+}
+
+func (r *PgTwoFactorRepository) IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	query := `
+	select exists (select 1 from user_totp where user_id = $1 and enabled_at is not null)
+	`
+	var enabled bool
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to check two-factor enrollment: %w", err)
+	}
+	return enabled, nil
+}
+
+// Enable confirms the pending secret, recording the step of the code that
+// confirmed it, and replaces the user's recovery codes.
+func (r *PgTwoFactorRepository) Enable(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin two-factor transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+	update user_totp set enabled_at = now(), last_used_step = $2
+	where user_id = $1 and enabled_at is null
+	`, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if _, err := tx.Exec(ctx, `delete from user_recovery_codes where user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to remove old recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, `insert into user_recovery_codes (user_id, code_hash) values ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit two-factor enrollment: %w", err)
+	}
+	return nil
+}
+
+func (r *PgTwoFactorRepository) Disable(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin two-factor transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `delete from user_totp where user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `delete from user_recovery_codes where user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit two-factor removal: %w", err)
+	}
+	return nil
+}
+
+// UseStep records that a code of the given step was accepted. It reports
+// false when a code of that step or a later one was already used, so a code
+// that was seen by someone else can't be replayed.
+func (r *PgTwoFactorRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	query := `
+	update user_totp set last_used_step = $2
+	where user_id = $1 and (last_used_step is null or last_used_step < $2)
+	`
+	result, err := r.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode marks the recovery code as used, reporting false when the
+// user has no such unused code.
+func (r *PgTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	query := `
+	update user_recovery_codes set used_at = now()
+	where user_id = $1 and code_hash = $2 and used_at is null
+	`
+	result, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *PgTwoFactorRepository) CreateChallenge(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	query := `
+	insert into two_factor_challenges (user_id, token_hash, expires_at)
+	values ($1, $2, $3)
+	`
+	if _, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to create two-factor challenge: %w", err)
+	}
+	return nil
+}
+
+// AttemptChallenge counts an attempt against the login challenge and returns
+// its id and user. Expired, completed and exhausted challenges return
+// ErrInvalidTwoFactorChallenge.
+func (r *PgTwoFactorRepository) AttemptChallenge(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error) {
+	query := `
+	update two_factor_challenges set attempts = attempts + 1
+	where token_hash = $1 and used_at is null and expires_at > now() and attempts < $2
+	returning id, user_id
+	`
+	var id, userID uuid.UUID
+	err := r.db.QueryRow(ctx, query, tokenHash, maxChallengeAttempts).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, uuid.Nil, ErrInvalidTwoFactorChallenge
+		}
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to check two-factor challenge: %w", err)
+	}
+	return id, userID, nil
+}
+
+// CompleteChallenge marks the challenge used so it can't start a second
+// session.
+func (r *PgTwoFactorRepository) CompleteChallenge(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `update two_factor_challenges set used_at = now() where id = $1 and used_at is null`, id)
+	if err != nil {
+		return fmt.Errorf("failed to complete two-factor challenge: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrInvalidTwoFactorChallenge
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var ErrIdentityConflict = errors.New("identity or user already exists")
+
+type UserIdentityRepository interface {
+	GetByIssuerSubject(ctx context.Context, issuer, subject string) (*models.UserIdentity, error)
+	Link(ctx context.Context, identity *models.UserIdentity) error
+	CreateWithUser(ctx context.Context, user *models.User, identity *models.UserIdentity) error
+	RecordLogin(ctx context.Context, id uuid.UUID, email string) error
+}
+
+type PgUserIdentityRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgUserIdentityRepository(db *pgxpool.Pool) *PgUserIdentityRepository {
+	return &PgUserIdentityRepository{db: db}
+}
+
+// GetByIssuerSubject returns the identity, or an error wrapping
+// pgx.ErrNoRows when the external account has not been linked yet.
+func (r *PgUserIdentityRepository) GetByIssuerSubject(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	query := `
+	select id, user_id, issuer, subject, email, created_at, last_login_at
+	from user_identities
+	where issuer = $1 and subject = $2
+	`
+	identity := &models.UserIdentity{}
+	err := r.db.QueryRow(ctx, query, issuer, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user identity not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return identity, nil
+}
+
+// Link attaches the external identity to an existing user.
+func (r *PgUserIdentityRepository) Link(ctx context.Context, identity *models.UserIdentity) error {
+	return insertIdentity(ctx, r.db, identity)
+}
+
+// CreateWithUser provisions a new user together with their identity, so a
+// failed link never leaves an account behind that nobody can log in to.
+func (r *PgUserIdentityRepository) CreateWithUser(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin identity transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	insert into users (id, email, username, full_name, password, avatar_url, role, email_verified_at, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.Exec(ctx, query, user.ID, user.Email, user.Username, user.FullName, user.Password, user.AvatarURL, user.Role, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrIdentityConflict
+		}
+		return fmt.Errorf("failed to create user in db: %w", err)
+	}
+
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user identity: %w", err)
+	}
+	return nil
+}
+
+// execer is satisfied by both the pool and a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertIdentity(ctx context.Context, db execer, identity *models.UserIdentity) error {
+	query := `
+	insert into user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := db.Exec(ctx, query, identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt, identity.LastLoginAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrIdentityConflict
+		}
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	return nil
+}
+
+// RecordLogin stores the time of the login and the email the provider
+// currently reports for the identity.
+func (r *PgUserIdentityRepository) RecordLogin(ctx context.Context, id uuid.UUID, email string) error {
+	query := `
+	update user_identities set last_login_at = now(), email = $2
+	where id = $1
+	`
+	if _, err := r.db.Exec(ctx, query, id, email); err != nil {
+		return fmt.Errorf("failed to record identity login: %w", err)
+	}
+	return nil
+}
@@ -19,8 +19,12 @@ type UserRepository interface {
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
+	UpdateRole(ctx context.Context, id uuid.UUID, role string) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, hashedPassword string) error
 	Delete(ctx context.Context, id uuid.UUID) error
-	List(ctx context.Context, limit, offset int) ([]*models.User, error)
+	// List returns a page of users. Without private the query can't filter,
+	// sort or search by email address or role.
+	List(ctx context.Context, q ListQuery, private bool) ([]*models.User, error)
 }
 
 type PgUserRepository struct {
@@ -49,13 +53,13 @@ func (r *PgUserRepository) Create(ctx context.Context, user *models.User) error
 
 func (r *PgUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
-	select id, email, username, full_name, password, avatar_url, role, created_at, updated_at
+	select id, email, username, full_name, password, avatar_url, role, email_verified_at, created_at, updated_at
 	from users
 	where id = $1
 	`
 	user := &models.User{}
 	err := r.db.QueryRow(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -70,19 +74,19 @@ func (r *PgUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.U
 
 func (r *PgUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-	select id, email, username, full_name, password, avatar_url, role, created_at, updated_at
+	select id, email, username, full_name, password, avatar_url, role, email_verified_at, created_at, updated_at
 	from users
 	where email = $1
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("No user with this email is found: please sign up first")
+			return nil, fmt.Errorf("No user with this email is found: please sign up first: %w", err)
 		}
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
@@ -92,14 +96,14 @@ func (r *PgUserRepository) GetByEmail(ctx context.Context, email string) (*model
 
 func (r *PgUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-	select id, email, username, full_name, password, avatar_url, role, created_at, updated_at
+	select id, email, username, full_name, password, avatar_url, role, email_verified_at, created_at, updated_at
 	from users
 	where username = $1
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRow(ctx, query, username).Scan(
-		&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -115,7 +119,8 @@ func (r *PgUserRepository) GetByUsername(ctx context.Context, username string) (
 func (r *PgUserRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 	update users
-	set email=$2, username=$3, full_name=$4, password=$5, avatar_url=$6, role=$7, updated_at=Now()
+	set email=$2, username=$3, full_name=$4, password=$5, avatar_url=$6, role=$7, updated_at=Now(),
+		email_verified_at = case when email = $2 then email_verified_at else null end
 	where id=$1
 	`
 
@@ -129,6 +134,40 @@ func (r *PgUserRepository) Update(ctx context.Context, user *models.User) error
 	return nil
 }
 
+func (r *PgUserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role string) error {
+	query := `
+	update users
+	set role=$2, updated_at=Now()
+	where id=$1
+	`
+
+	result, err := r.db.Exec(ctx, query, id, role)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found when tried to update role")
+	}
+	return nil
+}
+
+func (r *PgUserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, hashedPassword string) error {
+	query := `
+	update users
+	set password=$2, updated_at=Now()
+	where id=$1
+	`
+
+	result, err := r.db.Exec(ctx, query, id, hashedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to update user password: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found when tried to update password")
+	}
+	return nil
+}
+
 func (r *PgUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `
 	delete from users where id=$1
@@ -144,15 +183,51 @@ func (r *PgUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (r *PgUserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+// userListSpec is what user lists can be filtered, sorted and searched by.
+var userListSpec = listSpec{
+	fields: map[string]listField{
+		"username":       {column: "username"},
+		"email":          {column: "email"},
+		"full_name":      {column: "full_name"},
+		"role":           {column: "role"},
+		"email_verified": {column: "(email_verified_at is not null)", kind: listFieldBool},
+		"created_at":     {column: "created_at", kind: listFieldTime},
+		"updated_at":     {column: "updated_at", kind: listFieldTime},
+	},
+	search:       []string{"username", "email", "full_name"},
+	defaultOrder: "created_at desc, id",
+}
+
+// publicUserListSpec is userListSpec without the email address and role, for
+// callers who can't manage users.
+var publicUserListSpec = listSpec{
+	fields: map[string]listField{
+		"username":   {column: "username"},
+		"full_name":  {column: "full_name"},
+		"created_at": {column: "created_at", kind: listFieldTime},
+		"updated_at": {column: "updated_at", kind: listFieldTime},
+	},
+	search:       []string{"username", "full_name"},
+	defaultOrder: "created_at desc, id",
+}
+
+// List returns the users matching the query, newest first unless it sorts
+// them otherwise.
+func (r *PgUserRepository) List(ctx context.Context, q ListQuery, private bool) ([]*models.User, error) {
+	spec := publicUserListSpec
+	if private {
+		spec = userListSpec
+	}
+	var b queryBuilder
+	orderBy, err := spec.apply(&b, q)
+	if err != nil {
+		return nil, err
+	}
 	query := `
-	select id, email, username, full_name, password, avatar_url, role, updated_at, created_at
-	from users
-	order by created_at desc
-	limit $1 offset $2
-	`
+	select id, email, username, full_name, password, avatar_url, role, email_verified_at, created_at, updated_at
+	from users` + b.whereClause() + orderBy + b.page(q.Limit, q.Offset)
 
-	rows, err := r.db.Query(ctx, query, limit, offset)
+	rows, err := r.db.Query(ctx, query, b.args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query when listing: %w", err)
 	}
@@ -162,7 +237,7 @@ func (r *PgUserRepository) List(ctx context.Context, limit, offset int) ([]*mode
 	for rows.Next() {
 		var user models.User
 		err := rows.Scan(
-			&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+			&user.ID, &user.Email, &user.Username, &user.FullName, &user.Password, &user.AvatarURL, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("Error readinng row when listing: %w", err)
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+var (
+	ErrInvalidWorkflow      = errors.New("invalid workflow")
+	ErrStatusInUse          = errors.New("tasks still use statuses the workflow leaves out")
+	ErrUnknownStatus        = errors.New("status is not part of the project's workflow")
+	ErrTransitionNotAllowed = errors.New("the project's workflow doesn't allow this status change")
+	ErrTransitionGuard      = errors.New("status change is held back by the workflow")
+)
+
+type WorkflowRepository interface {
+	Get(ctx context.Context, projectID uuid.UUID) (*models.Workflow, error)
+	Replace(ctx context.Context, workflow *models.Workflow, actorID uuid.UUID) error
+	Reset(ctx context.Context, projectID uuid.UUID, actorID uuid.UUID) error
+}
+
+// querier is what loadWorkflow needs, so it can read through the pool or
+// inside a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type PgWorkflowRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgWorkflowRepository(db *pgxpool.Pool) *PgWorkflowRepository {
+	return &PgWorkflowRepository{db: db}
+}
+
+// loadWorkflow returns the project's workflow, or the default workflow when
+// the project hasn't defined one.
+func loadWorkflow(ctx context.Context, q querier, projectID uuid.UUID) (*models.Workflow, error) {
+	query := `
+	select key, name, category
+	from workflow_statuses
+	where project_id = $1
+	order by position
+	`
+	rows, err := q.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow statuses: %w", err)
+	}
+	statuses, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.WorkflowStatus, error) {
+		var status models.WorkflowStatus
+		err := row.Scan(&status.Key, &status.Name, &status.Category)
+		return status, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow statuses: %w", err)
+	}
+	if len(statuses) == 0 {
+		return models.DefaultWorkflow(projectID), nil
+	}
+
+	query = `
+	select from_status, to_status, guards
+	from workflow_transitions
+	where project_id = $1
+	order by id
+	`
+	rows, err = q.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow transitions: %w", err)
+	}
+	transitions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.WorkflowTransition, error) {
+		var transition models.WorkflowTransition
+		err := row.Scan(&transition.From, &transition.To, &transition.Guards)
+		return transition, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow transitions: %w", err)
+	}
+	if transitions == nil {
+		transitions = []models.WorkflowTransition{}
+	}
+
+	return &models.Workflow{ProjectID: projectID, Statuses: statuses, Transitions: transitions}, nil
+}
+
+func (r *PgWorkflowRepository) Get(ctx context.Context, projectID uuid.UUID) (*models.Workflow, error) {
+	return loadWorkflow(ctx, r.db, projectID)
+}
+
+// validateWorkflow checks that the workflow's statuses are unique, that its
+// transitions only use those statuses and known guards, and that tasks can
+// be finished.
+func validateWorkflow(workflow *models.Workflow) error {
+	if len(workflow.Statuses) == 0 {
+		return fmt.Errorf("%w: it needs at least one status", ErrInvalidWorkflow)
+	}
+	keys := make(map[string]bool, len(workflow.Statuses))
+	for _, status := range workflow.Statuses {
+		if keys[status.Key] {
+			return fmt.Errorf("%w: status %q is listed twice", ErrInvalidWorkflow, status.Key)
+		}
+		keys[status.Key] = true
+	}
+	if len(workflow.DoneStatuses()) == 0 {
+		return fmt.Errorf("%w: it needs at least one status in the done category", ErrInvalidWorkflow)
+	}
+
+	type route struct{ from, to string }
+	routes := make(map[route]bool, len(workflow.Transitions))
+	for _, transition := range workflow.Transitions {
+		from := "*"
+		if transition.From != nil {
+			from = *transition.From
+			if !keys[from] {
+				return fmt.Errorf("%w: transition from unknown status %q", ErrInvalidWorkflow, from)
+			}
+		}
+		if !keys[transition.To] {
+			return fmt.Errorf("%w: transition to unknown status %q", ErrInvalidWorkflow, transition.To)
+		}
+		if routes[route{from, transition.To}] {
+			return fmt.Errorf("%w: transition from %q to %q is listed twice", ErrInvalidWorkflow, from, transition.To)
+		}
+		routes[route{from, transition.To}] = true
+		for _, guard := range transition.Guards {
+			if !models.WorkflowGuardValid(guard) {
+				return fmt.Errorf("%w: unknown guard %q", ErrInvalidWorkflow, guard)
+			}
+		}
+	}
+	return nil
+}
+
+// Replace swaps the project's workflow for the given one. Statuses that tasks
+// are still in can't be left out. The project row is locked, as task
+// creates, updates and moves lock it too, so no task moves into a dropped
+// status while the workflow changes.
+func (r *PgWorkflowRepository) Replace(ctx context.Context, workflow *models.Workflow, actorID uuid.UUID) error {
+	if err := validateWorkflow(workflow); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin workflow transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	oldWorkflow, err := lockWorkflow(ctx, tx, workflow.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	keys := workflow.StatusKeys()
+	rows, err := tx.Query(ctx, `select distinct status from tasks where project_id = $1 and status <> all($2::text[]) order by status`, workflow.ProjectID, keys)
+	if err != nil {
+		return fmt.Errorf("failed to check task statuses: %w", err)
+	}
+	unknown, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("failed to check task statuses: %w", err)
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %s", ErrStatusInUse, strings.Join(unknown, ", "))
+	}
+
+	if _, err := tx.Exec(ctx, `delete from workflow_statuses where project_id = $1`, workflow.ProjectID); err != nil {
+		return fmt.Errorf("failed to clear workflow: %w", err)
+	}
+
+	names := make([]string, 0, len(workflow.Statuses))
+	categories := make([]string, 0, len(workflow.Statuses))
+	for _, status := range workflow.Statuses {
+		names = append(names, status.Name)
+		categories = append(categories, status.Category)
+	}
+	query := `
+	insert into workflow_statuses (project_id, key, name, category, position)
+	select $1, v.key, v.name, v.category, v.ord - 1
+	from unnest($2::text[], $3::text[], $4::text[]) with ordinality as v(key, name, category, ord)
+	`
+	if _, err := tx.Exec(ctx, query, workflow.ProjectID, keys, names, categories); err != nil {
+		return fmt.Errorf("failed to save workflow statuses: %w", err)
+	}
+
+	query = `
+	insert into workflow_transitions (project_id, from_status, to_status, guards)
+	values ($1, $2, $3, $4)
+	`
+	for _, transition := range workflow.Transitions {
+		guards := transition.Guards
+		if guards == nil {
+			guards = []string{}
+		}
+		if _, err := tx.Exec(ctx, query, workflow.ProjectID, transition.From, transition.To, guards); err != nil {
+			return fmt.Errorf("failed to save workflow transitions: %w", err)
+		}
+	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  workflow.ProjectID,
+		entityType: models.ActivityEntityProject,
+		entityID:   workflow.ProjectID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    diffWorkflow(oldWorkflow, workflow),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit workflow: %w", err)
+	}
+	workflow.Default = false
+	return nil
+}
+
+// Reset drops the project's workflow, so its tasks go back to the default
+// free-form statuses.
+func (r *PgWorkflowRepository) Reset(ctx context.Context, projectID uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin workflow transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	oldWorkflow, err := lockWorkflow(ctx, tx, projectID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `delete from workflow_statuses where project_id = $1`, projectID); err != nil {
+		return fmt.Errorf("failed to reset workflow: %w", err)
+	}
+
+	err = recordActivity(ctx, tx, activity{
+		projectID:  projectID,
+		entityType: models.ActivityEntityProject,
+		entityID:   projectID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    diffWorkflow(oldWorkflow, models.DefaultWorkflow(projectID)),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit workflow reset: %w", err)
+	}
+	return nil
+}
+
+// lockWorkflow locks the project row and returns its current workflow.
+func lockWorkflow(ctx context.Context, tx pgx.Tx, projectID uuid.UUID) (*models.Workflow, error) {
+	var id uuid.UUID
+	if err := tx.QueryRow(ctx, `select id from projects where id = $1 for update`, projectID).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("project record not found (changing workflow): %w", err)
+		}
+		return nil, fmt.Errorf("failed to lock project for workflow: %w", err)
+	}
+	return loadWorkflow(ctx, tx, projectID)
+}
+
+// diffWorkflow records a changed workflow as its status keys and its number
+// of transitions.
+func diffWorkflow(oldWorkflow, newWorkflow *models.Workflow) []fieldChange {
+	var changes []fieldChange
+	if !slices.Equal(oldWorkflow.StatusKeys(), newWorkflow.StatusKeys()) {
+		changes = append(changes, fieldChange{field: "workflow_statuses", oldValue: oldWorkflow.StatusKeys(), newValue: newWorkflow.StatusKeys()})
+	}
+	changes = diffField(changes, "workflow_transitions", len(oldWorkflow.Transitions), len(newWorkflow.Transitions))
+	return changes
+}
+
+// checkTransition makes sure the workflow lets the actor move the task from
+// its current status to status. Tasks of projects on the default workflow
+// move freely.
+func checkTransition(ctx context.Context, tx pgx.Tx, workflow *models.Workflow, task *models.Task, status string, actorID uuid.UUID) error {
+	if workflow.Default || status == task.Status {
+		return nil
+	}
+	if _, ok := workflow.Status(status); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownStatus, status)
+	}
+	if len(workflow.Transitions) == 0 {
+		return nil
+	}
+	transition, ok := workflow.Transition(task.Status, status)
+	if !ok {
+		return ErrTransitionNotAllowed
+	}
+
+	for _, guard := range transition.Guards {
+		switch guard {
+		case models.GuardAssigneeOnly:
+			if task.AssigneeID == nil || *task.AssigneeID != actorID {
+				return fmt.Errorf("%w: only the assignee can move the task to %s", ErrTransitionGuard, status)
+			}
+		case models.GuardAdminOnly:
+			var role string
+			err := tx.QueryRow(ctx, `select role from project_members where project_id = $1 and user_id = $2`, task.ProjectID, actorID).Scan(&role)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("failed to get project role: %w", err)
+			}
+			if !models.ProjectRoleAtLeast(role, models.ProjectRoleAdmin) {
+				return fmt.Errorf("%w: only project admins can move the task to %s", ErrTransitionGuard, status)
+			}
+		case models.GuardSubtasksDone:
+			var open bool
+			query := `select exists (select 1 from tasks where parent_id = $1 and status <> all($2::text[]))`
+			if err := tx.QueryRow(ctx, query, task.ID, workflow.DoneStatuses()).Scan(&open); err != nil {
+				return fmt.Errorf("failed to check child tasks: %w", err)
+			}
+			if open {
+				return fmt.Errorf("%w: child tasks must be done before moving the task to %s", ErrTransitionGuard, status)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajidcodesdotcom/kira/internal/models"
+)
+
+type WorklogRepository interface {
+	Create(ctx context.Context, worklog *models.Worklog) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Worklog, error)
+	Update(ctx context.Context, worklog *models.Worklog) error
+	Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error
+	ListByTask(ctx context.Context, taskID uuid.UUID, limit, offset int) ([]*models.Worklog, error)
+	Timesheet(ctx context.Context, filter TimesheetFilter) (*Timesheet, error)
+}
+
+// worklogSelect selects worklogs with their user's username, in the order
+// scanWorklog reads them.
+const worklogSelect = `
+	select w.id, w.task_id, w.user_id, u.username, w.work_date, w.minutes, w.comment, w.created_at, w.updated_at
+	from worklogs w
+	join users u on u.id = w.user_id
+	`
+
+// TimesheetFilter selects the worklogs of a timesheet. Only work on projects
+// the viewer is a member of is included, whichever user or project is asked
+// for. Days are From to To, both included.
+type TimesheetFilter struct {
+	ViewerID  uuid.UUID
+	UserID    *uuid.UUID
+	ProjectID *uuid.UUID
+	From      time.Time
+	To        time.Time
+}
+
+// TimesheetEntry is the time one user logged on one task on one day.
+type TimesheetEntry struct {
+	Date      string    `json:"date"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	ProjectID uuid.UUID `json:"project_id"`
+	TaskID    uuid.UUID `json:"task_id"`
+	TaskTitle string    `json:"task_title"`
+	Minutes   int       `json:"minutes"`
+}
+
+type TimesheetUserTotal struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Minutes  int       `json:"minutes"`
+}
+
+type TimesheetTaskTotal struct {
+	TaskID    uuid.UUID `json:"task_id"`
+	TaskTitle string    `json:"task_title"`
+	Minutes   int       `json:"minutes"`
+}
+
+type TimesheetDayTotal struct {
+	Date    string `json:"date"`
+	Minutes int    `json:"minutes"`
+}
+
+// Timesheet is the time logged in a date range, per user, task and day, with
+// totals for each. ByDay lists every day of the range, days without work
+// included.
+type Timesheet struct {
+	From         string               `json:"from"`
+	To           string               `json:"to"`
+	TotalMinutes int                  `json:"total_minutes"`
+	Entries      []TimesheetEntry     `json:"entries"`
+	ByUser       []TimesheetUserTotal `json:"by_user"`
+	ByTask       []TimesheetTaskTotal `json:"by_task"`
+	ByDay        []TimesheetDayTotal  `json:"by_day"`
+}
+
+type PgWorklogRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgWorklogRepository(db *pgxpool.Pool) *PgWorklogRepository {
+	return &PgWorklogRepository{db: db}
+}
+
+func scanWorklog(row pgx.Row) (*models.Worklog, error) {
+	worklog := &models.Worklog{}
+	err := row.Scan(
+		&worklog.ID, &worklog.TaskID, &worklog.UserID, &worklog.Username, &worklog.WorkDate, &worklog.Minutes, &worklog.Comment, &worklog.CreatedAt, &worklog.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return worklog, nil
+}
+
+// Create stores the worklog and adds its time to the task.
+func (r *PgWorklogRepository) Create(ctx context.Context, worklog *models.Worklog) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin worklog transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	insert into worklogs (id, task_id, user_id, work_date, minutes, comment, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = tx.Exec(ctx, query, worklog.ID, worklog.TaskID, worklog.UserID, worklog.WorkDate, worklog.Minutes, worklog.Comment, worklog.CreatedAt, worklog.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create worklog: %w", err)
+	}
+
+	if err := addTimeSpent(ctx, tx, worklog.TaskID, worklog.Minutes, worklog.UserID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit worklog: %w", err)
+	}
+	return nil
+}
+
+func (r *PgWorklogRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Worklog, error) {
+	query := worklogSelect + `
+	where w.id = $1
+	`
+	worklog, err := scanWorklog(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("worklog not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get worklog: %w", err)
+	}
+	return worklog, nil
+}
+
+// Update changes the date, time and comment of a worklog. A change of time
+// is carried over to the task.
+func (r *PgWorklogRepository) Update(ctx context.Context, worklog *models.Worklog) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin worklog transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldMinutes int
+	err = tx.QueryRow(ctx, `select minutes from worklogs where id = $1 for update`, worklog.ID).Scan(&oldMinutes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("worklog not found when tried to update: %w", err)
+		}
+		return fmt.Errorf("failed to get worklog to update: %w", err)
+	}
+
+	query := `
+	update worklogs
+	set work_date = $2, minutes = $3, comment = $4, updated_at = $5
+	where id = $1
+	`
+	if _, err := tx.Exec(ctx, query, worklog.ID, worklog.WorkDate, worklog.Minutes, worklog.Comment, worklog.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update worklog: %w", err)
+	}
+
+	if worklog.Minutes != oldMinutes {
+		if err := addTimeSpent(ctx, tx, worklog.TaskID, worklog.Minutes-oldMinutes, worklog.UserID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit worklog update: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the worklog and takes its time off the task.
+func (r *PgWorklogRepository) Delete(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin worklog transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var taskID uuid.UUID
+	var minutes int
+	err = tx.QueryRow(ctx, `delete from worklogs where id = $1 returning task_id, minutes`, id).Scan(&taskID, &minutes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("worklog not found when tried to delete: %w", err)
+		}
+		return fmt.Errorf("failed to delete worklog: %w", err)
+	}
+
+	if err := addTimeSpent(ctx, tx, taskID, -minutes, actorID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit worklog deletion: %w", err)
+	}
+	return nil
+}
+
+// addTimeSpent adds minutes to the time spent on the task and takes them off
+// its remaining estimate, which never drops below zero. Negative minutes give
+// the time back. Both changes are recorded in the task's history.
+func addTimeSpent(ctx context.Context, tx pgx.Tx, taskID uuid.UUID, minutes int, actorID uuid.UUID) error {
+	var projectID uuid.UUID
+	var timeSpent int
+	var remaining *int
+	query := `select project_id, time_spent_minutes, remaining_estimate_minutes from tasks where id = $1 for update`
+	if err := tx.QueryRow(ctx, query, taskID).Scan(&projectID, &timeSpent, &remaining); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("task not found when tried to log time: %w", err)
+		}
+		return fmt.Errorf("failed to get task to log time: %w", err)
+	}
+
+	newTimeSpent := max(timeSpent+minutes, 0)
+	var newRemaining *int
+	if remaining != nil {
+		value := max(*remaining-minutes, 0)
+		newRemaining = &value
+	}
+
+	query = `
+	update tasks
+	set time_spent_minutes = $2, remaining_estimate_minutes = $3, updated_at = now()
+	where id = $1
+	`
+	if _, err := tx.Exec(ctx, query, taskID, newTimeSpent, newRemaining); err != nil {
+		return fmt.Errorf("failed to log time on task: %w", err)
+	}
+
+	var changes []fieldChange
+	changes = diffField(changes, "time_spent_minutes", timeSpent, newTimeSpent)
+	changes = diffOptionalInt(changes, "remaining_estimate_minutes", remaining, newRemaining)
+	return recordActivity(ctx, tx, activity{
+		projectID:  projectID,
+		entityType: models.ActivityEntityTask,
+		entityID:   taskID,
+		actorID:    actorID,
+		action:     models.ActivityUpdated,
+		changes:    changes,
+	})
+}
+
+// ListByTask returns the worklogs of a task, most recent work first.
+func (r *PgWorklogRepository) ListByTask(ctx context.Context, taskID uuid.UUID, limit, offset int) ([]*models.Worklog, error) {
+	query := worklogSelect + `
+	where w.task_id = $1
+	order by w.work_date desc, w.created_at desc
+	limit $2 offset $3
+	`
+	rows, err := r.db.Query(ctx, query, taskID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worklogs: %w", err)
+	}
+	worklogs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Worklog, error) {
+		return scanWorklog(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worklogs: %w", err)
+	}
+	return worklogs, nil
+}
+
+func (r *PgWorklogRepository) Timesheet(ctx context.Context, filter TimesheetFilter) (*Timesheet, error) {
+	query := `
+	select w.work_date, w.user_id, u.username, t.project_id, w.task_id, t.title, sum(w.minutes)
+	from worklogs w
+	join tasks t on t.id = w.task_id
+	join users u on u.id = w.user_id
+	where w.work_date between $1 and $2
+		and t.project_id in (select project_id from project_members where user_id = $3)
+		and ($4::uuid is null or w.user_id = $4)
+		and ($5::uuid is null or t.project_id = $5)
+	group by w.work_date, w.user_id, u.username, t.project_id, w.task_id, t.title
+	order by w.work_date, u.username, t.title
+	`
+	rows, err := r.db.Query(ctx, query, filter.From, filter.To, filter.ViewerID, filter.UserID, filter.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timesheet: %w", err)
+	}
+
+	timesheet := &Timesheet{
+		From:    filter.From.Format(reportDateLayout),
+		To:      filter.To.Format(reportDateLayout),
+		Entries: []TimesheetEntry{},
+		ByUser:  []TimesheetUserTotal{},
+		ByTask:  []TimesheetTaskTotal{},
+		ByDay:   []TimesheetDayTotal{},
+	}
+	userTotals := make(map[uuid.UUID]int)
+	taskTotals := make(map[uuid.UUID]int)
+	dayTotals := make(map[string]int)
+
+	var entry TimesheetEntry
+	var workDate time.Time
+	_, err = pgx.ForEachRow(rows, []any{&workDate, &entry.UserID, &entry.Username, &entry.ProjectID, &entry.TaskID, &entry.TaskTitle, &entry.Minutes}, func() error {
+		entry.Date = workDate.Format(reportDateLayout)
+		timesheet.Entries = append(timesheet.Entries, entry)
+		timesheet.TotalMinutes += entry.Minutes
+
+		if _, ok := userTotals[entry.UserID]; !ok {
+			timesheet.ByUser = append(timesheet.ByUser, TimesheetUserTotal{UserID: entry.UserID, Username: entry.Username})
+		}
+		userTotals[entry.UserID] += entry.Minutes
+		if _, ok := taskTotals[entry.TaskID]; !ok {
+			timesheet.ByTask = append(timesheet.ByTask, TimesheetTaskTotal{TaskID: entry.TaskID, TaskTitle: entry.TaskTitle})
+		}
+		taskTotals[entry.TaskID] += entry.Minutes
+		dayTotals[entry.Date] += entry.Minutes
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timesheet: %w", err)
+	}
+
+	for i := range timesheet.ByUser {
+		timesheet.ByUser[i].Minutes = userTotals[timesheet.ByUser[i].UserID]
+	}
+	for i := range timesheet.ByTask {
+		timesheet.ByTask[i].Minutes = taskTotals[timesheet.ByTask[i].TaskID]
+	}
+	for day := truncateDay(filter.From); !day.After(truncateDay(filter.To)); day = day.AddDate(0, 0, 1) {
+		date := day.Format(reportDateLayout)
+		timesheet.ByDay = append(timesheet.ByDay, TimesheetDayTotal{Date: date, Minutes: dayTotals[date]})
+	}
+	return timesheet, nil
+}
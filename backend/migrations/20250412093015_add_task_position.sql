@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table tasks
+add column position integer not null default 0;
+
+update tasks t
+set position = ranked.rn - 1
+from (
+    select id, row_number() over (partition by project_id, status order by created_at) as rn
+    from tasks
+) ranked
+where t.id = ranked.id;
+
+create index idx_tasks_board on tasks (project_id, status, position);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_tasks_board;
+
+alter table tasks
+drop column position;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists project_members (
+        project_id uuid not null references projects (id) on delete cascade,
+        user_id uuid not null references users (id) on delete cascade,
+        role varchar(20) not null default 'member' check (role in ('owner', 'admin', 'member', 'viewer')),
+        created_at timestamp
+        with
+            time zone default now (),
+            updated_at timestamp
+        with
+            time zone default now (),
+            primary key (project_id, user_id)
+    );
+
+create index idx_project_members_user on project_members (user_id);
+
+insert into project_members (project_id, user_id, role, created_at, updated_at)
+select id, owner_id, 'owner', created_at, updated_at
+from projects
+on conflict do nothing;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_project_members_user;
+
+drop table if exists project_members;
+
+-- +goose StatementEnd
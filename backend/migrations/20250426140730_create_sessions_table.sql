@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists sessions (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        user_agent text not null default '',
+        ip varchar(64) not null default '',
+        created_at timestamp
+        with
+            time zone default now (),
+            last_used_at timestamp
+        with
+            time zone default now (),
+            revoked_at timestamp
+        with
+            time zone
+    );
+
+create index idx_sessions_user on sessions (user_id);
+
+create table
+    if not exists refresh_tokens (
+        id uuid primary key default uuid_generate_v4 (),
+        session_id uuid not null references sessions (id) on delete cascade,
+        token_hash varchar(64) unique not null,
+        expires_at timestamp
+        with
+            time zone not null,
+            used_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+create index idx_refresh_tokens_session on refresh_tokens (session_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_refresh_tokens_session;
+
+drop table if exists refresh_tokens;
+
+drop index if exists idx_sessions_user;
+
+drop table if exists sessions;
+
+-- +goose StatementEnd
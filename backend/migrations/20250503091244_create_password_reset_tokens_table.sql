@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists password_reset_tokens (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        token_hash varchar(64) unique not null,
+        expires_at timestamp
+        with
+            time zone not null,
+            used_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+create index idx_password_reset_tokens_user on password_reset_tokens (user_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_password_reset_tokens_user;
+
+drop table if exists password_reset_tokens;
+
+-- +goose StatementEnd
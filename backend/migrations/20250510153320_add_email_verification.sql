@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table users
+add column email_verified_at timestamp
+with
+    time zone;
+
+-- accounts created before verification existed keep working as before
+update users
+set email_verified_at = created_at;
+
+create table
+    if not exists email_verification_tokens (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        token_hash varchar(64) unique not null,
+        expires_at timestamp
+        with
+            time zone not null,
+            used_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+create index idx_email_verification_tokens_user on email_verification_tokens (user_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_email_verification_tokens_user;
+
+drop table if exists email_verification_tokens;
+
+alter table users
+drop column email_verified_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,56 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists user_totp (
+        user_id uuid primary key references users (id) on delete cascade,
+        secret_encrypted text not null,
+        enabled_at timestamp
+        with
+            time zone,
+            last_used_step bigint,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+create table
+    if not exists user_recovery_codes (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        code_hash varchar(64) not null,
+        used_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now (),
+            unique (user_id, code_hash)
+    );
+
+create table
+    if not exists two_factor_challenges (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        token_hash varchar(64) unique not null,
+        attempts integer not null default 0,
+        expires_at timestamp
+        with
+            time zone not null,
+            used_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists two_factor_challenges;
+
+drop table if exists user_recovery_codes;
+
+drop table if exists user_totp;
+
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists personal_access_tokens (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        name varchar(100) not null,
+        token_prefix varchar(20) not null,
+        token_hash varchar(64) unique not null,
+        scopes text[] not null default '{}',
+        expires_at timestamp
+        with
+            time zone,
+            last_used_at timestamp
+        with
+            time zone,
+            revoked_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+create index idx_personal_access_tokens_user on personal_access_tokens (user_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_personal_access_tokens_user;
+
+drop table if exists personal_access_tokens;
+
+-- +goose StatementEnd
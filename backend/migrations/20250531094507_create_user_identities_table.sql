@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists user_identities (
+        id uuid primary key default uuid_generate_v4 (),
+        user_id uuid not null references users (id) on delete cascade,
+        issuer text not null,
+        subject text not null,
+        email varchar(255) not null default '',
+        created_at timestamp
+        with
+            time zone default now (),
+            last_login_at timestamp
+        with
+            time zone default now (),
+            unique (issuer, subject)
+    );
+
+create index idx_user_identities_user on user_identities (user_id);
+
+create table
+    if not exists oidc_login_states (
+        id uuid primary key default uuid_generate_v4 (),
+        state_hash varchar(64) unique not null,
+        nonce varchar(64) not null,
+        code_verifier varchar(128) not null,
+        redirect_to text not null default '/',
+        expires_at timestamp
+        with
+            time zone not null,
+            created_at timestamp
+        with
+            time zone default now ()
+    );
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists oidc_login_states;
+
+drop index if exists idx_user_identities_user;
+
+drop table if exists user_identities;
+
+-- +goose StatementEnd
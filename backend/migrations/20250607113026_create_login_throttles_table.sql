@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists login_throttles (
+        key varchar(320) primary key,
+        failures integer not null default 0,
+        last_failure_at timestamp
+        with
+            time zone not null default now (),
+            blocked_until timestamp
+        with
+            time zone
+    );
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists login_throttles;
+
+-- +goose StatementEnd
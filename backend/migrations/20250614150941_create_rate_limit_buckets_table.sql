@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists rate_limit_buckets (
+        key varchar(255) primary key,
+        tokens double precision not null,
+        updated_at timestamp
+        with
+            time zone not null default now (),
+            expires_at timestamp
+        with
+            time zone not null default now ()
+    );
+
+create index idx_rate_limit_buckets_expires on rate_limit_buckets (expires_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_rate_limit_buckets_expires;
+
+drop table if exists rate_limit_buckets;
+
+-- +goose StatementEnd
@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists task_comments (
+        id uuid primary key default uuid_generate_v4 (),
+        task_id uuid not null references tasks (id) on delete cascade,
+        author_id uuid not null references users (id) on delete cascade,
+        parent_id uuid references task_comments (id) on delete cascade,
+        body text not null,
+        created_at timestamp
+        with
+            time zone default now (),
+            updated_at timestamp
+        with
+            time zone default now (),
+            deleted_at timestamp
+        with
+            time zone
+    );
+
+create index idx_task_comments_task on task_comments (task_id, created_at);
+
+create index idx_task_comments_parent on task_comments (parent_id);
+
+create table
+    if not exists task_comment_mentions (
+        comment_id uuid not null references task_comments (id) on delete cascade,
+        user_id uuid not null references users (id) on delete cascade,
+        primary key (comment_id, user_id)
+    );
+
+create index idx_task_comment_mentions_user on task_comment_mentions (user_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_task_comment_mentions_user;
+
+drop table if exists task_comment_mentions;
+
+drop index if exists idx_task_comments_parent;
+
+drop index if exists idx_task_comments_task;
+
+drop table if exists task_comments;
+
+-- +goose StatementEnd
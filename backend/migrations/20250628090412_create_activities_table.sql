@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+-- entity and actor ids are not foreign keys, the history outlives deleted
+-- tasks, projects and users
+create table
+    if not exists activities (
+        id bigint generated always as identity primary key,
+        project_id uuid not null,
+        entity_type varchar(20) not null,
+        entity_id uuid not null,
+        actor_id uuid,
+        action varchar(20) not null,
+        field varchar(50),
+        old_value jsonb,
+        new_value jsonb,
+        created_at timestamp
+        with
+            time zone not null default now ()
+    );
+
+create index idx_activities_project on activities (project_id, id desc);
+
+create index idx_activities_entity on activities (entity_type, entity_id, id desc);
+
+create function activities_append_only () returns trigger as $$
+begin
+    raise exception 'activities are append-only';
+end;
+$$ language plpgsql;
+
+create trigger activities_append_only before
+update
+or delete on activities for each row
+execute function activities_append_only ();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop trigger if exists activities_append_only on activities;
+
+drop function if exists activities_append_only ();
+
+drop index if exists idx_activities_entity;
+
+drop index if exists idx_activities_project;
+
+drop table if exists activities;
+
+-- +goose StatementEnd
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+-- actor and target ids are not foreign keys, the audit log has to outlive the
+-- users and tokens it is about
+create table
+    if not exists audit_logs (
+        id bigint generated always as identity primary key,
+        event_type varchar(50) not null,
+        outcome varchar(10) not null,
+        actor_id uuid,
+        target_type varchar(30) not null default '',
+        target_id text not null default '',
+        ip varchar(64) not null default '',
+        user_agent text not null default '',
+        request_id varchar(64) not null default '',
+        metadata jsonb not null default '{}',
+        created_at timestamp
+        with
+            time zone not null,
+            prev_hash char(64) not null,
+            hash char(64) not null unique
+    );
+
+create index idx_audit_logs_created_at on audit_logs (created_at desc);
+
+create index idx_audit_logs_actor on audit_logs (actor_id, id desc);
+
+create index idx_audit_logs_event_type on audit_logs (event_type, id desc);
+
+create function audit_logs_append_only () returns trigger as $$
+begin
+    raise exception 'audit_logs are append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_logs_append_only before
+update
+or delete on audit_logs for each row
+execute function audit_logs_append_only ();
+
+create trigger audit_logs_no_truncate before truncate on audit_logs for each statement
+execute function audit_logs_append_only ();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop trigger if exists audit_logs_no_truncate on audit_logs;
+
+drop trigger if exists audit_logs_append_only on audit_logs;
+
+drop function if exists audit_logs_append_only ();
+
+drop index if exists idx_audit_logs_event_type;
+
+drop index if exists idx_audit_logs_actor;
+
+drop index if exists idx_audit_logs_created_at;
+
+drop table if exists audit_logs;
+
+-- +goose StatementEnd
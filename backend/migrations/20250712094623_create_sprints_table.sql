@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists sprints (
+        id uuid primary key default uuid_generate_v4 (),
+        project_id uuid not null references projects (id) on delete cascade,
+        name varchar(100) not null,
+        goal text not null default '',
+        start_date date not null,
+        end_date date not null,
+        status varchar(20) not null default 'planned',
+        started_at timestamp
+        with
+            time zone,
+            closed_at timestamp
+        with
+            time zone,
+            created_at timestamp
+        with
+            time zone default now (),
+            updated_at timestamp
+        with
+            time zone default now (),
+            constraint sprints_dates_check check (end_date >= start_date),
+            constraint sprints_status_check check (status in ('planned', 'active', 'closed'))
+    );
+
+create index idx_sprints_project on sprints (project_id, start_date);
+
+-- at most one active sprint per project
+create unique index idx_sprints_one_active on sprints (project_id)
+where
+    status = 'active';
+
+alter table tasks
+add column sprint_id uuid references sprints (id) on delete set null;
+
+create index idx_tasks_sprint on tasks (sprint_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_tasks_sprint;
+
+alter table tasks
+drop column sprint_id;
+
+drop index if exists idx_sprints_one_active;
+
+drop index if exists idx_sprints_project;
+
+drop table if exists sprints;
+
+-- +goose StatementEnd
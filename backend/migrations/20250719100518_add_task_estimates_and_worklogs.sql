@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table tasks
+add column story_points integer check (story_points >= 0),
+add column original_estimate_minutes integer check (original_estimate_minutes >= 0),
+add column remaining_estimate_minutes integer check (remaining_estimate_minutes >= 0),
+add column time_spent_minutes integer not null default 0;
+
+create table
+    if not exists worklogs (
+        id uuid primary key default uuid_generate_v4 (),
+        task_id uuid not null references tasks (id) on delete cascade,
+        user_id uuid not null references users (id) on delete cascade,
+        work_date date not null,
+        minutes integer not null,
+        comment text not null default '',
+        created_at timestamp
+        with
+            time zone default now (),
+            updated_at timestamp
+        with
+            time zone default now (),
+            constraint worklogs_minutes_check check (minutes > 0)
+    );
+
+create index idx_worklogs_task on worklogs (task_id, work_date);
+
+create index idx_worklogs_user on worklogs (user_id, work_date);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_worklogs_user;
+
+drop index if exists idx_worklogs_task;
+
+drop table if exists worklogs;
+
+alter table tasks
+drop column time_spent_minutes,
+drop column remaining_estimate_minutes,
+drop column original_estimate_minutes,
+drop column story_points;
+
+-- +goose StatementEnd
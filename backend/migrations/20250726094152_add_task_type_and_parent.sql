@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table tasks
+add column type varchar(20) not null default 'task',
+add column parent_id uuid references tasks (id) on delete set null,
+add constraint tasks_type_check check (type in ('epic', 'story', 'task', 'bug', 'subtask')),
+add constraint tasks_parent_check check (parent_id <> id);
+
+create index idx_tasks_parent on tasks (parent_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_tasks_parent;
+
+alter table tasks
+drop constraint tasks_parent_check,
+drop constraint tasks_type_check,
+drop column parent_id,
+drop column type;
+
+-- +goose StatementEnd
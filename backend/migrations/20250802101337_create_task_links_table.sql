@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table projects
+add column require_blockers_done boolean not null default false;
+
+create table
+    if not exists task_links (
+        id uuid primary key default uuid_generate_v4 (),
+        source_task_id uuid not null references tasks (id) on delete cascade,
+        target_task_id uuid not null references tasks (id) on delete cascade,
+        link_type varchar(20) not null,
+        created_by uuid references users (id) on delete set null,
+        created_at timestamp
+        with
+            time zone default now (),
+            constraint task_links_type_check check (link_type in ('blocks', 'relates_to', 'duplicates')),
+            constraint task_links_self_check check (source_task_id <> target_task_id),
+            constraint task_links_unique unique (source_task_id, target_task_id, link_type)
+    );
+
+create index idx_task_links_target on task_links (target_task_id, link_type);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_task_links_target;
+
+drop table if exists task_links;
+
+alter table projects
+drop column require_blockers_done;
+
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists workflow_statuses (
+        project_id uuid not null references projects (id) on delete cascade,
+        key varchar(50) not null,
+        name varchar(100) not null,
+        category varchar(20) not null,
+        position integer not null,
+        primary key (project_id, key),
+        constraint workflow_statuses_category_check check (category in ('todo', 'in_progress', 'done'))
+    );
+
+-- a transition without from_status can be taken from any status
+create table
+    if not exists workflow_transitions (
+        id bigint generated always as identity primary key,
+        project_id uuid not null references projects (id) on delete cascade,
+        from_status varchar(50),
+        to_status varchar(50) not null,
+        guards text[] not null default '{}',
+        foreign key (project_id, from_status) references workflow_statuses (project_id, key) on delete cascade,
+        foreign key (project_id, to_status) references workflow_statuses (project_id, key) on delete cascade
+    );
+
+create index idx_workflow_transitions_project on workflow_transitions (project_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_workflow_transitions_project;
+
+drop table if exists workflow_transitions;
+
+drop table if exists workflow_statuses;
+
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists labels (
+        id uuid primary key default uuid_generate_v4 (),
+        project_id uuid not null references projects (id) on delete cascade,
+        name varchar(50) not null,
+        color varchar(7) not null,
+        created_at timestamp
+        with
+            time zone default now (),
+            updated_at timestamp
+        with
+            time zone default now ()
+    );
+
+-- label names are unique within a project, regardless of case
+create unique index idx_labels_project_name on labels (project_id, lower(name));
+
+create table
+    if not exists task_labels (
+        task_id uuid not null references tasks (id) on delete cascade,
+        label_id uuid not null references labels (id) on delete cascade,
+        primary key (task_id, label_id)
+    );
+
+create index idx_task_labels_label on task_labels (label_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_task_labels_label;
+
+drop table if exists task_labels;
+
+drop index if exists idx_labels_project_name;
+
+drop table if exists labels;
+
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+create table
+    if not exists custom_fields (
+        id uuid primary key default uuid_generate_v4 (),
+        project_id uuid not null references projects (id) on delete cascade,
+        name varchar(100) not null,
+        field_type varchar(20) not null,
+        options text[] not null default '{}',
+        created_at timestamp
+        with
+            time zone default now (),
+            updated_at timestamp
+        with
+            time zone default now (),
+            constraint custom_fields_type_check check (field_type in ('text', 'number', 'date', 'single_select', 'multi_select', 'user'))
+    );
+
+-- field names are unique within a project, regardless of case
+create unique index idx_custom_fields_project_name on custom_fields (project_id, lower(name));
+
+-- values are stored as json: strings for text, dates, options and user ids,
+-- numbers for numbers and arrays of strings for multi selects
+create table
+    if not exists task_custom_values (
+        task_id uuid not null references tasks (id) on delete cascade,
+        field_id uuid not null references custom_fields (id) on delete cascade,
+        value jsonb not null,
+        primary key (task_id, field_id)
+    );
+
+create index idx_task_custom_values_field on task_custom_values (field_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_task_custom_values_field;
+
+drop table if exists task_custom_values;
+
+drop index if exists idx_custom_fields_project_name;
+
+drop table if exists custom_fields;
+
+-- +goose StatementEnd
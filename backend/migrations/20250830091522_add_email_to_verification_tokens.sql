@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- tokens only verify the address they were sent to; outstanding tokens
+-- don't record it and stop working
+alter table email_verification_tokens
+add column email varchar(255) not null default '';
+
+alter table email_verification_tokens
+alter column email
+drop default;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+alter table email_verification_tokens
+drop column email;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- not valid leaves existing rows alone, only new and changed projects are
+-- checked. Projects with another status are reported so they can be fixed by
+-- hand before running
+--   alter table projects validate constraint projects_status_check;
+alter table projects
+add constraint projects_status_check check (status in ('active', 'inactive')) not valid;
+
+do $$
+declare
+    offending text;
+begin
+    select
+        string_agg(id::text || ' (' || status || ')', ', ')
+    into offending
+    from projects
+    where status not in ('active', 'inactive');
+
+    if offending is not null then
+        raise notice 'projects with a status other than active or inactive: %', offending;
+    end if;
+end $$;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+alter table projects
+drop constraint if exists projects_status_check;
+
+-- +goose StatementEnd
@@ -2,8 +2,10 @@ package utils
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -69,3 +71,35 @@ func GetValidationErrors(err error) string {
 
 	return strings.Join(errMsgs, "; ")
 }
+
+// ClientIP returns the IP address of the client. The X-Forwarded-For header is
+// only trusted when TRUST_PROXY_HEADERS is true, since clients can set it to
+// anything when they talk to the server directly. Even behind a proxy only
+// the entries the proxies appended can be trusted, so the address is taken
+// TRUSTED_PROXY_COUNT (default 1) entries from the right.
+func ClientIP(r *http.Request) string {
+	if GetEnvOrDefault("TRUST_PROXY_HEADERS", "false") == "true" {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(header, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			proxies, err := strconv.Atoi(GetEnvOrDefault("TRUSTED_PROXY_COUNT", "1"))
+			if err != nil || proxies < 1 {
+				proxies = 1
+			}
+			// with fewer entries than proxies, the leftmost one was still
+			// appended by a proxy
+			return hops[max(0, len(hops)-proxies)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}